@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"test_task_wb/internal/config"
+	"time"
+)
+
+// adminClient обращается к админскому API запущенного сервиса: кэш живёт в памяти процесса,
+// поэтому изменения, которые должны его затронуть, выполняет сам сервис
+type adminClient struct {
+	addr   *string
+	apiKey *string
+}
+
+// newAdminClient добавляет в fs флаги адреса сервиса и API-ключа с областью admin
+func newAdminClient(fs *flag.FlagSet, cfg *config.Config) *adminClient {
+	return &adminClient{
+		addr:   fs.String("addr", "http://localhost"+cfg.HTTPAddr(), "base URL of the running service"),
+		apiKey: fs.String("api-key", os.Getenv("ORDER_SERVICE_API_KEY"), "API key with the admin scope"),
+	}
+}
+
+// post отправляет POST на path с параметрами query и возвращает тело успешного ответа
+func (c *adminClient) post(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	target, err := url.JoinPath(*c.addr, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if *c.apiKey != "" {
+		req.Header.Set("X-API-Key", *c.apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("service responded %s: %s", resp.Status, body)
+	}
+	return body, nil
+}
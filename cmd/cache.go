@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/url"
+	"os"
+	"strconv"
+	"test_task_wb/internal/config"
+)
+
+// runCache выполняет подкоманды работы с кэшем запущенного сервиса.
+// Кэш живёт в памяти процесса, поэтому CLI обращается к его админскому API.
+// Использование: cache warm [-addr url] [-limit n]
+func runCache(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "warm" {
+		return errors.New("usage: cache warm [-addr url] [-limit n]")
+	}
+
+	fs := flag.NewFlagSet("cache warm", flag.ExitOnError)
+	admin := newAdminClient(fs, cfg)
+	limit := fs.Int("limit", cfg.CacheCapacity, "number of most recent orders to load")
+	fs.Parse(args[1:])
+
+	body, err := admin.post(ctx, "/admin/cache/warm", url.Values{"limit": {strconv.Itoa(*limit)}})
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(body)
+	return err
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// runConfig выполняет подкоманды работы с конфигурацией.
+// Использование: [флаги сервиса] config print [флаги сервиса] - выводит действующую конфигурацию со скрытыми секретами.
+// configArgs - флаги конфигурации перед подкомандой
+func runConfig(configArgs, args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: config print [flags]")
+	}
+
+	cfg := loadConfig(append(configArgs, args[1:]...))
+	return cfg.WriteYAML(os.Stdout)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"test_task_wb/internal/broker"
+	"test_task_wb/internal/config"
+)
+
+// runConsumer выполняет подкоманды управления группой консьюмеров.
+// Использование: consumer reset-offsets -to earliest|latest|<offset>|<RFC 3339 time> [-dry-run]
+func runConsumer(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "reset-offsets" {
+		return errors.New("usage: consumer reset-offsets -to earliest|latest|<offset>|<time> [-dry-run]")
+	}
+
+	fs := flag.NewFlagSet("consumer reset-offsets", flag.ExitOnError)
+	to := fs.String("to", "", "target: earliest, latest, an offset or an RFC 3339 time")
+	dryRun := fs.Bool("dry-run", false, "only print the new offsets")
+	fs.Parse(args[1:])
+
+	target, err := broker.ParseOffsetTarget(*to)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.KafkaClientTimeout*3)
+	defer cancel()
+
+	changes, err := broker.ResetOffsets(ctx, broker.ReaderSettings{
+		Brokers: cfg.KafkaBrokers,
+		Topic:   cfg.KafkaTopic,
+		GroupID: cfg.KafkaGroupID,
+	}, target, *dryRun)
+	if err != nil {
+		return err
+	}
+	if !*dryRun {
+		slog.Info("Consumer group offsets reset", "topic", cfg.KafkaTopic, "group_id", cfg.KafkaGroupID, "to", *to)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(changes)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/user"
+	"test_task_wb/internal/config"
+	"test_task_wb/internal/encryption"
+	"test_task_wb/internal/storage"
+)
+
+// runEraseCustomer обезличивает персональные данные клиента. По умолчанию запрос уходит в админский API
+// запущенного сервиса, который вытесняет затронутые заказы из своего кэша. С -offline данные обезличиваются
+// напрямую в БД - только когда сервис остановлен, иначе его кэш продолжит отдавать исходные данные.
+// Использование: erase-customer [-addr url] [-api-key key] [-offline [-requested-by name]] <customer_id>
+func runEraseCustomer(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("erase-customer", flag.ExitOnError)
+	admin := newAdminClient(fs, cfg)
+	offline := fs.Bool("offline", false, "erase directly in the database; use only while the service is stopped")
+	requestedBy := fs.String("requested-by", currentUser(), "who requested an offline erasure (recorded in the audit table)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("exactly one customer_id is required")
+	}
+	customerID := fs.Arg(0)
+
+	if !*offline {
+		body, err := admin.post(ctx, "/admin/customers/"+url.PathEscape(customerID)+"/erase", nil)
+		if err != nil {
+			return fmt.Errorf("%w (use -offline only if the service is stopped)", err)
+		}
+		_, err = os.Stdout.Write(body)
+		return err
+	}
+
+	dbStorage, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer dbStorage.Close()
+
+	result, err := dbStorage.EraseCustomer(ctx, customerID, "cli:"+*requestedBy)
+	if err != nil {
+		return err
+	}
+
+	// при запуске на работающем сервисе его кэш продолжит отдавать исходные данные до перезапуска или вытеснения
+	slog.Warn("Customer erased offline; restart any running service instance to drop cached orders",
+		"orders_affected", len(result.OrderUIDs))
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// openStorage подключается к БД с теми же настройками шифрования, что и сервис
+func openStorage(ctx context.Context, cfg *config.Config) (*storage.Storage, error) {
+	keyring, err := encryption.Load(cfg.PIIKeyFile, cfg.PIIKeys, cfg.PIIActiveKeyID)
+	if err != nil {
+		return nil, err
+	}
+	blindIndex, err := encryption.LoadBlindIndex(cfg.PIISearchKey)
+	if err != nil {
+		return nil, err
+	}
+
+	dbPool, err := storage.NewDB(ctx, cfg.DatabaseURL, storage.RetryBudget{
+		Total:       cfg.DBConnectTimeout,
+		Attempt:     cfg.DBAttemptTimeout,
+		MaxInterval: cfg.DBMaxRetryInterval,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewStorage(dbPool, storage.WithKeyring(keyring), storage.WithBlindIndex(blindIndex)), nil
+}
+
+// currentUser возвращает имя пользователя ОС для записи в журнал аудита
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
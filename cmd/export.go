@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"test_task_wb/internal/config"
+	"test_task_wb/internal/export"
+	"test_task_wb/internal/storage"
+	"time"
+)
+
+// runExport выгружает товары неотменённых заказов в локальный файл.
+// Использование: export [-format csv|ndjson|parquet] [-compress none|gzip|zstd] [-out path]
+// [-from date] [-to date] [-delivery-service name] [-customer-id id]
+func runExport(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	formatFlag := fs.String("format", "csv", "output format: csv, ndjson or parquet")
+	compressFlag := fs.String("compress", "none", "compression: none, gzip or zstd (parquet compresses column pages)")
+	out := fs.String("out", "", "output file (default: orders-<timestamp> with the format extension)")
+	from := fs.String("from", "", "first order creation time, inclusive (RFC 3339 or YYYY-MM-DD)")
+	to := fs.String("to", "", "last order creation time, exclusive (RFC 3339 or YYYY-MM-DD)")
+	deliveryService := fs.String("delivery-service", "", "export only orders of this delivery service")
+	customerID := fs.String("customer-id", "", "export only orders of this customer")
+	fs.Parse(args)
+
+	format, err := export.ParseFormat(*formatFlag)
+	if err != nil {
+		return err
+	}
+	compression, err := export.ParseCompression(*compressFlag)
+	if err != nil {
+		return err
+	}
+	filter := storage.ExportFilter{DeliveryService: *deliveryService, CustomerID: *customerID}
+	if filter.From, err = parseTime(*from); err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	if filter.To, err = parseTime(*to); err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+
+	path := *out
+	if path == "" {
+		path = "orders-" + time.Now().UTC().Format("20060102-150405") + export.Extension(format, compression)
+	}
+
+	dbStorage, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer dbStorage.Close()
+
+	// выгрузка пишется во временный файл рядом с итоговым, чтобы прерванная выгрузка не оставила неполный файл
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w, err := export.NewWriter(tmp, format, compression)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	n, err := dbStorage.ExportOrders(ctx, filter, w.Write)
+	if err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	slog.Info("Orders exported", "file", path, "rows", n, "format", format, "compression", compression, "duration", time.Since(start))
+	return nil
+}
+
+// parseTime разбирает время в формате RFC 3339 или дату YYYY-MM-DD (полночь UTC); пустая строка даёт нулевое время
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"test_task_wb/internal/auth"
+)
+
+// runHashAPIKey читает ключ API из stdin и печатает его SHA-256 хэш для AUTH_API_KEYS.
+// Ключ не передаётся аргументом, чтобы не попадать в историю команд
+func runHashAPIKey() error {
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return errors.New("no API key provided on stdin")
+	}
+
+	key := strings.TrimSpace(scanner.Text())
+	if key == "" {
+		return errors.New("API key must not be empty")
+	}
+
+	fmt.Println(auth.HashAPIKey(key))
+	return nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log/slog"
 	"os"
 	"test_task_wb/internal/app"
@@ -14,18 +16,106 @@ func main() {
 	slogLogger := logger.NewSlogLogger()
 	slog.SetDefault(slogLogger)
 
-	slog.Info("Starting service...")
+	// 2. Разбор подкоманды: флаги конфигурации идут перед ней (order-service -config prod.yaml migrate up),
+	// без подкоманды запускается сервис, как и по serve
+	configArgs, args, err := config.SplitArgs(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		exitOnError("Failed to parse command line", err)
+	}
+	command := ""
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
 
-	// 2. Загрузка конфигурации
-	cfg := config.Load()
+	// 3. Выполнение подкоманды, если она указана
+	ctx := context.Background()
+	switch command {
+	case "", "serve":
+	case "config":
+		if err := runConfig(configArgs, args); err != nil {
+			exitOnError("Failed to print config", err)
+		}
+		return
+	case "migrate":
+		if err := runMigrate(loadConfig(configArgs), args); err != nil {
+			exitOnError("Failed to run migrations", err)
+		}
+		return
+	case "order":
+		if err := runOrder(ctx, loadConfig(configArgs), args); err != nil {
+			exitOnError("Order command failed", err)
+		}
+		return
+	case "cache":
+		if err := runCache(ctx, loadConfig(configArgs), args); err != nil {
+			exitOnError("Cache command failed", err)
+		}
+		return
+	case "consumer":
+		if err := runConsumer(ctx, loadConfig(configArgs), args); err != nil {
+			exitOnError("Consumer command failed", err)
+		}
+		return
+	case "erase-customer":
+		if err := runEraseCustomer(ctx, loadConfig(configArgs), args); err != nil {
+			exitOnError("Failed to erase customer data", err)
+		}
+		return
+	case "export":
+		if err := runExport(ctx, loadConfig(configArgs), args); err != nil {
+			exitOnError("Failed to export orders", err)
+		}
+		return
+	case "rollups":
+		if err := runRollups(ctx, loadConfig(configArgs), args); err != nil {
+			exitOnError("Rollups command failed", err)
+		}
+		return
+	case "hash-api-key":
+		if err := runHashAPIKey(); err != nil {
+			exitOnError("Failed to hash API key", err)
+		}
+		return
+	default:
+		slog.Error("Unknown command", "command", command)
+		os.Exit(2)
+	}
 
-	// 3. Создание экземпляра приложения
-	application, err := app.New(context.Background(), cfg)
+	// 4. Загрузка конфигурации: файл, переменные окружения и флаги до и после serve
+	cfg := loadConfig(append(configArgs, args...))
+
+	slog.Info("Starting service...", "config_file", cfg.ConfigFile)
+
+	// 5. Создание экземпляра приложения
+	application, err := app.New(ctx, cfg)
 	if err != nil {
 		slog.Error("Failed to initialize application", "error", err)
 		os.Exit(1)
 	}
 
-	// 4. Запуск приложения
+	// 6. Запуск приложения
 	application.Run()
 }
+
+// loadConfig загружает конфигурацию и завершает процесс, если она некорректна
+func loadConfig(args []string) *config.Config {
+	cfg, err := config.Load(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		exitOnError("Failed to load configuration", err)
+	}
+	if err := logger.SetLevel(cfg.LogLevel); err != nil {
+		exitOnError("Failed to set log level", err)
+	}
+	return cfg
+}
+
+func exitOnError(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
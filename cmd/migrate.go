@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"test_task_wb/internal/config"
+	"test_task_wb/migrations"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// runMigrate применяет встроенные миграции схемы.
+// Использование: migrate up | migrate down [-steps n | -all] | migrate status | migrate force <version>
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down|status|force")
+	}
+
+	m, err := migrations.New(cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "up":
+		err = m.Up()
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := fs.Int("steps", 1, "number of migrations to roll back")
+		all := fs.Bool("all", false, "roll back all migrations")
+		fs.Parse(args[1:])
+
+		if *all {
+			err = m.Down()
+		} else if *steps <= 0 {
+			return errors.New("-steps must be positive")
+		} else {
+			err = m.Steps(-*steps)
+		}
+	case "status":
+		st, err := migrations.GetStatus(m)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(st)
+	case "force":
+		// снимает признак dirty после ручного исправления схемы
+		if len(args) != 2 {
+			return errors.New("usage: migrate force <version>")
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		err = m.Force(version)
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down, status or force", args[0])
+	}
+
+	if errors.Is(err, migrate.ErrNoChange) {
+		slog.Info("Schema is already up to date")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	version, dirty, _ := m.Version()
+	slog.Info("Migrations applied", "command", args[0], "version", version, "dirty", dirty)
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"test_task_wb/internal/config"
+	"test_task_wb/internal/model"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// runOrder выполняет подкоманды работы с заказами напрямую через БД.
+// Использование: order get <order_uid> | order import <file|->
+func runOrder(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: order get <order_uid> | order import <file|->")
+	}
+
+	switch args[0] {
+	case "get":
+		return getOrder(ctx, cfg, args[1])
+	case "import":
+		return importOrders(ctx, cfg, args[1])
+	default:
+		return fmt.Errorf("unknown order command %q, expected get or import", args[0])
+	}
+}
+
+// getOrder выводит заказ из БД без маскирования: CLI запускается с доступом к БД и ключам
+func getOrder(ctx context.Context, cfg *config.Config, orderUID string) error {
+	dbStorage, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer dbStorage.Close()
+
+	order, err := dbStorage.GetOrderByUID(ctx, orderUID)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(order)
+}
+
+// importOrders загружает заказы из файла (JSON-массив, один объект или NDJSON) с той же валидацией,
+// что и у консьюмера. Некорректные заказы пропускаются
+func importOrders(ctx context.Context, cfg *config.Config, path string) error {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	orders, err := decodeOrders(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+
+	dbStorage, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer dbStorage.Close()
+
+	validate := validator.New()
+	imported, skipped := 0, 0
+	for i, order := range orders {
+		if err := validate.Struct(order); err != nil {
+			slog.Warn("Skipping invalid order", "index", i, "order_uid", order.OrderUID, "error", err)
+			skipped++
+			continue
+		}
+		if err := dbStorage.SaveOrder(ctx, order); err != nil {
+			slog.Warn("Skipping order that failed to save", "index", i, "order_uid", order.OrderUID, "error", err)
+			skipped++
+			continue
+		}
+		imported++
+	}
+
+	slog.Info("Orders imported", "imported", imported, "skipped", skipped)
+	if imported == 0 && skipped > 0 {
+		return errors.New("no orders were imported")
+	}
+	return nil
+}
+
+// decodeOrders читает JSON-массив заказов либо последовательность объектов
+func decodeOrders(r *bufio.Reader) ([]model.Order, error) {
+	dec := json.NewDecoder(r)
+
+	first, err := peekNonSpace(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read orders: %w", err)
+	}
+	if first == '[' {
+		var orders []model.Order
+		if err := dec.Decode(&orders); err != nil {
+			return nil, fmt.Errorf("failed to decode orders: %w", err)
+		}
+		return orders, nil
+	}
+
+	var orders []model.Order
+	for {
+		var order model.Order
+		err := dec.Decode(&order)
+		if errors.Is(err, io.EOF) {
+			return orders, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode order #%d: %w", len(orders)+1, err)
+		}
+		orders = append(orders, order)
+	}
+}
+
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, r.UnreadByte()
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"test_task_wb/internal/config"
+	"test_task_wb/internal/storage"
+	"time"
+)
+
+// runRollups выполняет подкоманды работы с дневными агрегатами аналитики.
+// Использование: rollups backfill [-from YYYY-MM-DD] [-to YYYY-MM-DD]
+func runRollups(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "backfill" {
+		return errors.New("usage: rollups backfill [-from YYYY-MM-DD] [-to YYYY-MM-DD]")
+	}
+
+	fs := flag.NewFlagSet("rollups backfill", flag.ExitOnError)
+	from := fs.String("from", "", "first day to rebuild, inclusive (default: the whole history)")
+	to := fs.String("to", "", "last day to rebuild, exclusive (default: tomorrow)")
+	fs.Parse(args[1:])
+
+	// без границ пересчитывается вся история
+	var r storage.TimeRange
+	if *from != "" || *to != "" {
+		var err error
+		if r.From, err = parseDay(*from, time.Time{}); err != nil {
+			return fmt.Errorf("invalid -from: %w", err)
+		}
+		tomorrow := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+		if r.To, err = parseDay(*to, tomorrow); err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+
+	dbStorage, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer dbStorage.Close()
+
+	start := time.Now()
+	stats, err := dbStorage.RebuildRollups(ctx, r)
+	if err != nil {
+		return err
+	}
+	slog.Info("Rollups rebuilt", "from", *from, "to", *to, "duration", time.Since(start))
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(stats)
+}
+
+// parseDay разбирает дату YYYY-MM-DD как полночь UTC; пустая строка даёт def
+func parseDay(v string, def time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
@@ -5,42 +5,127 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"test_task_wb/internal/audit"
+	"test_task_wb/internal/auth"
 	"test_task_wb/internal/broker"
 	"test_task_wb/internal/cache"
 	"test_task_wb/internal/config"
+	"test_task_wb/internal/encryption"
+	"test_task_wb/internal/grpcserver"
+	"test_task_wb/internal/health"
+	"test_task_wb/internal/masking"
 	"test_task_wb/internal/metrics"
+	"test_task_wb/internal/orders"
 	"test_task_wb/internal/server"
 	"test_task_wb/internal/storage"
+	"test_task_wb/internal/tracing"
+	"test_task_wb/migrations"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"google.golang.org/grpc"
 )
 
 // основная структура нашего приложения, которая содержит все зависимости
 type App struct {
 	cfg           *config.Config
 	db            *storage.Storage
+	keyring       *encryption.Keyring
 	cache         cache.OrderCache
+	audit         *audit.Recorder
 	consumer      *broker.MessageConsumer
+	lagMonitor    *broker.LagMonitor
+	health        *health.Checker
+	limiter       *server.RateLimiter
+	cacheRestored atomic.Bool
+	feed          *orders.Feed
 	httpServer    *http.Server
+	grpcServer    *grpcserver.Server
 	metricsServer *http.Server
 	mainCtx       context.Context
 	mainCancel    context.CancelFunc
+	traceShutdown func(context.Context) error
 }
 
 // Создание и инициализация нового экземпляра App
-func New(ctx context.Context, cfg *config.Config) (*App, error) {
-	// 1. подключение к базе данных
-	dbPool, err := storage.NewDB(ctx, cfg.DatabaseURL)
+func New(ctx context.Context, cfg *config.Config) (_ *App, err error) {
+	// при ошибке инициализации уже захваченные ресурсы освобождаются в обратном порядке
+	var cleanups []func()
+	defer func() {
+		if err != nil {
+			for i := len(cleanups) - 1; i >= 0; i-- {
+				cleanups[i]()
+			}
+		}
+	}()
+
+	// 1. настройка трассировки, загрузка ключей шифрования персональных данных и подключение к базе данных
+	traceShutdown, err := tracing.Init(ctx, tracing.Options{
+		Exporter:     cfg.TracingExporter,
+		OTLPEndpoint: cfg.TracingOTLPEndpoint,
+		OTLPInsecure: cfg.TracingOTLPInsecure,
+		ServiceName:  cfg.TracingServiceName,
+		SampleRatio:  cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cleanups = append(cleanups, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := traceShutdown(shutdownCtx); err != nil {
+			slog.Error("Tracing shutdown error", "error", err)
+		}
+	})
+
+	keyring, err := encryption.Load(cfg.PIIKeyFile, cfg.PIIKeys, cfg.PIIActiveKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if keyring == nil {
+		slog.Warn("PII encryption keys are not configured, delivery data will be stored in plaintext")
+	} else {
+		slog.Info("PII encryption enabled", "active_key_id", keyring.ActiveKeyID(), "key_ids", keyring.KeyIDs())
+	}
+	blindIndex, err := encryption.LoadBlindIndex(cfg.PIISearchKey)
 	if err != nil {
 		return nil, err
 	}
-	dbStorage := storage.NewStorage(dbPool)
+	if keyring != nil && blindIndex == nil {
+		slog.Warn("PII search key is not configured, encrypted delivery data will not be searchable")
+	}
+
+	dbPool, err := storage.NewDB(ctx, cfg.DatabaseURL, storage.RetryBudget{
+		Total:       cfg.DBConnectTimeout,
+		Attempt:     cfg.DBAttemptTimeout,
+		MaxInterval: cfg.DBMaxRetryInterval,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cleanups = append(cleanups, dbPool.Close)
+
+	// схема проверяется до запуска консьюмера: новее бинарника, грязная или отстающая без разрешения - отказ от старта
+	migrateCtx, migrateCancel := context.WithTimeout(ctx, cfg.MigrateLockTimeout)
+	schema, err := migrations.EnsureSchema(migrateCtx, dbPool, cfg.DatabaseURL, migrations.SchemaPolicy{
+		Apply:        cfg.MigrateOnStart,
+		AllowPending: cfg.MigrateAllowPending,
+	})
+	migrateCancel()
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Database schema checked", "version", schema.Current, "latest", schema.Latest)
+
+	appMetrics := metrics.NewMetrics()
+	dbStorage := storage.NewStorage(dbPool, storage.WithKeyring(keyring), storage.WithBlindIndex(blindIndex), storage.WithMetrics(appMetrics))
 
 	// 2. инициализация кэша
 	shardCapacity := cfg.CacheCapacity / cfg.CacheNumShards
@@ -54,67 +139,175 @@ func New(ctx context.Context, cfg *config.Config) (*App, error) {
 		"capacity_per_shard", shardCapacity,
 	)
 
-	// 3. загрузка актуальных данных из БД в кэш
-	slog.Info("Restoring cache from DB...", "limit", cfg.CacheCapacity)
-	restoredOrders, err := dbStorage.GetAllOrders(ctx, cfg.CacheCapacity)
-	if err != nil {
-		slog.Error("Failed to restore cache from DB, continuing with empty cache", "error", err)
-	} else {
-		for _, order := range restoredOrders {
-			orderCache.Set(order.OrderUID, order)
-		}
-		slog.Info("Cache restored successfully", "items_loaded", len(restoredOrders))
+	// 3. инициализация остальных компонентов
+	if stats, ok := orderCache.(cache.ShardStats); ok {
+		appMetrics.RegisterCacheShards(stats.ShardLens)
 	}
-
-	// 4. инициализация остальных компонентов
-	appMetrics := metrics.NewMetrics()
 	validate := validator.New()
+	feed := orders.NewFeed()
 	consumer := broker.NewMessageConsumer(
-		cfg.KafkaBrokers,
+		broker.ReaderSettings{
+			Brokers:  cfg.KafkaBrokers,
+			Topic:    cfg.KafkaTopic,
+			GroupID:  cfg.KafkaGroupID,
+			MinBytes: cfg.KafkaMinBytes,
+			MaxBytes: cfg.KafkaMaxBytes,
+		},
 		dbStorage,
 		orderCache,
 		appMetrics,
 		validate,
+		broker.WithFeed(feed),
 	)
+	cleanups = append(cleanups, consumer.Close)
+	lagMonitor := broker.NewLagMonitor(consumer.Reader, appMetrics, cfg.KafkaLagSampleInterval,
+		int64(cfg.KafkaLagThreshold), cfg.KafkaLagMaxDuration, cfg.KafkaClientTimeout)
 
-	// 5. Настройка HTTP сервера
-	mainServer := server.NewServer(orderCache, appMetrics, dbStorage)
-	fs := http.FileServer(http.Dir("./web"))
+	// 4. Настройка проверок здоровья и HTTP сервера
+	maskingPolicy := masking.DefaultPolicy
+	if cfg.MaskingPolicyFile != "" {
+		maskingPolicy, err = masking.LoadPolicy(cfg.MaskingPolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Masking policy loaded", "file", cfg.MaskingPolicyFile, "default_role", maskingPolicy.DefaultRole)
+	}
+	authenticator, err := newAuthenticator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	auditRecorder := audit.NewRecorder(dbStorage, cfg.AuditBufferSize)
+	a := &App{
+		cfg:        cfg,
+		db:         dbStorage,
+		keyring:    keyring,
+		cache:      orderCache,
+		audit:      auditRecorder,
+		consumer:   consumer,
+		lagMonitor: lagMonitor,
+		feed:       feed,
+		health:     health.NewChecker(),
+		limiter:    server.NewRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst),
+	}
+	a.registerHealthChecks()
+	mainServer := server.NewServer(orderCache, appMetrics, dbStorage,
+		server.WithMaskingPolicy(maskingPolicy),
+		server.WithAuthenticator(authenticator),
+		server.WithAuditRecorder(auditRecorder),
+		server.WithLagMonitor(lagMonitor),
+		server.WithHealthChecks(a.health),
+		server.WithRateLimiter(a.limiter),
+		server.WithFeed(feed),
+	)
+	fs := http.FileServer(http.Dir(cfg.StaticDir))
 	mainServer.Router.Handle("/*", fs)
 	srv := &http.Server{
-		Addr:    cfg.HTTPPort,
-		Handler: mainServer.Router,
+		Addr:         cfg.HTTPAddr(),
+		Handler:      mainServer.Router,
+		ReadTimeout:  cfg.HTTPReadTimeout,
+		WriteTimeout: cfg.HTTPWriteTimeout,
+		IdleTimeout:  cfg.HTTPIdleTimeout,
 	}
 
-	// 6. Настраиваем сервер метрик
+	// gRPC API использует тот же сервис чтения заказов, что и HTTP
+	a.grpcServer = grpcserver.New(mainServer.Orders,
+		grpcserver.WithMaskingPolicy(maskingPolicy),
+		grpcserver.WithAuthenticator(authenticator),
+		grpcserver.WithFeed(feed),
+	)
+
+	// 5. Настраиваем сервер метрик
 	metricsMux := http.NewServeMux()
-	metricsMux.Handle("/metrics", metrics.Handler())
+	metricsMux.Handle("/metrics", appMetrics.Handler())
+	a.health.Register(metricsMux)
 	metricsSrv := &http.Server{
-		Addr:    cfg.MetricsPort,
+		Addr:    cfg.MetricsAddr(),
 		Handler: metricsMux,
 	}
 
-	// 7. Создаем основной контекст приложения
-	mainCtx, mainCancel := context.WithCancel(context.Background())
+	// 6. Создаем основной контекст приложения
+	a.mainCtx, a.mainCancel = context.WithCancel(context.Background())
+	a.httpServer = srv
+	a.metricsServer = metricsSrv
+	a.traceShutdown = traceShutdown
+
+	return a, nil
+}
+
+// newAuthenticator создает аутентификатор HTTP API. При выключенной аутентификации возвращает nil
+func newAuthenticator(cfg *config.Config) (*auth.Authenticator, error) {
+	if !cfg.AuthEnabled {
+		slog.Warn("HTTP API authentication is disabled, anonymous callers get read-only access")
+		return nil, nil
+	}
+
+	apiKeys, err := auth.ParseAPIKeys(cfg.AuthAPIKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks *auth.JWKS
+	if cfg.AuthJWKSFile != "" {
+		jwks, err = auth.LoadJWKS(cfg.AuthJWKSFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(apiKeys) == 0 && jwks == nil {
+		return nil, errors.New("authentication is enabled but neither API keys nor JWKS are configured")
+	}
 
-	return &App{
-		cfg:           cfg,
-		db:            dbStorage,
-		cache:         orderCache,
-		consumer:      consumer,
-		httpServer:    srv,
-		metricsServer: metricsSrv,
-		mainCtx:       mainCtx,
-		mainCancel:    mainCancel,
-	}, nil
+	slog.Info("HTTP API authentication enabled", "api_keys", len(apiKeys), "jwt", jwks != nil)
+	return auth.NewAuthenticator(apiKeys, jwks, cfg.AuthJWTIssuer, cfg.AuthJWTAudience), nil
+}
+
+// registerHealthChecks регистрирует проверки зависимостей для /healthz, /readyz и /startupz.
+// Живость зависит только от цикла консьюмера: его остановка не лечится без перезапуска
+func (a *App) registerHealthChecks() {
+	a.health.Add(health.Liveness, "kafka_consumer", a.consumerAlive)
+
+	a.health.Add(health.Startup, "cache", a.cacheRestoredCheck)
+
+	a.health.Add(health.Readiness, "postgres", a.db.Ping)
+	a.health.Add(health.Readiness, "cache", a.cacheRestoredCheck)
+	a.health.Add(health.Readiness, "kafka_consumer", a.consumerAlive)
+	a.health.Add(health.Readiness, "kafka_lag", func(context.Context) error {
+		if ready, reason := a.lagMonitor.Ready(); !ready {
+			return errors.New(reason)
+		}
+		return nil
+	})
+}
+
+func (a *App) cacheRestoredCheck(context.Context) error {
+	if !a.cacheRestored.Load() {
+		return errors.New("cache is not restored yet")
+	}
+	return nil
+}
+
+// consumerAlive проверяет цикл консьюмера. До восстановления кэша консьюмер ещё не запущен, и это не ошибка
+func (a *App) consumerAlive(context.Context) error {
+	if !a.cacheRestored.Load() {
+		return nil
+	}
+	return a.consumer.Alive()
 }
 
 // Запуск все долгоживущих процессов(серверы, консьюмеры)
 func (a *App) Run() {
 
+	go a.audit.Run()
 	go a.startMetricsServer()
 	go a.startHTTPServer()
-	go a.startKafkaConsumer()
+	go a.startGRPCServer()
+	go a.warmUpAndConsume()
+	go a.lagMonitor.Run(a.mainCtx)
+	go a.watchConfig()
+	if a.keyring != nil && a.cfg.PIIReencryptInterval > 0 {
+		go a.startReencryption()
+	}
 
 	slog.Info("Service is running. Press Ctrl+C to exit.")
 
@@ -134,7 +327,7 @@ func (a *App) Run() {
 
 // startMetricsServer запускает HTTP-сервер для эндпоинта /metrics
 func (a *App) startMetricsServer() {
-	slog.Info("Starting metrics server", "address", a.cfg.MetricsPort)
+	slog.Info("Starting metrics server", "address", a.cfg.MetricsAddr())
 	if err := a.metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		slog.Error("Failed to start metrics server", "error", err)
 		a.mainCancel()
@@ -143,13 +336,54 @@ func (a *App) startMetricsServer() {
 
 // startHTTPServer запускает основной HTTP-сервер приложения
 func (a *App) startHTTPServer() {
-	slog.Info("Starting HTTP server", "address", a.cfg.HTTPPort)
+	slog.Info("Starting HTTP server", "address", a.cfg.HTTPAddr())
 	if err := a.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		slog.Error("Failed to start HTTP server", "error", err)
 		a.mainCancel()
 	}
 }
 
+// startGRPCServer запускает gRPC-сервер
+func (a *App) startGRPCServer() {
+	slog.Info("Starting gRPC server", "address", a.cfg.GRPCAddr())
+	lis, err := net.Listen("tcp", a.cfg.GRPCAddr())
+	if err != nil {
+		slog.Error("Failed to start gRPC server", "error", err)
+		a.mainCancel()
+		return
+	}
+	if err := a.grpcServer.GRPC.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		slog.Error("gRPC server stopped with error", "error", err)
+		a.mainCancel()
+	}
+}
+
+// warmUpAndConsume восстанавливает кэш из БД и только затем запускает консьюмер,
+// чтобы свежие сообщения не перезаписывались устаревшими данными из БД
+func (a *App) warmUpAndConsume() {
+	a.restoreCache()
+	a.cacheRestored.Store(true)
+	a.grpcServer.SetServing(true)
+
+	if a.mainCtx.Err() == nil {
+		a.startKafkaConsumer()
+	}
+}
+
+// restoreCache загружает актуальные данные из БД в кэш
+func (a *App) restoreCache() {
+	slog.Info("Restoring cache from DB...", "limit", a.cfg.CacheCapacity)
+	restoredOrders, err := a.db.GetAllOrders(a.mainCtx, a.cfg.CacheCapacity)
+	if err != nil {
+		slog.Error("Failed to restore cache from DB, continuing with empty cache", "error", err)
+		return
+	}
+	for _, order := range restoredOrders {
+		a.cache.Set(order.OrderUID, order)
+	}
+	slog.Info("Cache restored successfully", "items_loaded", len(restoredOrders))
+}
+
 // startKafkaConsumer запускает главный цикл консьюмера
 func (a *App) startKafkaConsumer() {
 	slog.Info("Starting Kafka consumer loop...")
@@ -157,13 +391,64 @@ func (a *App) startKafkaConsumer() {
 	slog.Info("Kafka consumer loop stopped.")
 }
 
+// startReencryption периодически перешифровывает строки доставки активным ключом,
+// чтобы после ротации старые ключи можно было вывести из использования
+func (a *App) startReencryption() {
+	slog.Info("Starting PII re-encryption job", "interval", a.cfg.PIIReencryptInterval, "batch", a.cfg.PIIReencryptBatch)
+	ticker := time.NewTicker(a.cfg.PIIReencryptInterval)
+	defer ticker.Stop()
+
+	for {
+		// каждый проход идёт по id с начала: строки, которые не удалось расшифровать, не мешают следующим
+		total, failed, lastID := 0, 0, 0
+		for {
+			res, err := a.db.ReencryptDeliveries(a.mainCtx, lastID, a.cfg.PIIReencryptBatch)
+			if err != nil {
+				if a.mainCtx.Err() == nil {
+					slog.Error("Failed to re-encrypt delivery rows", "error", err)
+				}
+				break
+			}
+			total += res.Updated
+			failed += res.Failed
+			lastID = res.LastID
+			if res.Selected < a.cfg.PIIReencryptBatch {
+				break
+			}
+		}
+		if total > 0 {
+			slog.Info("Re-encrypted delivery rows", "rows", total, "active_key_id", a.keyring.ActiveKeyID())
+		}
+		if failed > 0 {
+			slog.Warn("Some delivery rows could not be decrypted and were left as is", "rows", failed, "key_ids", a.keyring.KeyIDs())
+		}
+
+		select {
+		case <-a.mainCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 // Shutdown останавливает все компоненты приложения
 func (a *App) Shutdown() {
+	// сначала снимаем готовность и даём балансировщику время перестать слать трафик
+	a.health.SetDraining()
+	a.grpcServer.SetServing(false)
+	if a.cfg.ShutdownDrainDelay > 0 {
+		slog.Info("Draining before shutdown", "delay", a.cfg.ShutdownDrainDelay)
+		time.Sleep(a.cfg.ShutdownDrainDelay)
+	}
+
 	a.mainCancel()
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
 	defer cancel()
 
+	// закрытие ленты завершает живые стримы HTTP и WatchOrders, иначе остановка серверов ждала бы их до таймаута
+	a.feed.Close()
+
 	var wg sync.WaitGroup
 	wg.Add(4)
 
@@ -176,20 +461,38 @@ func (a *App) Shutdown() {
 
 	go func() {
 		defer wg.Done()
-		if err := a.metricsServer.Shutdown(shutdownCtx); err != nil {
-			slog.Error("Metrics server shutdown error", "error", err)
+		stopped := make(chan struct{})
+		go func() {
+			a.grpcServer.GRPC.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			slog.Error("gRPC server shutdown timed out, closing remaining connections")
+			a.grpcServer.GRPC.Stop()
 		}
 	}()
 
 	go func() {
 		defer wg.Done()
-		a.consumer.Close()
+		if err := a.metricsServer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Metrics server shutdown error", "error", err)
+		}
 	}()
 
 	go func() {
 		defer wg.Done()
-		a.db.Close()
+		a.consumer.Close()
 	}()
 
 	wg.Wait()
+
+	// журнал аудита и БД закрываются последними, когда HTTP-запросы уже завершены
+	a.audit.Close()
+	a.db.Close()
+
+	if err := a.traceShutdown(shutdownCtx); err != nil {
+		slog.Error("Tracing shutdown error", "error", err)
+	}
 }
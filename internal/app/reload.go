@@ -0,0 +1,103 @@
+package app
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"test_task_wb/internal/cache"
+	"test_task_wb/internal/config"
+	"test_task_wb/internal/logger"
+	"time"
+)
+
+// watchConfig перечитывает конфигурацию по SIGHUP и при изменении файла конфигурации.
+// На лету применяются только безопасные настройки, остальные изменения требуют перезапуска
+func (a *App) watchConfig() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var poll <-chan time.Time
+	if a.cfg.ConfigFile != "" && a.cfg.ConfigWatchInterval > 0 {
+		ticker := time.NewTicker(a.cfg.ConfigWatchInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	current := a.cfg
+	lastMod := fileModTime(a.cfg.ConfigFile)
+
+	for {
+		select {
+		case <-a.mainCtx.Done():
+			return
+		case <-hup:
+			slog.Info("Received SIGHUP, reloading configuration")
+		case <-poll:
+			mod := fileModTime(a.cfg.ConfigFile)
+			if mod.Equal(lastMod) {
+				continue
+			}
+			lastMod = mod
+			slog.Info("Config file changed, reloading configuration", "file", a.cfg.ConfigFile)
+		}
+
+		updated, err := current.Reload()
+		if err != nil {
+			slog.Error("Failed to reload configuration, keeping current settings", "error", err)
+			continue
+		}
+		current = a.applyConfig(current, updated)
+	}
+}
+
+// applyConfig применяет изменившиеся настройки и логирует разницу.
+// Возвращает действующую конфигурацию - current с применёнными перезагружаемыми настройками,
+// относительно которой считается следующая разница
+func (a *App) applyConfig(current, updated *config.Config) *config.Config {
+	changes := config.Diff(current, updated)
+	if len(changes) == 0 {
+		slog.Info("Configuration reloaded, nothing changed")
+		return current
+	}
+
+	limitsChanged := false
+	for _, ch := range changes {
+		if !ch.Reloadable {
+			slog.Warn("Config setting changed but requires a restart to take effect", "key", ch.Key, "old", ch.Old, "new", ch.New)
+			continue
+		}
+		slog.Info("Config setting changed", "key", ch.Key, "old", ch.Old, "new", ch.New)
+
+		switch ch.Key {
+		case "log_level":
+			if err := logger.SetLevel(updated.LogLevel); err != nil {
+				slog.Error("Failed to apply log level", "error", err)
+			}
+		case "cache_capacity":
+			if resizable, ok := a.cache.(cache.Resizable); ok {
+				evicted := resizable.Resize(updated.CacheCapacity)
+				slog.Info("Cache resized", "capacity", updated.CacheCapacity, "evicted", evicted)
+			}
+		case "rate_limit_rps", "rate_limit_burst":
+			limitsChanged = true
+		}
+	}
+	if limitsChanged {
+		a.limiter.SetLimits(updated.RateLimitRPS, updated.RateLimitBurst)
+	}
+
+	return config.ApplyReloadable(current, updated)
+}
+
+func fileModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	flushInterval = time.Second
+	maxBatchSize  = 100
+)
+
+// Entry - запись журнала аудита о том, кто и к каким данным обращался
+type Entry struct {
+	Principal  string
+	AuthMethod string
+	Action     string
+	Target     string
+	Status     int
+	At         time.Time
+}
+
+// Sink сохраняет пачку записей аудита
+type Sink interface {
+	SaveAccessLog(ctx context.Context, entries []Entry) error
+}
+
+// Recorder асинхронно накапливает записи аудита и сохраняет их пачками,
+// чтобы запись журнала не добавляла задержку к каждому запросу
+type Recorder struct {
+	sink    Sink
+	entries chan Entry
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewRecorder создает журнал аудита с буфером на bufferSize записей
+func NewRecorder(sink Sink, bufferSize int) *Recorder {
+	return &Recorder{
+		sink:    sink,
+		entries: make(chan Entry, bufferSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Record ставит запись в очередь. Если буфер переполнен, запись отбрасывается с предупреждением
+func (r *Recorder) Record(e Entry) {
+	if r == nil {
+		return
+	}
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+
+	select {
+	case r.entries <- e:
+	default:
+		slog.Warn("Audit buffer is full, access record dropped", "principal", e.Principal, "action", e.Action, "target", e.Target)
+	}
+}
+
+// Run сохраняет записи пачками до вызова Close
+func (r *Recorder) Run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Entry, 0, maxBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := r.sink.SaveAccessLog(ctx, batch); err != nil {
+			slog.Error("Failed to save audit records", "error", err, "records", len(batch))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case e := <-r.entries:
+			batch = append(batch, e)
+			if len(batch) >= maxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-r.stop:
+			for len(r.entries) > 0 {
+				batch = append(batch, <-r.entries)
+			}
+			flush()
+			return
+		}
+	}
+}
+
+// Close останавливает Run и дожидается сохранения оставшихся записей
+func (r *Recorder) Close() {
+	if r == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+}
@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoCredentials      = errors.New("no credentials provided")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// APIKey - статический ключ API. В конфигурации хранится только SHA-256 хэш ключа
+type APIKey struct {
+	Name   string
+	Role   string
+	Scopes []string
+	Hash   string
+}
+
+// ParseAPIKeys разбирает список ключей вида "name:role:scope1|scope2:sha256hex", разделённых запятыми.
+// Области доступа сами содержат двоеточие, поэтому хэш берётся из последнего поля
+func ParseAPIKeys(s string) ([]APIKey, error) {
+	var keys []APIKey
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) < 4 {
+			return nil, fmt.Errorf("malformed API key entry %q, expected name:role:scopes:sha256", parts[0])
+		}
+		hash := strings.ToLower(parts[len(parts)-1])
+		if raw, err := hex.DecodeString(hash); err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("API key %q: hash must be a hex-encoded SHA-256 digest", parts[0])
+		}
+
+		keys = append(keys, APIKey{
+			Name:   parts[0],
+			Role:   parts[1],
+			Scopes: strings.Split(strings.Join(parts[2:len(parts)-1], ":"), "|"),
+			Hash:   hash,
+		})
+	}
+	return keys, nil
+}
+
+// HashAPIKey возвращает хэш ключа в том виде, в котором он хранится в конфигурации
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticator проверяет статические ключи API и JWT, подписанные ключами из JWKS
+type Authenticator struct {
+	apiKeys map[string]APIKey
+	jwks    *JWKS
+	parser  *jwt.Parser
+}
+
+// NewAuthenticator создает аутентификатор. jwks может быть nil, тогда JWT не принимаются.
+// Пустые issuer и audience не проверяются
+func NewAuthenticator(keys []APIKey, jwks *JWKS, issuer, audience string) *Authenticator {
+	a := &Authenticator{
+		apiKeys: make(map[string]APIKey, len(keys)),
+		jwks:    jwks,
+	}
+	for _, k := range keys {
+		a.apiKeys[k.Hash] = k
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithExpirationRequired(),
+	}
+	if issuer != "" {
+		opts = append(opts, jwt.WithIssuer(issuer))
+	}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+	a.parser = jwt.NewParser(opts...)
+
+	return a
+}
+
+// Authenticate определяет вызывающего по заголовку Authorization (Bearer) или X-API-Key
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	return a.AuthenticateCredentials(r.Header.Get("X-API-Key"), r.Header.Get("Authorization"))
+}
+
+// AuthenticateCredentials определяет вызывающего по значениям X-API-Key и Authorization,
+// откуда бы они ни пришли: из HTTP-заголовков или метаданных gRPC
+func (a *Authenticator) AuthenticateCredentials(apiKey, authorization string) (*Principal, error) {
+	if apiKey != "" {
+		return a.authenticateAPIKey(apiKey)
+	}
+
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return nil, ErrNoCredentials
+	}
+	if strings.Count(token, ".") == 2 {
+		return a.authenticateJWT(token)
+	}
+	return a.authenticateAPIKey(token)
+}
+
+func (a *Authenticator) authenticateAPIKey(key string) (*Principal, error) {
+	k, ok := a.apiKeys[HashAPIKey(key)]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Name: k.Name, Method: MethodAPIKey, Role: k.Role, Scopes: k.Scopes}, nil
+}
+
+// tokenClaims - поддерживаются как строка scope (RFC 8693), так и массив scp
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Scope string   `json:"scope"`
+	Scp   []string `json:"scp"`
+	Role  string   `json:"role"`
+}
+
+func (a *Authenticator) authenticateJWT(token string) (*Principal, error) {
+	if a.jwks == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	var claims tokenClaims
+	_, err := a.parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := a.jwks.Key(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	scopes := claims.Scp
+	if claims.Scope != "" {
+		scopes = append(scopes, strings.Fields(claims.Scope)...)
+	}
+	return &Principal{Name: claims.Subject, Method: MethodJWT, Role: claims.Role, Scopes: scopes}, nil
+}
+
+// Middleware аутентифицирует запрос и кладёт вызывающего в контекст.
+// Если a == nil, аутентификация выключена: вызывающий анонимен и может только читать (см. Anonymous)
+func Middleware(a *Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if a == nil {
+				next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), Anonymous())))
+				return
+			}
+
+			p, err := a.Authenticate(r)
+			if err != nil {
+				slog.Warn("Authentication failed", "error", err, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="order-service"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// RequireScope пропускает запрос, только если у вызывающего есть область доступа scope
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := FromContext(r.Context())
+			if !p.HasScope(scope) {
+				slog.Warn("Access denied", "principal", p.Name, "required_scope", scope, "path", r.URL.Path)
+				http.Error(w, "Forbidden: missing scope "+scope, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
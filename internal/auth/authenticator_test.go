@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestJWKS создает RSA-ключ и JWKS с его публичной частью
+func newTestJWKS(t *testing.T, kid string) (*rsa.PrivateKey, *JWKS) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	set := map[string]any{"keys": []map[string]string{{
+		"kid": kid,
+		"kty": "RSA",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	jwks, err := ParseJWKS(data)
+	require.NoError(t, err)
+	return key, jwks
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestAuthenticator(t *testing.T) {
+	keys, err := ParseAPIKeys("warehouse-bot:warehouse:orders:read|pii:" + HashAPIKey("secret-key"))
+	require.NoError(t, err)
+
+	privateKey, jwks := newTestJWKS(t, "kid1")
+	a := NewAuthenticator(keys, jwks, "issuer", "")
+
+	authenticate := func(header, value string) (*Principal, error) {
+		req := httptest.NewRequest(http.MethodGet, "/order/1", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		return a.Authenticate(req)
+	}
+
+	t.Run("API key", func(t *testing.T) {
+		p, err := authenticate("X-API-Key", "secret-key")
+		require.NoError(t, err)
+		require.Equal(t, "warehouse-bot", p.Name)
+		require.Equal(t, "warehouse", p.Role)
+		require.True(t, p.HasScope(ScopeRead))
+		require.True(t, p.HasScope(ScopePII))
+		require.False(t, p.HasScope(ScopeAdmin))
+
+		p, err = authenticate("Authorization", "Bearer secret-key")
+		require.NoError(t, err, "Ключ API должен приниматься и как Bearer-токен")
+		require.Equal(t, MethodAPIKey, p.Method)
+
+		_, err = authenticate("X-API-Key", "wrong-key")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("JWT", func(t *testing.T) {
+		token := signToken(t, privateKey, "kid1", jwt.MapClaims{
+			"sub":   "alice",
+			"iss":   "issuer",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": "orders:read admin",
+			"role":  "support",
+		})
+
+		p, err := authenticate("Authorization", "Bearer "+token)
+		require.NoError(t, err)
+		require.Equal(t, "alice", p.Name)
+		require.Equal(t, MethodJWT, p.Method)
+		require.Equal(t, "support", p.Role)
+		require.True(t, p.HasScope(ScopeAdmin))
+	})
+
+	t.Run("Rejected JWT", func(t *testing.T) {
+		expired := signToken(t, privateKey, "kid1", jwt.MapClaims{
+			"sub": "alice", "iss": "issuer", "exp": time.Now().Add(-time.Hour).Unix(),
+		})
+		_, err := authenticate("Authorization", "Bearer "+expired)
+		require.ErrorIs(t, err, ErrInvalidCredentials, "Просроченный токен должен отклоняться")
+
+		wrongIssuer := signToken(t, privateKey, "kid1", jwt.MapClaims{
+			"sub": "alice", "iss": "other", "exp": time.Now().Add(time.Hour).Unix(),
+		})
+		_, err = authenticate("Authorization", "Bearer "+wrongIssuer)
+		require.ErrorIs(t, err, ErrInvalidCredentials, "Токен чужого издателя должен отклоняться")
+
+		unknownKid := signToken(t, privateKey, "kid2", jwt.MapClaims{
+			"sub": "alice", "iss": "issuer", "exp": time.Now().Add(time.Hour).Unix(),
+		})
+		_, err = authenticate("Authorization", "Bearer "+unknownKid)
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("No credentials", func(t *testing.T) {
+		_, err := authenticate("", "")
+		require.ErrorIs(t, err, ErrNoCredentials)
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	keys, err := ParseAPIKeys("reader:analytics:orders:read:" + HashAPIKey("reader-key"))
+	require.NoError(t, err)
+	a := NewAuthenticator(keys, nil, "", "")
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(h http.Handler, key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	readHandler := Middleware(a)(RequireScope(ScopeRead)(ok))
+	adminHandler := Middleware(a)(RequireScope(ScopeAdmin)(ok))
+
+	require.Equal(t, http.StatusUnauthorized, serve(readHandler, ""))
+	require.Equal(t, http.StatusOK, serve(readHandler, "reader-key"))
+	require.Equal(t, http.StatusForbidden, serve(adminHandler, "reader-key"))
+
+	require.Equal(t, http.StatusOK, serve(Middleware(nil)(RequireScope(ScopeRead)(ok)), ""), "При выключенной аутентификации чтение открыто")
+	for _, scope := range []string{ScopeWrite, ScopeAdmin, ScopePII} {
+		disabled := Middleware(nil)(RequireScope(scope)(ok))
+		require.Equal(t, http.StatusForbidden, serve(disabled, ""), "Без аутентификации область %s не выдаётся", scope)
+	}
+}
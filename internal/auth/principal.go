@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// Области доступа (scopes), которыми ограничиваются маршруты API
+const (
+	ScopeRead  = "orders:read"
+	ScopeWrite = "orders:write"
+	ScopeAdmin = "admin"
+	ScopePII   = "pii"
+	// ScopeAnalytics даёт доступ к агрегированным отчётам без доступа к отдельным заказам
+	ScopeAnalytics = "analytics"
+)
+
+// Способы аутентификации
+const (
+	MethodAPIKey    = "api_key"
+	MethodJWT       = "jwt"
+	MethodAnonymous = "anonymous"
+)
+
+// Principal - аутентифицированный вызывающий
+type Principal struct {
+	Name   string   `json:"name"`
+	Method string   `json:"method"`
+	Role   string   `json:"role"`
+	Scopes []string `json:"scopes"`
+}
+
+// HasScope проверяет, выдана ли вызывающему область доступа
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// Anonymous возвращает анонимного вызывающего для режима без аутентификации.
+// Он может только читать заказы и отчёты: изменение, удаление и администрирование без подтверждённой
+// личности закрыты, а ответы маскируются ролью по умолчанию, так как области pii у него нет
+func Anonymous() *Principal {
+	return &Principal{
+		Name:   "anonymous",
+		Method: MethodAnonymous,
+		Scopes: []string{ScopeRead, ScopeAnalytics},
+	}
+}
+
+type principalKey struct{}
+
+// WithPrincipal сохраняет вызывающего в контексте запроса
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext возвращает вызывающего из контекста или анонимного без прав
+func FromContext(ctx context.Context) *Principal {
+	if p, ok := ctx.Value(principalKey{}).(*Principal); ok {
+		return p
+	}
+	return &Principal{Name: "anonymous", Method: MethodAnonymous}
+}
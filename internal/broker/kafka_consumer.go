@@ -5,16 +5,38 @@ import (
 	"encoding/json"
 	"errors"
 	"log/slog"
+	"sync/atomic"
 	"test_task_wb/internal/cache"
 	"test_task_wb/internal/metrics"
 	"test_task_wb/internal/model"
+	"test_task_wb/internal/orders"
 	"test_task_wb/internal/storage"
+	"test_task_wb/internal/tracing"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	// HeaderEventType - заголовок Kafka-сообщения с типом события
+	HeaderEventType = "event-type"
+	// EventOrderCancelled - событие отмены заказа (мягкое удаление)
+	EventOrderCancelled = "order.cancelled"
+)
+
+var tracer = otel.Tracer("test_task_wb/internal/broker")
+
+// cancellationMessage - тело сообщения об отмене заказа
+type cancellationMessage struct {
+	OrderUID string `json:"order_uid"`
+}
+
 // MessageConsumer содержит зависимости для обработки сообщений
 type MessageConsumer struct {
 	Reader    *kafka.Reader
@@ -22,32 +44,60 @@ type MessageConsumer struct {
 	cache     cache.OrderCache
 	metrics   *metrics.Metrics
 	validator *validator.Validate
+	feed      *orders.Feed
+
+	// running выставлен, пока работает цикл чтения сообщений
+	running atomic.Bool
+}
+
+// ReaderSettings - параметры подключения консьюмера к Kafka
+type ReaderSettings struct {
+	Brokers  []string
+	Topic    string
+	GroupID  string
+	MinBytes int
+	MaxBytes int
+}
+
+// ConsumerOption настраивает дополнительные возможности MessageConsumer
+type ConsumerOption func(*MessageConsumer)
+
+// WithFeed включает публикацию применённых изменений заказов в ленту событий
+func WithFeed(f *orders.Feed) ConsumerOption {
+	return func(mc *MessageConsumer) {
+		mc.feed = f
+	}
 }
 
 // NewMessageConsumer создает новый экземпляр консьюмера со всеми зависимостями
 func NewMessageConsumer(
-	brokers []string,
+	settings ReaderSettings,
 	db *storage.Storage,
 	cache cache.OrderCache,
 	metrics *metrics.Metrics,
 	validator *validator.Validate,
+	opts ...ConsumerOption,
 ) *MessageConsumer {
 	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        brokers,
-		Topic:          "orders",
-		GroupID:        "order-service-group",
-		MinBytes:       10e3, // 10KB
-		MaxBytes:       10e6, // 10MB
+		Brokers:        settings.Brokers,
+		Topic:          settings.Topic,
+		GroupID:        settings.GroupID,
+		MinBytes:       settings.MinBytes,
+		MaxBytes:       settings.MaxBytes,
 		CommitInterval: 0,
 	})
 
-	return &MessageConsumer{
+	mc := &MessageConsumer{
 		Reader:    r,
 		db:        db,
 		cache:     cache,
 		metrics:   metrics,
 		validator: validator,
 	}
+	for _, opt := range opts {
+		opt(mc)
+	}
+	return mc
 }
 
 // StartConsuming запускает главный цикл чтения и обработки сообщений из Kafka.
@@ -55,6 +105,9 @@ func NewMessageConsumer(
 // чтобы инициировать остановку всего сервиса.
 func (mc *MessageConsumer) StartConsuming(ctx context.Context, onCriticalError context.CancelFunc) {
 	slog.Info("Kafka consumer connected and started consuming messages")
+	mc.running.Store(true)
+	defer mc.running.Store(false)
+
 	for {
 		msg, err := mc.Reader.ReadMessage(ctx) //ожидаем сообщения из kafka
 		if err != nil {
@@ -68,57 +121,206 @@ func (mc *MessageConsumer) StartConsuming(ctx context.Context, onCriticalError c
 
 		mc.metrics.MessagesConsumed.Inc()
 
-		//логируем некорректные сообщения и коммитим в kafka что получили сообщение
-		var order model.Order
-		if err := json.Unmarshal(msg.Value, &order); err != nil {
-			slog.Warn("Failed to unmarshal message. Message ignored.", "error", err)
-			if err := mc.Reader.CommitMessages(ctx, msg); err != nil {
-				slog.Error("Failed to commit unmarshallable kafka message", "error", err)
-			}
-			continue
+		start := time.Now()
+		if err := mc.processMessage(ctx, msg); err != nil {
+			onCriticalError()
+			break
+		}
+		mc.metrics.MessageProcessingDuration.Observe(time.Since(start).Seconds())
+		mc.metrics.LastMessageProcessed.SetToCurrentTime()
+	}
+}
+
+// Alive сообщает, работает ли цикл чтения сообщений
+func (mc *MessageConsumer) Alive() error {
+	if !mc.running.Load() {
+		return errors.New("kafka consumer loop is not running")
+	}
+	return nil
+}
+
+// processMessage обрабатывает одно сообщение в отдельном спане, продолжая трейс продюсера
+// из заголовков сообщения. Ошибка возвращается только при неустранимом сбое
+func (mc *MessageConsumer) processMessage(ctx context.Context, msg kafka.Message) (err error) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, tracing.KafkaHeaders{Headers: &msg.Headers})
+	ctx, span := tracer.Start(ctx, msg.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", msg.Topic),
+			attribute.Int("messaging.kafka.destination.partition", msg.Partition),
+			attribute.Int64("messaging.kafka.message.offset", msg.Offset),
+			attribute.String("messaging.kafka.message.key", string(msg.Key)),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	//tombstone (пустое значение) удаляет заказ, событие отмены помечает его удалённым
+	if isTombstone(msg) || eventType(msg) == EventOrderCancelled {
+		if err := mc.handleRemoval(ctx, msg); err != nil {
+			mc.metrics.DBErrors.Inc()
+			slog.Error("CRITICAL: Failed to remove order from DB. Shutting down to prevent message loss.", "error", err)
+			return err
+		}
+		if err := mc.commit(ctx, msg); err != nil {
+			slog.Error("CRITICAL: Failed to commit kafka removal message. Shutting down.", "error", err)
+			return err
+		}
+		return nil
+	}
+
+	//логируем некорректные сообщения и коммитим в kafka что получили сообщение
+	var order model.Order
+	_, unmarshalSpan := tracer.Start(ctx, "unmarshal")
+	err = json.Unmarshal(msg.Value, &order)
+	endSpan(unmarshalSpan, err)
+	if err != nil {
+		slog.Warn("Failed to unmarshal message. Message ignored.", "error", err)
+		if err := mc.commit(ctx, msg); err != nil {
+			slog.Error("Failed to commit unmarshallable kafka message", "error", err)
+		}
+		return nil
+	}
+	span.SetAttributes(attribute.String("order.uid", order.OrderUID))
+
+	_, validateSpan := tracer.Start(ctx, "validate")
+	err = mc.validator.Struct(order)
+	endSpan(validateSpan, err)
+	if err != nil {
+		mc.metrics.ValidationErrors.Inc()
+		slog.Warn("Invalid data received. Message ignored.", "error", err.Error(), "order_uid", order.OrderUID)
+		// Сообщение невалидно, коммитим его, чтобы не обрабатывать повторно
+		if err := mc.commit(ctx, msg); err != nil {
+			slog.Error("Failed to commit invalid kafka message", "error", err)
 		}
+		return nil
+	}
 
-		if err = mc.validator.Struct(order); err != nil {
+	saveCtx, saveSpan := tracer.Start(ctx, "SaveOrder")
+	err = mc.db.SaveOrder(saveCtx, order)
+	endSpan(saveSpan, err)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		// Проверяем, является ли ошибка ошибкой PostgreSQL с кодом "unique_violation" (23505)
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			// Это дубликат, логируем как Warn
+			slog.Warn("Duplicate order received. Message ignored.", "order_uid", order.OrderUID)
 			mc.metrics.ValidationErrors.Inc()
-			slog.Warn("Invalid data received. Message ignored.", "error", err.Error(), "order_uid", order.OrderUID)
-			// Сообщение невалидно, коммитим его, чтобы не обрабатывать повторно
-			if err := mc.Reader.CommitMessages(ctx, msg); err != nil {
-				slog.Error("Failed to commit invalid kafka message", "error", err)
+
+			if err := mc.commit(ctx, msg); err != nil {
+				slog.Error("Failed to commit duplicate kafka message", "error", err)
+				return err
 			}
-			continue
+			return nil
 		}
 
-		if err = mc.db.SaveOrder(ctx, order); err != nil {
-			var pgErr *pgconn.PgError
-			// Проверяем, является ли ошибка ошибкой PostgreSQL с кодом "unique_violation" (23505)
-			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-				// Это дубликат, логируем как Warn
-				slog.Warn("Duplicate order received. Message ignored.", "order_uid", order.OrderUID)
-				mc.metrics.ValidationErrors.Inc()
-
-				if err := mc.Reader.CommitMessages(ctx, msg); err != nil {
-					slog.Error("Failed to commit duplicate kafka message", "error", err)
-					onCriticalError()
-					break
-				}
-				continue
-			}
+		mc.metrics.DBErrors.Inc()
+		slog.Error("CRITICAL: Failed to save order to DB. Shutting down to prevent message loss.", "order_uid", order.OrderUID, "error", err)
+		return err
+	}
 
-			mc.metrics.DBErrors.Inc()
-			slog.Error("CRITICAL: Failed to save order to DB. Shutting down to prevent message loss.", "order_uid", order.OrderUID, "error", err)
-			onCriticalError()
-			break
+	_, cacheSpan := tracer.Start(ctx, "cache set")
+	mc.cache.Set(order.OrderUID, order)
+	cacheSpan.End()
+	mc.publish(orders.Event{Type: orders.EventCreated, OrderUID: order.OrderUID, Order: &order})
+	slog.Info("Successfully saved and cached order", "order_uid", order.OrderUID)
+
+	if err := mc.commit(ctx, msg); err != nil {
+		slog.Error("CRITICAL: Failed to commit kafka message after processing. Shutting down.", "error", err)
+		return err
+	}
+	return nil
+}
+
+// commit подтверждает обработку сообщения в отдельном спане
+func (mc *MessageConsumer) commit(ctx context.Context, msg kafka.Message) error {
+	ctx, span := tracer.Start(ctx, "commit")
+	err := mc.Reader.CommitMessages(ctx, msg)
+	endSpan(span, err)
+	return err
+}
+
+// endSpan завершает спан, отмечая ошибку, если она есть
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// handleRemoval обрабатывает tombstone (жёсткое удаление) или событие отмены (мягкое удаление)
+// и вычищает заказ из кэша. Ошибка возвращается только если сообщение нельзя коммитить
+func (mc *MessageConsumer) handleRemoval(ctx context.Context, msg kafka.Message) error {
+	hard := isTombstone(msg)
+
+	orderUID := string(msg.Key)
+	if !hard {
+		var cm cancellationMessage
+		if err := json.Unmarshal(msg.Value, &cm); err != nil {
+			slog.Warn("Failed to unmarshal cancellation message. Message ignored.", "error", err)
+			return nil
+		}
+		if cm.OrderUID != "" {
+			orderUID = cm.OrderUID
 		}
+	}
+	if orderUID == "" {
+		slog.Warn("Removal message without order UID. Message ignored.", "hard", hard)
+		return nil
+	}
 
-		mc.cache.Set(order.OrderUID, order)
-		slog.Info("Successfully saved and cached order", "order_uid", order.OrderUID)
+	var err error
+	if hard {
+		err = mc.db.DeleteOrder(ctx, orderUID)
+	} else {
+		err = mc.db.CancelOrder(ctx, orderUID)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrOrderNotFound) {
+			slog.Warn("Removal requested for unknown order. Message ignored.", "order_uid", orderUID, "hard", hard)
+			mc.cache.Delete(orderUID)
+			return nil
+		}
+		return err
+	}
 
-		if err := mc.Reader.CommitMessages(ctx, msg); err != nil {
-			slog.Error("CRITICAL: Failed to commit kafka message after processing. Shutting down.", "error", err)
-			onCriticalError()
-			break
+	mc.cache.Delete(orderUID)
+	if hard {
+		mc.publish(orders.Event{Type: orders.EventDeleted, OrderUID: orderUID})
+	} else {
+		mc.publish(orders.Event{Type: orders.EventCancelled, OrderUID: orderUID})
+	}
+	slog.Info("Successfully removed order", "order_uid", orderUID, "hard", hard)
+	return nil
+}
+
+// publish отправляет событие в ленту, если она подключена
+func (mc *MessageConsumer) publish(e orders.Event) {
+	if mc.feed != nil {
+		mc.feed.Publish(e)
+	}
+}
+
+// isTombstone сообщает, является ли сообщение tombstone-записью (ключ без значения)
+func isTombstone(msg kafka.Message) bool {
+	return len(msg.Value) == 0 && len(msg.Key) > 0
+}
+
+// eventType возвращает тип события из заголовков сообщения
+func eventType(msg kafka.Message) string {
+	for _, h := range msg.Headers {
+		if h.Key == HeaderEventType {
+			return string(h.Value)
 		}
 	}
+	return ""
 }
 
 // Close закрывает соединение с Kafka
@@ -0,0 +1,301 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"test_task_wb/internal/metrics"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// PartitionLag - состояние одной партиции топика для группы консьюмеров
+type PartitionLag struct {
+	Partition       int    `json:"partition"`
+	LogStartOffset  int64  `json:"log_start_offset"`
+	HighWaterMark   int64  `json:"high_water_mark"`
+	CommittedOffset int64  `json:"committed_offset"`
+	Lag             int64  `json:"lag"`
+	AssignedTo      string `json:"assigned_to,omitempty"`
+}
+
+// ReaderStats - счётчики Kafka-ридера, накопленные с момента запуска
+type ReaderStats struct {
+	Lag        int64 `json:"lag"`
+	Messages   int64 `json:"messages"`
+	Errors     int64 `json:"errors"`
+	Timeouts   int64 `json:"timeouts"`
+	Rebalances int64 `json:"rebalances"`
+}
+
+// LagSnapshot - последний снятый срез состояния консьюмера
+type LagSnapshot struct {
+	Topic        string         `json:"topic"`
+	GroupID      string         `json:"group_id"`
+	GroupState   string         `json:"group_state"`
+	SampledAt    time.Time      `json:"sampled_at"`
+	TotalLag     int64          `json:"total_lag"`
+	Partitions   []PartitionLag `json:"partitions"`
+	Reader       ReaderStats    `json:"reader"`
+	LaggingSince *time.Time     `json:"lagging_since,omitempty"`
+	Ready        bool           `json:"ready"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// LagMonitor периодически снимает статистику ридера, high-water mark и закоммиченные
+// оффсеты по партициям, экспортирует их в метрики и решает, не отстал ли консьюмер слишком сильно
+type LagMonitor struct {
+	reader      *kafka.Reader
+	client      *kafka.Client
+	metrics     *metrics.Metrics
+	interval    time.Duration
+	threshold   int64
+	maxDuration time.Duration
+	now         func() time.Time
+
+	mu           sync.RWMutex
+	snapshot     LagSnapshot
+	totals       ReaderStats
+	laggingSince time.Time
+}
+
+// NewLagMonitor создает монитор отставания для ридера консьюмера.
+// Консьюмер считается неготовым, если суммарное отставание превышает threshold дольше maxDuration.
+// clientTimeout ограничивает каждый служебный запрос к брокеру
+func NewLagMonitor(reader *kafka.Reader, m *metrics.Metrics, interval time.Duration, threshold int64, maxDuration, clientTimeout time.Duration) *LagMonitor {
+	cfg := reader.Config()
+	return &LagMonitor{
+		reader:      reader,
+		client:      &kafka.Client{Addr: kafka.TCP(cfg.Brokers...), Timeout: clientTimeout},
+		metrics:     m,
+		interval:    interval,
+		threshold:   threshold,
+		maxDuration: maxDuration,
+		now:         time.Now,
+		snapshot:    LagSnapshot{Topic: cfg.Topic, GroupID: cfg.GroupID, Ready: true},
+	}
+}
+
+// Run снимает срезы до отмены контекста
+func (lm *LagMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(lm.interval)
+	defer ticker.Stop()
+
+	for {
+		lm.sample(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Snapshot возвращает последний срез состояния консьюмера
+func (lm *LagMonitor) Snapshot() LagSnapshot {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	snap := lm.snapshot
+	snap.Partitions = append([]PartitionLag(nil), lm.snapshot.Partitions...)
+	snap.Ready, _ = lm.readyLocked()
+	if !lm.laggingSince.IsZero() {
+		since := lm.laggingSince
+		snap.LaggingSince = &since
+	}
+	return snap
+}
+
+// Ready сообщает, готов ли консьюмер, и причину, если нет
+func (lm *LagMonitor) Ready() (bool, string) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	return lm.readyLocked()
+}
+
+func (lm *LagMonitor) readyLocked() (bool, string) {
+	if lm.laggingSince.IsZero() {
+		return true, ""
+	}
+	lagging := lm.now().Sub(lm.laggingSince)
+	if lagging <= lm.maxDuration {
+		return true, ""
+	}
+	return false, fmt.Sprintf("consumer lag %d exceeds %d for %s", lm.snapshot.TotalLag, lm.threshold, lagging.Round(time.Second))
+}
+
+// sample снимает один срез. Stats() ридера сбрасывает счётчики, поэтому они накапливаются здесь
+func (lm *LagMonitor) sample(ctx context.Context) {
+	stats := lm.reader.Stats()
+	lm.metrics.ConsumerLag.Set(float64(stats.Lag))
+	lm.metrics.KafkaFetchErrors.Add(float64(stats.Errors))
+	lm.metrics.KafkaRebalances.Add(float64(stats.Rebalances))
+
+	sampleCtx, cancel := context.WithTimeout(ctx, lm.interval)
+	defer cancel()
+	partitions, groupState, err := lm.fetchPartitions(sampleCtx)
+	if err != nil && ctx.Err() == nil {
+		slog.Warn("Failed to sample Kafka partition offsets", "error", err)
+	}
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	lm.totals.Lag = stats.Lag
+	lm.totals.Messages += stats.Messages
+	lm.totals.Errors += stats.Errors
+	lm.totals.Timeouts += stats.Timeouts
+	lm.totals.Rebalances += stats.Rebalances
+
+	lm.snapshot.SampledAt = lm.now()
+	lm.snapshot.Reader = lm.totals
+	if err != nil {
+		// при ошибке сохраняем прошлые данные по партициям, готовность по ним не меняем
+		lm.snapshot.Error = err.Error()
+		return
+	}
+	lm.snapshot.Error = ""
+	lm.snapshot.GroupState = groupState
+	lm.snapshot.Partitions = partitions
+	lm.exportPartitions(partitions)
+
+	var total int64
+	for _, p := range partitions {
+		total += p.Lag
+	}
+	lm.updateLag(total)
+}
+
+// updateLag запоминает суммарное отставание и момент, с которого оно превышает порог
+func (lm *LagMonitor) updateLag(total int64) {
+	lm.snapshot.TotalLag = total
+	switch {
+	case total <= lm.threshold:
+		lm.laggingSince = time.Time{}
+	case lm.laggingSince.IsZero():
+		lm.laggingSince = lm.now()
+	}
+}
+
+// fetchPartitions запрашивает у брокера список партиций, их начальный оффсет и high-water mark,
+// закоммиченные оффсеты группы и текущее распределение партиций между участниками
+func (lm *LagMonitor) fetchPartitions(ctx context.Context) ([]PartitionLag, string, error) {
+	topic, groupID := lm.snapshot.Topic, lm.snapshot.GroupID
+
+	meta, err := lm.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, "", fmt.Errorf("metadata: %w", err)
+	}
+	if len(meta.Topics) == 0 {
+		return nil, "", fmt.Errorf("topic %q not found", topic)
+	}
+	if meta.Topics[0].Error != nil {
+		return nil, "", fmt.Errorf("metadata for topic %q: %w", topic, meta.Topics[0].Error)
+	}
+
+	ids := make([]int, 0, len(meta.Topics[0].Partitions))
+	for _, p := range meta.Topics[0].Partitions {
+		ids = append(ids, p.ID)
+	}
+
+	// брокер не принимает одну партицию дважды в запросе, поэтому начало и конец читаются отдельно
+	first, err := listOffsets(ctx, lm.client, topic, ids, kafka.FirstOffsetOf)
+	if err != nil {
+		return nil, "", fmt.Errorf("log start offset: %w", err)
+	}
+	last, err := listOffsets(ctx, lm.client, topic, ids, kafka.LastOffsetOf)
+	if err != nil {
+		return nil, "", fmt.Errorf("high-water mark: %w", err)
+	}
+
+	committed, err := lm.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: groupID,
+		Topics:  map[string][]int{topic: ids},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("offset fetch: %w", err)
+	}
+	if committed.Error != nil {
+		return nil, "", fmt.Errorf("offset fetch: %w", committed.Error)
+	}
+
+	byPartition := make(map[int]*PartitionLag, len(ids))
+	for _, id := range ids {
+		byPartition[id] = &PartitionLag{Partition: id, LogStartOffset: first[id], HighWaterMark: last[id], CommittedOffset: -1}
+	}
+	var errs []error
+	for _, co := range committed.Topics[topic] {
+		if co.Error != nil {
+			errs = append(errs, fmt.Errorf("partition %d committed offset: %w", co.Partition, co.Error))
+			continue
+		}
+		if p, ok := byPartition[co.Partition]; ok {
+			p.CommittedOffset = co.CommittedOffset
+		}
+	}
+	if len(errs) > 0 {
+		return nil, "", errors.Join(errs...)
+	}
+
+	groupState := ""
+	groups, err := lm.client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{groupID}})
+	if err != nil {
+		slog.Debug("Failed to describe consumer group", "error", err, "group_id", groupID)
+	} else if len(groups.Groups) > 0 {
+		groupState = groups.Groups[0].GroupState
+		for _, member := range groups.Groups[0].Members {
+			for _, t := range member.MemberAssignments.Topics {
+				if t.Topic != topic {
+					continue
+				}
+				for _, id := range t.Partitions {
+					if p, ok := byPartition[id]; ok {
+						p.AssignedTo = member.ClientID + "@" + member.ClientHost
+					}
+				}
+			}
+		}
+	}
+
+	partitions := make([]PartitionLag, 0, len(byPartition))
+	for _, p := range byPartition {
+		p.Lag = partitionLag(*p)
+		partitions = append(partitions, *p)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Partition < partitions[j].Partition })
+
+	return partitions, groupState, nil
+}
+
+// partitionLag считает, сколько сообщений партиции группе осталось прочитать.
+// Без закоммиченного оффсета и после удаления старых сегментов по retention чтение начнётся
+// с начала лога, а не с нуля, поэтому удалённые сообщения в отставание не входят
+func partitionLag(p PartitionLag) int64 {
+	start := max(p.CommittedOffset, p.LogStartOffset)
+	return max(p.HighWaterMark-start, 0)
+}
+
+// exportPartitions обновляет метрики по партициям, сбрасывая данные об ушедших партициях
+func (lm *LagMonitor) exportPartitions(partitions []PartitionLag) {
+	lm.metrics.KafkaPartitionLag.Reset()
+	lm.metrics.KafkaHighWaterMark.Reset()
+	lm.metrics.KafkaCommittedOffset.Reset()
+	lm.metrics.KafkaPartitionAssignment.Reset()
+
+	for _, p := range partitions {
+		partition := strconv.Itoa(p.Partition)
+		lm.metrics.KafkaPartitionLag.WithLabelValues(partition).Set(float64(p.Lag))
+		lm.metrics.KafkaHighWaterMark.WithLabelValues(partition).Set(float64(p.HighWaterMark))
+		lm.metrics.KafkaCommittedOffset.WithLabelValues(partition).Set(float64(p.CommittedOffset))
+		if p.AssignedTo != "" {
+			lm.metrics.KafkaPartitionAssignment.WithLabelValues(partition, p.AssignedTo).Set(1)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLagMonitorReady(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	lm := &LagMonitor{
+		threshold:   100,
+		maxDuration: time.Minute,
+		now:         func() time.Time { return now },
+	}
+
+	lm.updateLag(50)
+	ready, _ := lm.Ready()
+	require.True(t, ready, "Отставание ниже порога не должно влиять на готовность")
+
+	lm.updateLag(500)
+	now = now.Add(30 * time.Second)
+	lm.updateLag(700)
+	ready, _ = lm.Ready()
+	require.True(t, ready, "Кратковременное превышение порога допустимо")
+
+	now = now.Add(time.Minute)
+	ready, reason := lm.Ready()
+	require.False(t, ready, "Превышение порога дольше maxDuration должно снимать готовность")
+	require.Contains(t, reason, "700")
+	require.NotNil(t, lm.Snapshot().LaggingSince)
+
+	lm.updateLag(10)
+	ready, _ = lm.Ready()
+	require.True(t, ready, "После снижения отставания консьюмер снова готов")
+	require.Nil(t, lm.Snapshot().LaggingSince)
+}
+
+func TestPartitionLag(t *testing.T) {
+	tests := []struct {
+		name string
+		p    PartitionLag
+		want int64
+	}{
+		{"Committed", PartitionLag{LogStartOffset: 0, HighWaterMark: 100, CommittedOffset: 40}, 60},
+		{"NoCommit", PartitionLag{LogStartOffset: 0, HighWaterMark: 100, CommittedOffset: -1}, 100},
+		{"NoCommitAfterRetention", PartitionLag{LogStartOffset: 90, HighWaterMark: 100, CommittedOffset: -1}, 10},
+		{"CommitBeforeRetention", PartitionLag{LogStartOffset: 90, HighWaterMark: 100, CommittedOffset: 20}, 10},
+		{"CaughtUp", PartitionLag{LogStartOffset: 90, HighWaterMark: 100, CommittedOffset: 100}, 0},
+		{"Empty", PartitionLag{LogStartOffset: 100, HighWaterMark: 100, CommittedOffset: -1}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, partitionLag(tt.p), "Отставание должно считаться от max(закоммиченный, начало лога)")
+		})
+	}
+}
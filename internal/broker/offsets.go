@@ -0,0 +1,222 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// OffsetTarget - куда сдвигаются оффсеты группы: в начало, в конец, на конкретный оффсет или на момент времени
+type OffsetTarget struct {
+	Earliest bool
+	Latest   bool
+	Offset   int64
+	Time     time.Time
+}
+
+// ParseOffsetTarget разбирает цель сброса: earliest, latest, число или время в RFC 3339
+func ParseOffsetTarget(s string) (OffsetTarget, error) {
+	switch s {
+	case "earliest":
+		return OffsetTarget{Earliest: true}, nil
+	case "latest":
+		return OffsetTarget{Latest: true}, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n >= 0 {
+		return OffsetTarget{Offset: n}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return OffsetTarget{Time: t}, nil
+	}
+	return OffsetTarget{}, fmt.Errorf("invalid offset target %q, expected earliest, latest, an offset or an RFC 3339 time", s)
+}
+
+// OffsetChange - сдвиг оффсета группы в одной партиции
+type OffsetChange struct {
+	Partition int   `json:"partition"`
+	Old       int64 `json:"old"`
+	New       int64 `json:"new"`
+}
+
+// ResetOffsets сдвигает закоммиченные оффсеты группы консьюмера в его топике на target.
+// Группа должна быть пустой (все консьюмеры остановлены), иначе брокер отклонит коммит.
+// При dryRun только вычисляет новые оффсеты. Время запросов ограничивается контекстом
+func ResetOffsets(ctx context.Context, settings ReaderSettings, target OffsetTarget, dryRun bool) ([]OffsetChange, error) {
+	client := &kafka.Client{Addr: kafka.TCP(settings.Brokers...)}
+	topic, groupID := settings.Topic, settings.GroupID
+
+	groups, err := client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{groupID}})
+	if err != nil {
+		return nil, fmt.Errorf("describe group: %w", err)
+	}
+	if len(groups.Groups) > 0 {
+		g := groups.Groups[0]
+		if g.Error != nil && !errors.Is(g.Error, kafka.GroupIdNotFound) {
+			return nil, fmt.Errorf("describe group: %w", g.Error)
+		}
+		if len(g.Members) > 0 {
+			return nil, fmt.Errorf("consumer group %q has %d active members (state %s), stop the service first", groupID, len(g.Members), g.GroupState)
+		}
+	}
+
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	if len(meta.Topics) == 0 || meta.Topics[0].Error != nil {
+		return nil, fmt.Errorf("topic %q not found", topic)
+	}
+
+	ids := make([]int, 0, len(meta.Topics[0].Partitions))
+	for _, p := range meta.Topics[0].Partitions {
+		ids = append(ids, p.ID)
+	}
+	sort.Ints(ids)
+
+	committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: groupID, Topics: map[string][]int{topic: ids}})
+	if err != nil {
+		return nil, fmt.Errorf("offset fetch: %w", err)
+	}
+	old := make(map[int]int64, len(ids))
+	for _, p := range committed.Topics[topic] {
+		old[p.Partition] = p.CommittedOffset
+	}
+
+	newOffsets, err := resolveTarget(ctx, client, topic, ids, target)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]OffsetChange, 0, len(ids))
+	commits := make([]kafka.OffsetCommit, 0, len(ids))
+	for _, id := range ids {
+		changes = append(changes, OffsetChange{Partition: id, Old: old[id], New: newOffsets[id]})
+		commits = append(commits, kafka.OffsetCommit{Partition: id, Offset: newOffsets[id]})
+	}
+	if dryRun {
+		return changes, nil
+	}
+
+	// коммит вне поколения группы разрешён брокером только для пустой группы
+	resp, err := client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      groupID,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("offset commit: %w", err)
+	}
+	var errs []error
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			errs = append(errs, fmt.Errorf("partition %d: %w", p.Partition, p.Error))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("offset commit: %w", err)
+	}
+	return changes, nil
+}
+
+// offsetLister - часть kafka.Client, через которую читаются оффсеты партиций
+type offsetLister interface {
+	ListOffsets(ctx context.Context, req *kafka.ListOffsetsRequest) (*kafka.ListOffsetsResponse, error)
+}
+
+// resolveTarget вычисляет новый оффсет каждой партиции. Явный оффсет ограничивается границами партиции,
+// для момента времени без сообщений после него берётся конец партиции
+func resolveTarget(ctx context.Context, client offsetLister, topic string, ids []int, target OffsetTarget) (map[int]int64, error) {
+	switch {
+	case target.Earliest:
+		return listOffsets(ctx, client, topic, ids, kafka.FirstOffsetOf)
+	case target.Latest:
+		return listOffsets(ctx, client, topic, ids, kafka.LastOffsetOf)
+	}
+
+	first, err := listOffsets(ctx, client, topic, ids, kafka.FirstOffsetOf)
+	if err != nil {
+		return nil, err
+	}
+	last, err := listOffsets(ctx, client, topic, ids, kafka.LastOffsetOf)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make(map[int]int64, len(ids))
+	if target.Time.IsZero() {
+		for _, id := range ids {
+			offsets[id] = min(max(target.Offset, first[id]), last[id])
+		}
+		return offsets, nil
+	}
+
+	at, err := listOffsets(ctx, client, topic, ids, func(id int) kafka.OffsetRequest {
+		return kafka.TimeOffsetOf(id, target.Time)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		offsets[id] = at[id]
+		if offsets[id] < 0 {
+			offsets[id] = last[id]
+		}
+	}
+	return offsets, nil
+}
+
+// listOffsets выполняет запрос оффсетов одного вида для всех партиций.
+// Для запроса по времени без сообщений после этого момента возвращается -1
+func listOffsets(ctx context.Context, client offsetLister, topic string, ids []int, request func(int) kafka.OffsetRequest) (map[int]int64, error) {
+	requests := make([]kafka.OffsetRequest, 0, len(ids))
+	for _, id := range ids {
+		requests = append(requests, request(id))
+	}
+	if len(requests) == 0 {
+		return map[int]int64{}, nil
+	}
+
+	resp, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: requests}})
+	if err != nil {
+		return nil, fmt.Errorf("list offsets: %w", err)
+	}
+
+	offsets := make(map[int]int64, len(ids))
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("list offsets for partition %d: %w", p.Partition, p.Error)
+		}
+		offsets[p.Partition] = responseOffset(p, requests[0].Timestamp)
+	}
+	return offsets, nil
+}
+
+// responseOffset достаёт из ответа kafka-go оффсет запроса вида timestamp.
+// kafka-go заранее ставит 0 в поле запрошенного вида (FirstOffset или LastOffset) и -1 в другое,
+// а ответ кладёт по метке времени, которую вернул брокер: -2 в FirstOffset, -1 в LastOffset, остальные в Offsets.
+// Брокер отвечает на запрос начала и конца партиции меткой -1, поэтому оба оффсета обычно приходят в LastOffset
+func responseOffset(p kafka.PartitionOffsets, timestamp int64) int64 {
+	for offset := range p.Offsets {
+		return offset
+	}
+	switch timestamp {
+	case kafka.FirstOffset:
+		if p.LastOffset >= 0 {
+			return p.LastOffset
+		}
+		return p.FirstOffset
+	case kafka.LastOffset:
+		if p.FirstOffset >= 0 {
+			return p.FirstOffset
+		}
+		return p.LastOffset
+	default:
+		// сообщений после момента нет: брокер отвечает оффсетом -1 без метки времени
+		return -1
+	}
+}
@@ -0,0 +1,120 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOffsetTarget(t *testing.T) {
+	target, err := ParseOffsetTarget("earliest")
+	require.NoError(t, err)
+	require.True(t, target.Earliest)
+
+	target, err = ParseOffsetTarget("latest")
+	require.NoError(t, err)
+	require.True(t, target.Latest)
+
+	target, err = ParseOffsetTarget("42")
+	require.NoError(t, err)
+	require.Equal(t, int64(42), target.Offset)
+
+	target, err = ParseOffsetTarget("2024-05-01T10:00:00Z")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), target.Time)
+
+	_, err = ParseOffsetTarget("-5")
+	require.Error(t, err, "Отрицательный оффсет недопустим")
+	_, err = ParseOffsetTarget("")
+	require.Error(t, err)
+}
+
+// fakeBroker отвечает на ListOffsets так же, как kafka-go раскладывает ответ настоящего брокера
+type fakeBroker struct {
+	start, end map[int]int64
+	// messages - время записи сообщений партиции по оффсетам, начиная со start
+	messages map[int][]time.Time
+	// echoFirst включает ответ меткой -2 на запрос начала партиции, как у старых брокеров
+	echoFirst bool
+}
+
+func (b fakeBroker) ListOffsets(_ context.Context, req *kafka.ListOffsetsRequest) (*kafka.ListOffsetsResponse, error) {
+	resp := &kafka.ListOffsetsResponse{Topics: map[string][]kafka.PartitionOffsets{}}
+	for topic, requests := range req.Topics {
+		for _, r := range requests {
+			p := kafka.PartitionOffsets{Partition: r.Partition, FirstOffset: -1, LastOffset: -1, Offsets: map[int64]time.Time{}}
+			switch r.Timestamp {
+			case kafka.FirstOffset:
+				p.FirstOffset = 0
+				if b.echoFirst {
+					p.FirstOffset = b.start[r.Partition]
+				} else {
+					p.LastOffset = b.start[r.Partition]
+				}
+			case kafka.LastOffset:
+				p.LastOffset = b.end[r.Partition]
+			default:
+				at := time.UnixMilli(r.Timestamp)
+				p.LastOffset = -1
+				for i, ts := range b.messages[r.Partition] {
+					if !ts.Before(at) {
+						p.Offsets[b.start[r.Partition]+int64(i)] = ts
+						break
+					}
+				}
+			}
+			resp.Topics[topic] = append(resp.Topics[topic], p)
+		}
+	}
+	return resp, nil
+}
+
+func TestResolveTarget(t *testing.T) {
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	// в партиции 0 сегменты до оффсета 100 удалены по retention, партиция 1 пуста
+	broker := fakeBroker{
+		start:    map[int]int64{0: 100, 1: 7},
+		end:      map[int]int64{0: 103, 1: 7},
+		messages: map[int][]time.Time{0: {base, base.Add(time.Minute), base.Add(2 * time.Minute)}},
+	}
+	ids := []int{0, 1}
+
+	tests := []struct {
+		name   string
+		target OffsetTarget
+		want   map[int]int64
+	}{
+		{"Earliest", OffsetTarget{Earliest: true}, map[int]int64{0: 100, 1: 7}},
+		{"Latest", OffsetTarget{Latest: true}, map[int]int64{0: 103, 1: 7}},
+		{"Offset inside", OffsetTarget{Offset: 101}, map[int]int64{0: 101, 1: 7}},
+		{"Offset before start", OffsetTarget{Offset: 5}, map[int]int64{0: 100, 1: 7}},
+		{"Offset after end", OffsetTarget{Offset: 500}, map[int]int64{0: 103, 1: 7}},
+		{"Time", OffsetTarget{Time: base.Add(30 * time.Second)}, map[int]int64{0: 101, 1: 7}},
+		{"Time after last message", OffsetTarget{Time: base.Add(time.Hour)}, map[int]int64{0: 103, 1: 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveTarget(context.Background(), broker, "orders", ids, tt.target)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestListOffsets(t *testing.T) {
+	ids := []int{0, 1}
+	for _, echoFirst := range []bool{false, true} {
+		broker := fakeBroker{start: map[int]int64{0: 100, 1: 0}, end: map[int]int64{0: 103, 1: 0}, echoFirst: echoFirst}
+
+		first, err := listOffsets(context.Background(), broker, "orders", ids, kafka.FirstOffsetOf)
+		require.NoError(t, err)
+		require.Equal(t, map[int]int64{0: 100, 1: 0}, first, "Начало партиции должно читаться при любой метке в ответе брокера")
+
+		last, err := listOffsets(context.Background(), broker, "orders", ids, kafka.LastOffsetOf)
+		require.NoError(t, err)
+		require.Equal(t, map[int]int64{0: 103, 1: 0}, last, "Конец партиции - high-water mark, а не последний оффсет")
+	}
+}
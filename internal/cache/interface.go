@@ -6,4 +6,38 @@ import "test_task_wb/internal/model"
 type OrderCache interface {
 	Set(uid string, order model.Order)
 	Get(uid string) (model.Order, bool)
+	Delete(uid string)
+}
+
+// ShardStats реализуют кэши, которые могут сообщить число записей в каждом сегменте
+type ShardStats interface {
+	ShardLens() []int
+}
+
+// Resizable реализуют кэши, емкость которых можно менять на лету
+type Resizable interface {
+	Resize(totalCapacity int) int
+}
+
+// KeyKind - вид вторичного ключа, по которому можно найти заказ
+type KeyKind string
+
+const (
+	KeyTrackNumber KeyKind = "track_number"
+	KeyTransaction KeyKind = "transaction"
+	KeyItemRID     KeyKind = "rid"
+)
+
+// SecondaryIndex реализуют кэши, которые находят заказ по вторичному ключу так же быстро, как по UID.
+// Отменённые заказы удаляются из кэша, поэтому среди совпадений выбирается самый новый - как и в хранилище
+type SecondaryIndex interface {
+	GetBy(kind KeyKind, key string) (model.Order, bool)
+}
+
+// Newer сообщает, что заказ a новее b по дате создания; при равных датах порядок задаёт UID
+func Newer(a, b model.Order) bool {
+	if !a.DateCreated.Equal(b.DateCreated) {
+		return a.DateCreated.After(b.DateCreated)
+	}
+	return a.OrderUID > b.OrderUID
 }
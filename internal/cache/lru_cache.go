@@ -13,13 +13,21 @@ type Node struct {
 	value model.Order
 }
 
+// secondaryKey - вторичный ключ заказа
+type secondaryKey struct {
+	kind KeyKind
+	key  string
+}
+
 // структура LRUCache реализует Least Recently Used кэш
 type LRUCache struct {
 	mu       sync.Mutex
 	capacity int
 	items    map[string]*Node
-	head     *Node // Самый "старый" элемент
-	tail     *Node // Самый "новый" элемент
+	// secondary ведёт от вторичных ключей к UID всех заказов в items, у которых есть такой ключ
+	secondary map[secondaryKey]map[string]struct{}
+	head      *Node // Самый "старый" элемент
+	tail      *Node // Самый "новый" элемент
 }
 
 // NewLRUCache создает новый LRU-кэш с заданной емкостью
@@ -30,10 +38,11 @@ func NewLRUCache(capacity int) *LRUCache {
 	tail.prev = head
 
 	return &LRUCache{
-		capacity: capacity,
-		items:    make(map[string]*Node, capacity),
-		head:     head,
-		tail:     tail,
+		capacity:  capacity,
+		items:     make(map[string]*Node, capacity),
+		secondary: make(map[secondaryKey]map[string]struct{}, capacity),
+		head:      head,
+		tail:      tail,
 	}
 }
 
@@ -43,7 +52,9 @@ func (c *LRUCache) Set(uid string, order model.Order) {
 	defer c.mu.Unlock()
 
 	if node, exists := c.items[uid]; exists {
+		c.unindex(node)
 		node.value = order
+		c.index(node)
 		c.moveToTail(node)
 		return
 	}
@@ -57,6 +68,7 @@ func (c *LRUCache) Set(uid string, order model.Order) {
 		value: order,
 	}
 	c.items[uid] = newNode
+	c.index(newNode)
 	c.addToTail(newNode)
 }
 
@@ -73,6 +85,60 @@ func (c *LRUCache) Get(uid string) (model.Order, bool) {
 	return model.Order{}, false
 }
 
+// GetBy получает заказ по вторичному ключу и, как Get, отмечает его недавно использованным.
+// Если ключ есть у нескольких заказов, возвращается самый новый (см. Newer)
+func (c *LRUCache) GetBy(kind KeyKind, key string) (model.Order, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var best *Node
+	for uid := range c.secondary[secondaryKey{kind, key}] {
+		if node := c.items[uid]; best == nil || Newer(node.value, best.value) {
+			best = node
+		}
+	}
+	if best == nil {
+		return model.Order{}, false
+	}
+	c.moveToTail(best)
+	return best.value, true
+}
+
+// Delete удаляет заказ из кэша, если он там есть
+func (c *LRUCache) Delete(uid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if node, found := c.items[uid]; found {
+		c.unindex(node)
+		c.removeNode(node)
+		delete(c.items, uid)
+	}
+}
+
+// Len возвращает текущее число записей в кэше
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.items)
+}
+
+// Resize меняет емкость кэша. При уменьшении самые старые записи вытесняются сразу.
+// Возвращает число вытесненных записей
+func (c *LRUCache) Resize(capacity int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.capacity = capacity
+	evicted := 0
+	for len(c.items) > c.capacity {
+		c.evictOldest()
+		evicted++
+	}
+	return evicted
+}
+
 // addToTail добавляет узел в конец списка (делает его самым новым)
 func (c *LRUCache) addToTail(node *Node) {
 	prev := c.tail.prev
@@ -100,6 +166,47 @@ func (c *LRUCache) evictOldest() {
 	if oldest == c.tail {
 		return // Кэш пуст
 	}
+	c.unindex(oldest)
 	c.removeNode(oldest)
 	delete(c.items, oldest.key)
 }
+
+// secondaryKeys возвращает непустые вторичные ключи заказа
+func secondaryKeys(order model.Order) []secondaryKey {
+	keys := make([]secondaryKey, 0, len(order.Items)+2)
+	if order.TrackNumber != "" {
+		keys = append(keys, secondaryKey{KeyTrackNumber, order.TrackNumber})
+	}
+	if order.Payment.Transaction != "" {
+		keys = append(keys, secondaryKey{KeyTransaction, order.Payment.Transaction})
+	}
+	for _, item := range order.Items {
+		if item.Rid != "" {
+			keys = append(keys, secondaryKey{KeyItemRID, item.Rid})
+		}
+	}
+	return keys
+}
+
+// index добавляет вторичные ключи узла
+func (c *LRUCache) index(node *Node) {
+	for _, k := range secondaryKeys(node.value) {
+		uids, ok := c.secondary[k]
+		if !ok {
+			uids = make(map[string]struct{}, 1)
+			c.secondary[k] = uids
+		}
+		uids[node.key] = struct{}{}
+	}
+}
+
+// unindex удаляет вторичные ключи узла, не трогая другие заказы с теми же ключами
+func (c *LRUCache) unindex(node *Node) {
+	for _, k := range secondaryKeys(node.value) {
+		uids := c.secondary[k]
+		delete(uids, node.key)
+		if len(uids) == 0 {
+			delete(c.secondary, k)
+		}
+	}
+}
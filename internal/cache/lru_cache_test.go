@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"fmt"
 	"test_task_wb/internal/model"
 	"testing"
 	"time"
@@ -57,4 +58,140 @@ func TestLRUCache(t *testing.T) {
 		_, found = cache.Get(order3.OrderUID)
 		require.True(t, found, "Новый элемент order3 должен быть в кэше")
 	})
+	t.Run("Delete", func(t *testing.T) {
+		cache := NewLRUCache(2)
+
+		cache.Set(order1.OrderUID, order1)
+		cache.Set(order2.OrderUID, order2)
+
+		cache.Delete(order1.OrderUID)
+		cache.Delete("non_existent_order")
+
+		_, found := cache.Get(order1.OrderUID)
+		require.False(t, found, "Удалённый элемент order1 не должен находиться в кэше")
+
+		cache.Set(order3.OrderUID, order3)
+
+		_, found = cache.Get(order2.OrderUID)
+		require.True(t, found, "После удаления освободилось место, order2 не должен быть вытеснен")
+		_, found = cache.Get(order3.OrderUID)
+		require.True(t, found, "Новый элемент order3 должен быть в кэше")
+	})
+
+	t.Run("Resize", func(t *testing.T) {
+		cache := NewLRUCache(3)
+
+		cache.Set(order1.OrderUID, order1)
+		cache.Set(order2.OrderUID, order2)
+		cache.Set(order3.OrderUID, order3)
+		cache.Get(order1.OrderUID)
+
+		evicted := cache.Resize(1)
+		require.Equal(t, 2, evicted, "При уменьшении емкости лишние записи должны быть вытеснены")
+		require.Equal(t, 1, cache.Len())
+		_, found := cache.Get(order1.OrderUID)
+		require.True(t, found, "Самый свежий элемент order1 должен остаться в кэше")
+
+		require.Zero(t, cache.Resize(2), "При увеличении емкости ничего не вытесняется")
+		cache.Set(order2.OrderUID, order2)
+		require.Equal(t, 2, cache.Len())
+	})
+}
+
+// TestSecondaryIndex проверяет поиск по трек-номеру, транзакции и RID товара
+func TestSecondaryIndex(t *testing.T) {
+	newOrder := func(uid, track string, rids ...string) model.Order {
+		o := model.Order{OrderUID: uid, TrackNumber: track, Payment: model.Payment{Transaction: "tx" + uid}}
+		for _, rid := range rids {
+			o.Items = append(o.Items, model.Item{Rid: rid})
+		}
+		return o
+	}
+
+	t.Run("Lookup by every key", func(t *testing.T) {
+		cache := NewLRUCache(2)
+		cache.Set("order1", newOrder("order1", "TRACK1", "rid1", "rid2"))
+
+		for kind, key := range map[KeyKind]string{KeyTrackNumber: "TRACK1", KeyTransaction: "txorder1", KeyItemRID: "rid2"} {
+			order, found := cache.GetBy(kind, key)
+			require.True(t, found, "Заказ должен находиться по ключу %s", kind)
+			require.Equal(t, "order1", order.OrderUID)
+		}
+		_, found := cache.GetBy(KeyTrackNumber, "txorder1")
+		require.False(t, found, "Ключи разных видов не должны смешиваться")
+	})
+
+	t.Run("Update replaces keys", func(t *testing.T) {
+		cache := NewLRUCache(2)
+		cache.Set("order1", newOrder("order1", "TRACK1", "rid1"))
+		cache.Set("order1", newOrder("order1", "TRACK2", "rid1"))
+
+		_, found := cache.GetBy(KeyTrackNumber, "TRACK1")
+		require.False(t, found, "Старый трек-номер не должен находиться после обновления заказа")
+		_, found = cache.GetBy(KeyTrackNumber, "TRACK2")
+		require.True(t, found)
+	})
+
+	t.Run("Eviction and delete drop keys", func(t *testing.T) {
+		cache := NewLRUCache(1)
+		cache.Set("order1", newOrder("order1", "TRACK1", "rid1"))
+		cache.Set("order2", newOrder("order2", "TRACK2", "rid2"))
+
+		_, found := cache.GetBy(KeyItemRID, "rid1")
+		require.False(t, found, "Ключи вытесненного заказа должны удаляться")
+
+		cache.Delete("order2")
+		_, found = cache.GetBy(KeyTrackNumber, "TRACK2")
+		require.False(t, found, "Ключи удалённого заказа должны удаляться")
+	})
+
+	t.Run("GetBy updates recentness", func(t *testing.T) {
+		cache := NewLRUCache(2)
+		cache.Set("order1", newOrder("order1", "TRACK1"))
+		cache.Set("order2", newOrder("order2", "TRACK2"))
+
+		cache.GetBy(KeyTrackNumber, "TRACK1")
+		cache.Set("order3", newOrder("order3", "TRACK3"))
+
+		_, found := cache.Get("order1")
+		require.True(t, found, "Заказ, найденный по вторичному ключу, не должен вытесняться первым")
+	})
+
+	t.Run("Sharded cache", func(t *testing.T) {
+		cache := NewShardedCache(10, 4).(*ShardedCache)
+		for i := range 8 {
+			uid := fmt.Sprintf("order%d", i)
+			cache.Set(uid, newOrder(uid, "TRACK"+uid, "rid"+uid))
+		}
+
+		order, found := cache.GetBy(KeyItemRID, "ridorder5")
+		require.True(t, found, "Заказ должен находиться в любом сегменте")
+		require.Equal(t, "order5", order.OrderUID)
+	})
+
+	t.Run("Shared key returns newest order", func(t *testing.T) {
+		day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+		older := newOrder("order1", "SHARED", "rid1")
+		older.DateCreated = day.Add(time.Hour)
+		newer := newOrder("order2", "SHARED", "rid1")
+		newer.DateCreated = day.Add(2 * time.Hour)
+
+		for name, c := range map[string]interface {
+			OrderCache
+			SecondaryIndex
+		}{"lru": NewLRUCache(10), "sharded": NewShardedCache(64, 16).(*ShardedCache)} {
+			// более новый заказ записан первым: выбор не должен зависеть от порядка записи
+			c.Set(newer.OrderUID, newer)
+			c.Set(older.OrderUID, older)
+
+			order, found := c.GetBy(KeyTrackNumber, "SHARED")
+			require.True(t, found)
+			require.Equal(t, "order2", order.OrderUID, "%s: по общему ключу должен находиться самый новый заказ, как в хранилище", name)
+
+			c.Delete(newer.OrderUID)
+			order, found = c.GetBy(KeyItemRID, "rid1")
+			require.True(t, found, "%s: удаление одного заказа не должно терять общий ключ другого", name)
+			require.Equal(t, "order1", order.OrderUID)
+		}
+	})
 }
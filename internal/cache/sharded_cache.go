@@ -52,3 +52,44 @@ func (sc *ShardedCache) Set(uid string, order model.Order) {
 
 	shard.Set(uid, order)
 }
+
+// Delete находит нужный shard и удаляет из него значение
+func (sc *ShardedCache) Delete(uid string) {
+	shardIndex := sc.getShardIndex(uid)
+	shard := sc.shards[shardIndex]
+
+	shard.Delete(uid)
+}
+
+// GetBy ищет заказ по вторичному ключу. Сегмент определяется по UID, поэтому опрашиваются все сегменты,
+// а из найденных в разных сегментах заказов возвращается самый новый
+func (sc *ShardedCache) GetBy(kind KeyKind, key string) (model.Order, bool) {
+	var best model.Order
+	found := false
+	for _, shard := range sc.shards {
+		if order, ok := shard.GetBy(kind, key); ok && (!found || Newer(order, best)) {
+			best, found = order, true
+		}
+	}
+	return best, found
+}
+
+// ShardLens возвращает число записей в каждом сегменте
+func (sc *ShardedCache) ShardLens() []int {
+	lens := make([]int, len(sc.shards))
+	for i, shard := range sc.shards {
+		lens[i] = shard.Len()
+	}
+	return lens
+}
+
+// Resize перераспределяет общую емкость totalCapacity между сегментами (не меньше 1 на сегмент).
+// Возвращает число вытесненных записей
+func (sc *ShardedCache) Resize(totalCapacity int) int {
+	perShard := max(totalCapacity/int(sc.numShards), 1)
+	evicted := 0
+	for _, shard := range sc.shards {
+		evicted += shard.Resize(perShard)
+	}
+	return evicted
+}
@@ -1,83 +1,262 @@
 package config
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/url"
 	"os"
-	"strconv"
+	"slices"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 // Config хранит все основные настройки приложения
 type Config struct {
-	DatabaseURL    string
+	// Подключение к PostgreSQL. DatabaseURL собирается из отдельных полей, если не задан явно
+	DatabaseURL        string
+	PostgresUser       string
+	PostgresPassword   string
+	PostgresHost       string
+	PostgresPort       int
+	PostgresDB         string
+	PostgresSSLMode    string
+	DBConnectTimeout   time.Duration
+	DBAttemptTimeout   time.Duration
+	DBMaxRetryInterval time.Duration
+
+	// Накат встроенных миграций при старте сервиса под advisory-блокировкой
+	MigrateOnStart     bool
+	MigrateLockTimeout time.Duration
+	// Разрешить старт на схеме, отстающей от встроенных миграций, без их наката
+	MigrateAllowPending bool
+
 	CacheCapacity  int
 	CacheNumShards int
-	HTTPPort       string
-	MetricsPort    string
-	KafkaBrokers   []string
+
+	HTTPPort         string
+	MetricsPort      string
+	GRPCPort         string
+	HTTPReadTimeout  time.Duration
+	HTTPWriteTimeout time.Duration
+	HTTPIdleTimeout  time.Duration
+	ShutdownTimeout  time.Duration
+	StaticDir        string
+	AuditBufferSize  int
+
+	KafkaBrokers       []string
+	KafkaTopic         string
+	KafkaGroupID       string
+	KafkaMinBytes      int
+	KafkaMaxBytes      int
+	KafkaClientTimeout time.Duration
+
+	// Мониторинг отставания консьюмера: консьюмер считается неготовым,
+	// если суммарное отставание выше порога дольше KafkaLagMaxDuration
+	KafkaLagSampleInterval time.Duration
+	KafkaLagThreshold      int
+	KafkaLagMaxDuration    time.Duration
+
+	// Время между снятием готовности и остановкой серверов, чтобы балансировщик успел убрать экземпляр
+	ShutdownDrainDelay time.Duration
+
+	// Шифрование персональных данных доставки
+	PIIKeyFile           string
+	PIIKeys              string
+	PIIActiveKeyID       string
+	PIIReencryptInterval time.Duration
+	PIIReencryptBatch    int
+	// Ключ слепого индекса для поиска по зашифрованным полям доставки
+	PIISearchKey string
+
+	// Файл с политикой маскирования персональных данных в HTTP-ответах
+	MaskingPolicyFile string
+
+	// Аутентификация HTTP API: статические ключи (SHA-256 хэши) и JWT, проверяемые по локальному JWKS
+	AuthEnabled     bool
+	AuthAPIKeys     string
+	AuthJWKSFile    string
+	AuthJWTIssuer   string
+	AuthJWTAudience string
+
+	// Трассировка OpenTelemetry: экспортёр none, stdout или otlp
+	TracingExporter     string
+	TracingOTLPEndpoint string
+	TracingOTLPInsecure bool
+	TracingServiceName  string
+	TracingSampleRatio  float64
+
+	// Настройки, применяемые на лету при перезагрузке конфигурации (SIGHUP или изменение файла)
+	LogLevel            string
+	RateLimitRPS        float64
+	RateLimitBurst      int
+	ConfigWatchInterval time.Duration
+
+	// ConfigFile - файл, из которого загружена конфигурация (пусто, если файла нет)
+	ConfigFile string
+
+	// args - флаги командной строки, чтобы при перезагрузке они по-прежнему имели приоритет
+	args []string
 }
 
-// Load читает конфигурацию из .env файла
-// и предоставляет значения по умолчанию
-func Load() *Config {
-	if err := godotenv.Load(); err != nil {
-		slog.Warn("No .env file found, using environment variables")
-	}
+// Default возвращает конфигурацию со значениями по умолчанию
+func Default() *Config {
+	return &Config{
+		PostgresHost:       "localhost",
+		PostgresPort:       5432,
+		PostgresSSLMode:    "disable",
+		DBConnectTimeout:   2 * time.Minute,
+		DBAttemptTimeout:   5 * time.Second,
+		DBMaxRetryInterval: 30 * time.Second,
+		MigrateLockTimeout: time.Minute,
+
+		CacheCapacity:  128,
+		CacheNumShards: 64,
+
+		HTTPPort:         "8081",
+		MetricsPort:      "9090",
+		GRPCPort:         "50051",
+		HTTPReadTimeout:  15 * time.Second,
+		HTTPWriteTimeout: 30 * time.Second,
+		HTTPIdleTimeout:  2 * time.Minute,
+		ShutdownTimeout:  5 * time.Second,
+		StaticDir:        "./web",
+		AuditBufferSize:  1024,
+
+		KafkaBrokers:       []string{"localhost:9092"},
+		KafkaTopic:         "orders",
+		KafkaGroupID:       "order-service-group",
+		KafkaMinBytes:      10e3, // 10KB
+		KafkaMaxBytes:      10e6, // 10MB
+		KafkaClientTimeout: 10 * time.Second,
+
+		KafkaLagSampleInterval: 15 * time.Second,
+		KafkaLagThreshold:      1000,
+		KafkaLagMaxDuration:    5 * time.Minute,
 
-	dbUser := os.Getenv("POSTGRES_USER")
-	dbPassword := os.Getenv("POSTGRES_PASSWORD")
-	dbHost := os.Getenv("POSTGRES_HOST")
-	if dbHost == "" {
-		dbHost = "localhost"
+		ShutdownDrainDelay: 3 * time.Second,
+
+		PIIReencryptInterval: time.Minute,
+		PIIReencryptBatch:    100,
+
+		TracingExporter:     "none",
+		TracingOTLPEndpoint: "localhost:4317",
+		TracingOTLPInsecure: true,
+		TracingServiceName:  "order-service",
+		TracingSampleRatio:  1.0,
+
+		LogLevel:            "debug",
+		RateLimitBurst:      20,
+		ConfigWatchInterval: 5 * time.Second,
 	}
-	dbPort := os.Getenv("POSTGRES_PORT")
-	if dbPort == "" {
-		dbPort = "5432"
+}
+
+// Load собирает конфигурацию по слоям: значения по умолчанию, затем файл YAML/TOML
+// (флаг -config или переменная CONFIG_FILE), затем переменные окружения (включая .env), затем флаги из args.
+// Ошибки разбора и проверки всех слоёв возвращаются вместе
+func Load(args []string) (*Config, error) {
+	if err := godotenv.Load(); err != nil {
+		slog.Debug("No .env file found, using environment variables")
 	}
-	dbName := os.Getenv("POSTGRES_DB")
 
-	cacheCapacity := getEnvAsInt("CACHE_CAPACITY", 128)
-	cacheNumShards := getEnvAsInt("CACHE_NUM_SHARDS", 64)
+	cfg := Default()
+	cfg.args = args
+	fields := cfg.fields()
 
-	httpPort := os.Getenv("HTTP_PORT")
-	if httpPort == "" {
-		httpPort = "8081"
+	// флаги разбираются первыми, чтобы узнать путь к файлу, но применяются последними
+	flagValues := make(map[*field]string)
+	fs, configFile := newFlagSet(fields, flagValues)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
 	}
 
-	metricsPort := os.Getenv("METRICS_PORT")
-	if metricsPort == "" {
-		metricsPort = "9090"
+	var errs []error
+	if fs.NArg() > 0 {
+		errs = append(errs, fmt.Errorf("unexpected arguments: %v", fs.Args()))
+	}
+	if *configFile != "" {
+		cfg.ConfigFile = *configFile
+		if err := cfg.loadFile(*configFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, cfg.loadEnv()...)
+	for _, f := range fields {
+		if s, ok := flagValues[f]; ok {
+			if err := f.set(s); err != nil {
+				errs = append(errs, fmt.Errorf("flag -%s: %w", f.flagName(), err))
+			}
+		}
 	}
 
-	kafkaBroker := os.Getenv("KAFKA_BROKER")
-	if kafkaBroker == "" {
-		kafkaBroker = "localhost:9092"
+	if cfg.DatabaseURL == "" {
+		cfg.DatabaseURL = cfg.postgresDSN()
 	}
+	errs = append(errs, cfg.Validate())
 
-	return &Config{
-		DatabaseURL: fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-			dbUser, dbPassword, dbHost, dbPort, dbName),
-		CacheCapacity:  cacheCapacity,
-		CacheNumShards: cacheNumShards,
-		HTTPPort:       ":" + httpPort,
-		MetricsPort:    ":" + metricsPort,
-		KafkaBrokers:   []string{kafkaBroker},
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// SplitArgs отделяет флаги конфигурации в начале args от подкоманды и её аргументов.
+// Разбор, как и в пакете flag, останавливается на первом позиционном аргументе
+func SplitArgs(args []string) (configArgs, rest []string, err error) {
+	fs, _ := newFlagSet(Default().fields(), make(map[*field]string))
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
 	}
+	rest = fs.Args()
+	// ёмкость обрезана, чтобы append к флагам конфигурации не затирал остальные аргументы
+	return slices.Clip(args[:len(args)-len(rest)]), rest, nil
 }
 
-func getEnvAsInt(key string, fallback int) int {
-	valueStr, exists := os.LookupEnv(key)
-	if !exists {
-		return fallback
+// newFlagSet описывает флаг -config и флаги всех настроек. Значения флагов настроек
+// не применяются сразу, а собираются в values
+func newFlagSet(fields []*field, values map[*field]string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("order-service", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	for _, f := range fields {
+		fs.Func(f.flagName(), f.usage, func(s string) error {
+			values[f] = s
+			return nil
+		})
 	}
+	return fs, configFile
+}
+
+// Reload заново собирает конфигурацию из тех же источников и флагов, что и при запуске
+func (c *Config) Reload() (*Config, error) {
+	return Load(c.args)
+}
 
-	value, err := strconv.Atoi(valueStr)
-	if err != nil {
-		slog.Warn(fmt.Sprintf("Invalid value for env var '%s', using default value.", key))
-		return fallback
+// postgresDSN собирает строку подключения через net/url, чтобы спецсимволы в логине и пароле экранировались
+func (c *Config) postgresDSN() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.PostgresUser, c.PostgresPassword),
+		Host:     net.JoinHostPort(c.PostgresHost, fmt.Sprint(c.PostgresPort)),
+		Path:     "/" + c.PostgresDB,
+		RawQuery: url.Values{"sslmode": {c.PostgresSSLMode}}.Encode(),
 	}
+	return u.String()
+}
+
+// HTTPAddr возвращает адрес основного HTTP-сервера
+func (c *Config) HTTPAddr() string {
+	return ":" + c.HTTPPort
+}
+
+// MetricsAddr возвращает адрес сервера метрик
+func (c *Config) MetricsAddr() string {
+	return ":" + c.MetricsPort
+}
 
-	return value
+// GRPCAddr возвращает адрес gRPC-сервера
+func (c *Config) GRPCAddr() string {
+	return ":" + c.GRPCPort
 }
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	t.Run("File, env and flags override defaults in order", func(t *testing.T) {
+		path := writeFile(t, "config.yaml", `
+kafka_topic: from-file
+kafka_group_id: file-group
+kafka_brokers: [kafka-1:9092, kafka-2:9092]
+cache_capacity: 512
+db_connect_timeout: 30s
+`)
+		t.Setenv("CONFIG_FILE", path)
+		t.Setenv("KAFKA_GROUP_ID", "env-group")
+		t.Setenv("CACHE_CAPACITY", "256")
+
+		cfg, err := Load([]string{"-cache-capacity", "1024"})
+		require.NoError(t, err)
+		require.Equal(t, path, cfg.ConfigFile)
+		require.Equal(t, "from-file", cfg.KafkaTopic, "Значение из файла должно перекрывать значение по умолчанию")
+		require.Equal(t, "env-group", cfg.KafkaGroupID, "Переменная окружения должна перекрывать файл")
+		require.Equal(t, 1024, cfg.CacheCapacity, "Флаг должен перекрывать переменную окружения")
+		require.Equal(t, []string{"kafka-1:9092", "kafka-2:9092"}, cfg.KafkaBrokers)
+		require.Equal(t, 30*time.Second, cfg.DBConnectTimeout)
+		require.Equal(t, 64, cfg.CacheNumShards)
+	})
+
+	t.Run("TOML file", func(t *testing.T) {
+		path := writeFile(t, "config.toml", "http_port = \"8082\"\ntracing_sample_ratio = 0.25\n")
+
+		cfg, err := Load([]string{"-config", path})
+		require.NoError(t, err)
+		require.Equal(t, "8082", cfg.HTTPPort)
+		require.Equal(t, 0.25, cfg.TracingSampleRatio)
+	})
+
+	t.Run("Special characters in password", func(t *testing.T) {
+		t.Setenv("POSTGRES_USER", "svc")
+		t.Setenv("POSTGRES_PASSWORD", "p@ss:w/rd#1?")
+		t.Setenv("POSTGRES_DB", "orders")
+
+		cfg, err := Load(nil)
+		require.NoError(t, err)
+
+		u, err := url.Parse(cfg.DatabaseURL)
+		require.NoError(t, err)
+		password, _ := u.User.Password()
+		require.Equal(t, "p@ss:w/rd#1?", password, "Пароль должен без потерь проходить через DSN")
+		require.Equal(t, "localhost:5432", u.Host)
+		require.Equal(t, "/orders", u.Path)
+	})
+
+	t.Run("All errors are reported together", func(t *testing.T) {
+		path := writeFile(t, "config.yaml", "kafka_topci: typo\n")
+		t.Setenv("CACHE_CAPACITY", "lots")
+
+		_, err := Load([]string{"-config", path, "-tracing-exporter", "jaeger", "-metrics-port", "8081"})
+		require.Error(t, err)
+		require.ErrorContains(t, err, `unknown key "kafka_topci"`)
+		require.ErrorContains(t, err, `env CACHE_CAPACITY: invalid integer "lots"`)
+		require.ErrorContains(t, err, `unknown exporter "jaeger"`)
+		require.ErrorContains(t, err, "metrics_port: must differ from http_port")
+	})
+}
+
+func TestWriteYAMLRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.PostgresPassword = "secret-password"
+	cfg.PIIKeys = "k1:c2VjcmV0"
+	cfg.DatabaseURL = cfg.postgresDSN()
+
+	var buf bytes.Buffer
+	require.NoError(t, cfg.WriteYAML(&buf))
+	out := buf.String()
+
+	require.NotContains(t, out, "secret-password")
+	require.NotContains(t, out, "c2VjcmV0")
+	require.Contains(t, out, "kafka_topic: orders")
+	require.Contains(t, out, "pii_keys: '[REDACTED]'")
+}
+
+func TestDiff(t *testing.T) {
+	old := Default()
+	updated := Default()
+	updated.LogLevel = "warn"
+	updated.KafkaTopic = "orders-v2"
+	updated.PIIKeys = "k2:bmV3"
+
+	changes := Diff(old, updated)
+	require.Len(t, changes, 3)
+
+	byKey := make(map[string]Change)
+	for _, ch := range changes {
+		byKey[ch.Key] = ch
+	}
+	require.True(t, byKey["log_level"].Reloadable)
+	require.Equal(t, "warn", byKey["log_level"].New)
+	require.False(t, byKey["kafka_topic"].Reloadable, "Топик нельзя поменять без перезапуска")
+	require.Equal(t, "[REDACTED]", byKey["pii_keys"].New, "Секреты не должны попадать в лог изменений")
+}
+
+func TestApplyReloadable(t *testing.T) {
+	current := Default()
+	updated := Default()
+	updated.LogLevel = "warn"
+	updated.KafkaTopic = "orders-v2"
+
+	next := ApplyReloadable(current, updated)
+	require.Equal(t, "warn", next.LogLevel)
+	require.Equal(t, current.KafkaTopic, next.KafkaTopic, "Настройка, требующая перезапуска, не должна попадать в действующую конфигурацию")
+	require.Equal(t, Default().LogLevel, current.LogLevel, "Исходная конфигурация не должна меняться")
+
+	changes := Diff(next, updated)
+	require.Len(t, changes, 1, "Неприменённое изменение должно снова попасть в разницу")
+	require.Equal(t, "kafka_topic", changes[0].Key)
+}
+
+func TestSplitArgs(t *testing.T) {
+	configArgs, rest, err := SplitArgs([]string{"-config", "prod.yaml", "-database-url", "postgres://db", "migrate", "up", "-x"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"-config", "prod.yaml", "-database-url", "postgres://db"}, configArgs)
+	require.Equal(t, []string{"migrate", "up", "-x"}, rest, "Аргументы подкоманды не должны разбираться как флаги конфигурации")
+
+	configArgs, rest, err = SplitArgs([]string{"-log-level", "warn"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"-log-level", "warn"}, configArgs)
+	require.Empty(t, rest)
+
+	_, _, err = SplitArgs([]string{"-no-such-flag", "migrate"})
+	require.Error(t, err)
+}
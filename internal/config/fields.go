@@ -0,0 +1,226 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field описывает одну настройку: ключ в файле конфигурации, переменные окружения, флаг и указатель на поле Config.
+// Имя флага - ключ с дефисами, переменная окружения по умолчанию - ключ в верхнем регистре
+type field struct {
+	key        string
+	env        []string
+	usage      string
+	secret     bool
+	reloadable bool
+	ptr        any
+}
+
+// fields возвращает описание всех настроек, привязанных к полям c
+func (c *Config) fields() []*field {
+	return []*field{
+		{key: "database_url", usage: "full PostgreSQL DSN, overrides postgres_* settings", secret: true, ptr: &c.DatabaseURL},
+		{key: "postgres_user", usage: "PostgreSQL user", ptr: &c.PostgresUser},
+		{key: "postgres_password", usage: "PostgreSQL password", secret: true, ptr: &c.PostgresPassword},
+		{key: "postgres_host", usage: "PostgreSQL host", ptr: &c.PostgresHost},
+		{key: "postgres_port", usage: "PostgreSQL port", ptr: &c.PostgresPort},
+		{key: "postgres_db", usage: "PostgreSQL database name", ptr: &c.PostgresDB},
+		{key: "postgres_sslmode", usage: "PostgreSQL sslmode", ptr: &c.PostgresSSLMode},
+		{key: "db_connect_timeout", usage: "total time budget for connecting to the database on startup", ptr: &c.DBConnectTimeout},
+		{key: "db_attempt_timeout", usage: "timeout of a single database connection attempt", ptr: &c.DBAttemptTimeout},
+		{key: "db_max_retry_interval", usage: "maximum backoff between database connection attempts", ptr: &c.DBMaxRetryInterval},
+
+		{key: "migrate_on_start", usage: "apply embedded schema migrations on startup", ptr: &c.MigrateOnStart},
+		{key: "migrate_lock_timeout", usage: "how long to wait for the schema migration lock on startup", ptr: &c.MigrateLockTimeout},
+		{key: "migrate_allow_pending", usage: "start on a schema with pending migrations instead of refusing to", ptr: &c.MigrateAllowPending},
+
+		{key: "cache_capacity", usage: "total number of orders kept in the cache", reloadable: true, ptr: &c.CacheCapacity},
+		{key: "cache_num_shards", usage: "number of cache shards", ptr: &c.CacheNumShards},
+
+		{key: "http_port", usage: "port of the main HTTP server", ptr: &c.HTTPPort},
+		{key: "metrics_port", usage: "port of the metrics and health server", ptr: &c.MetricsPort},
+		{key: "grpc_port", usage: "port of the gRPC server", ptr: &c.GRPCPort},
+		{key: "http_read_timeout", usage: "HTTP server read timeout", ptr: &c.HTTPReadTimeout},
+		{key: "http_write_timeout", usage: "HTTP server write timeout", ptr: &c.HTTPWriteTimeout},
+		{key: "http_idle_timeout", usage: "HTTP server keep-alive idle timeout", ptr: &c.HTTPIdleTimeout},
+		{key: "shutdown_timeout", usage: "time allowed for graceful shutdown of servers", ptr: &c.ShutdownTimeout},
+		{key: "shutdown_drain_delay", usage: "delay between failing readiness and stopping servers", ptr: &c.ShutdownDrainDelay},
+		{key: "static_dir", usage: "directory with the web UI", ptr: &c.StaticDir},
+		{key: "audit_buffer_size", usage: "number of access log entries buffered before they are dropped", ptr: &c.AuditBufferSize},
+
+		{key: "kafka_brokers", env: []string{"KAFKA_BROKERS", "KAFKA_BROKER"}, usage: "comma-separated Kafka brokers", ptr: &c.KafkaBrokers},
+		{key: "kafka_topic", usage: "Kafka topic with orders", ptr: &c.KafkaTopic},
+		{key: "kafka_group_id", usage: "Kafka consumer group", ptr: &c.KafkaGroupID},
+		{key: "kafka_min_bytes", usage: "minimum Kafka fetch size in bytes", ptr: &c.KafkaMinBytes},
+		{key: "kafka_max_bytes", usage: "maximum Kafka fetch size in bytes", ptr: &c.KafkaMaxBytes},
+		{key: "kafka_client_timeout", usage: "timeout of Kafka admin requests", ptr: &c.KafkaClientTimeout},
+		{key: "kafka_lag_sample_interval", usage: "how often consumer lag is sampled", ptr: &c.KafkaLagSampleInterval},
+		{key: "kafka_lag_threshold", usage: "total lag above which the consumer is considered lagging", ptr: &c.KafkaLagThreshold},
+		{key: "kafka_lag_max_duration", usage: "how long the consumer may lag before readiness fails", ptr: &c.KafkaLagMaxDuration},
+
+		{key: "pii_key_file", usage: "file with PII encryption keys", ptr: &c.PIIKeyFile},
+		{key: "pii_keys", usage: "comma-separated PII encryption keys (id:base64)", secret: true, ptr: &c.PIIKeys},
+		{key: "pii_active_key_id", usage: "id of the key used to encrypt new data", ptr: &c.PIIActiveKeyID},
+		{key: "pii_reencrypt_interval", usage: "how often rows are re-encrypted with the active key, 0 to disable", ptr: &c.PIIReencryptInterval},
+		{key: "pii_reencrypt_batch", usage: "rows re-encrypted per transaction", ptr: &c.PIIReencryptBatch},
+		{key: "pii_search_key", usage: "base64 HMAC key of the blind index for searching encrypted PII", secret: true, ptr: &c.PIISearchKey},
+
+		{key: "masking_policy_file", usage: "JSON file with the PII masking policy", ptr: &c.MaskingPolicyFile},
+
+		{key: "auth_enabled", usage: "require authentication for the HTTP API", ptr: &c.AuthEnabled},
+		{key: "auth_api_keys", usage: "API keys as name:role:scopes:sha256, comma-separated", secret: true, ptr: &c.AuthAPIKeys},
+		{key: "auth_jwks_file", usage: "JWKS file used to verify JWT", ptr: &c.AuthJWKSFile},
+		{key: "auth_jwt_issuer", usage: "expected JWT issuer", ptr: &c.AuthJWTIssuer},
+		{key: "auth_jwt_audience", usage: "expected JWT audience", ptr: &c.AuthJWTAudience},
+
+		{key: "tracing_exporter", usage: "trace exporter: none, stdout or otlp", ptr: &c.TracingExporter},
+		{key: "tracing_otlp_endpoint", usage: "OTLP gRPC endpoint", ptr: &c.TracingOTLPEndpoint},
+		{key: "tracing_otlp_insecure", usage: "disable TLS for the OTLP exporter", ptr: &c.TracingOTLPInsecure},
+		{key: "tracing_service_name", usage: "service.name resource attribute", ptr: &c.TracingServiceName},
+		{key: "tracing_sample_ratio", usage: "fraction of traces sampled", ptr: &c.TracingSampleRatio},
+
+		{key: "log_level", usage: "log level: debug, info, warn or error", reloadable: true, ptr: &c.LogLevel},
+		{key: "rate_limit_rps", usage: "requests per second allowed per API client, 0 to disable", reloadable: true, ptr: &c.RateLimitRPS},
+		{key: "rate_limit_burst", usage: "burst of requests allowed per API client", reloadable: true, ptr: &c.RateLimitBurst},
+		{key: "config_watch_interval", usage: "how often the config file is checked for changes, 0 to disable", ptr: &c.ConfigWatchInterval},
+	}
+}
+
+func (f *field) flagName() string {
+	return strings.ReplaceAll(f.key, "_", "-")
+}
+
+func (f *field) envNames() []string {
+	if len(f.env) > 0 {
+		return f.env
+	}
+	return []string{strings.ToUpper(f.key)}
+}
+
+// set разбирает строковое значение в тип поля
+func (f *field) set(s string) error {
+	s = strings.TrimSpace(s)
+	switch p := f.ptr.(type) {
+	case *string:
+		*p = s
+	case *int:
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		*p = v
+	case *bool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		*p = v
+	case *float64:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		*p = v
+	case *time.Duration:
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		*p = v
+	case *[]string:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*p = list
+	default:
+		return fmt.Errorf("unsupported field type %T", f.ptr)
+	}
+	return nil
+}
+
+// value возвращает текущее значение поля; секреты и пароль в DSN скрываются
+func (f *field) value() any {
+	switch p := f.ptr.(type) {
+	case *string:
+		if *p != "" && f.secret {
+			if u, err := url.Parse(*p); err == nil && u.User != nil {
+				return u.Redacted()
+			}
+			return "[REDACTED]"
+		}
+		return *p
+	case *int:
+		return *p
+	case *bool:
+		return *p
+	case *float64:
+		return *p
+	case *time.Duration:
+		return p.String()
+	case *[]string:
+		return *p
+	}
+	return nil
+}
+
+// loadEnv применяет переменные окружения поверх текущих значений.
+// Некорректные значения не игнорируются, а возвращаются как ошибки
+func (c *Config) loadEnv() []error {
+	var errs []error
+	for _, f := range c.fields() {
+		for _, name := range f.envNames() {
+			s, ok := os.LookupEnv(name)
+			if !ok || s == "" {
+				continue
+			}
+			if err := f.set(s); err != nil {
+				errs = append(errs, fmt.Errorf("env %s: %w", name, err))
+			}
+			break
+		}
+	}
+	return errs
+}
+
+// Change - изменение одной настройки между двумя версиями конфигурации
+type Change struct {
+	Key        string
+	Old        any
+	New        any
+	Reloadable bool
+}
+
+// Diff возвращает изменившиеся настройки; значения секретов скрыты
+func Diff(old, updated *Config) []Change {
+	oldFields, newFields := old.fields(), updated.fields()
+
+	var changes []Change
+	for i, f := range oldFields {
+		if reflect.DeepEqual(reflect.ValueOf(f.ptr).Elem().Interface(), reflect.ValueOf(newFields[i].ptr).Elem().Interface()) {
+			continue
+		}
+		changes = append(changes, Change{Key: f.key, Old: f.value(), New: newFields[i].value(), Reloadable: f.reloadable})
+	}
+	return changes
+}
+
+// ApplyReloadable возвращает копию current, в которой значения перезагружаемых настроек взяты из updated.
+// Остальные настройки применяются только при перезапуске, поэтому их изменения остаются в следующей разнице
+func ApplyReloadable(current, updated *Config) *Config {
+	next := *current
+	nextFields, newFields := next.fields(), updated.fields()
+	for i, f := range nextFields {
+		if f.reloadable {
+			reflect.ValueOf(f.ptr).Elem().Set(reflect.ValueOf(newFields[i].ptr).Elem())
+		}
+	}
+	return &next
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+)
+
+// Validate проверяет конфигурацию целиком и возвращает все найденные ошибки вместе
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if u, err := url.Parse(c.DatabaseURL); err != nil {
+		errs = append(errs, fmt.Errorf("database_url: %w", err))
+	} else {
+		check(u.Scheme == "postgres" || u.Scheme == "postgresql", "database_url: scheme must be postgres or postgresql")
+	}
+	check(c.PostgresPort > 0 && c.PostgresPort <= 65535, "postgres_port: must be between 1 and 65535, got %d", c.PostgresPort)
+	check(c.DBConnectTimeout > 0, "db_connect_timeout: must be positive")
+	check(c.DBAttemptTimeout > 0, "db_attempt_timeout: must be positive")
+	check(c.DBMaxRetryInterval > 0, "db_max_retry_interval: must be positive")
+	check(c.MigrateLockTimeout > 0, "migrate_lock_timeout: must be positive")
+
+	check(c.CacheCapacity > 0, "cache_capacity: must be positive, got %d", c.CacheCapacity)
+	check(c.CacheNumShards > 0, "cache_num_shards: must be positive, got %d", c.CacheNumShards)
+
+	errs = append(errs, validatePort("http_port", c.HTTPPort), validatePort("metrics_port", c.MetricsPort), validatePort("grpc_port", c.GRPCPort))
+	check(c.HTTPPort != c.MetricsPort, "metrics_port: must differ from http_port")
+	check(c.GRPCPort != c.HTTPPort && c.GRPCPort != c.MetricsPort, "grpc_port: must differ from http_port and metrics_port")
+	check(c.HTTPReadTimeout >= 0, "http_read_timeout: must not be negative")
+	check(c.HTTPWriteTimeout >= 0, "http_write_timeout: must not be negative")
+	check(c.HTTPIdleTimeout >= 0, "http_idle_timeout: must not be negative")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout: must be positive")
+	check(c.ShutdownDrainDelay >= 0, "shutdown_drain_delay: must not be negative")
+	check(c.StaticDir != "", "static_dir: must not be empty")
+	check(c.AuditBufferSize > 0, "audit_buffer_size: must be positive, got %d", c.AuditBufferSize)
+
+	check(len(c.KafkaBrokers) > 0, "kafka_brokers: at least one broker is required")
+	check(c.KafkaTopic != "", "kafka_topic: must not be empty")
+	check(c.KafkaGroupID != "", "kafka_group_id: must not be empty")
+	check(c.KafkaMinBytes > 0, "kafka_min_bytes: must be positive")
+	check(c.KafkaMaxBytes >= c.KafkaMinBytes, "kafka_max_bytes: must not be less than kafka_min_bytes")
+	check(c.KafkaClientTimeout > 0, "kafka_client_timeout: must be positive")
+	check(c.KafkaLagSampleInterval > 0, "kafka_lag_sample_interval: must be positive")
+	check(c.KafkaLagThreshold >= 0, "kafka_lag_threshold: must not be negative")
+	check(c.KafkaLagMaxDuration >= 0, "kafka_lag_max_duration: must not be negative")
+
+	check(c.PIIReencryptInterval >= 0, "pii_reencrypt_interval: must not be negative")
+	check(c.PIIReencryptBatch > 0, "pii_reencrypt_batch: must be positive, got %d", c.PIIReencryptBatch)
+
+	check(!c.AuthEnabled || c.AuthAPIKeys != "" || c.AuthJWKSFile != "", "auth_enabled: requires auth_api_keys or auth_jwks_file")
+
+	switch c.TracingExporter {
+	case "none", "stdout", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("tracing_exporter: unknown exporter %q, expected none, stdout or otlp", c.TracingExporter))
+	}
+	check(c.TracingExporter != "otlp" || c.TracingOTLPEndpoint != "", "tracing_otlp_endpoint: required for the otlp exporter")
+	check(c.TracingSampleRatio >= 0 && c.TracingSampleRatio <= 1, "tracing_sample_ratio: must be between 0 and 1, got %g", c.TracingSampleRatio)
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("log_level: unknown level %q, expected debug, info, warn or error", c.LogLevel))
+	}
+	check(c.RateLimitRPS >= 0, "rate_limit_rps: must not be negative")
+	check(c.RateLimitBurst > 0, "rate_limit_burst: must be positive, got %d", c.RateLimitBurst)
+	check(c.ConfigWatchInterval >= 0, "config_watch_interval: must not be negative")
+
+	return errors.Join(errs...)
+}
+
+func validatePort(key, port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("%s: must be a port number between 1 and 65535, got %q", key, port)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// blindTokenSize - сколько байт HMAC остаётся в метке: коллизии при таком размере пренебрежимы
+const blindTokenSize = 16
+
+// BlindIndex вычисляет поисковые метки для зашифрованных полей - HMAC-SHA256 нормализованного значения.
+// Метка не раскрывает значение, но совпадает у одинаковых значений, поэтому по ней ищут точным совпадением.
+// Ключ индекса отделён от мастер-ключей и не меняется при их ротации, иначе пришлось бы пересчитывать все метки
+type BlindIndex struct {
+	key []byte
+}
+
+// NewBlindIndex создает индекс с ключом не короче KeySize байт
+func NewBlindIndex(key []byte) (*BlindIndex, error) {
+	if len(key) < KeySize {
+		return nil, fmt.Errorf("blind index key must be at least %d bytes, got %d", KeySize, len(key))
+	}
+	return &BlindIndex{key: key}, nil
+}
+
+// LoadBlindIndex разбирает ключ индекса в base64. Пустая строка возвращает nil - индекс выключен
+func LoadBlindIndex(encoded string) (*BlindIndex, error) {
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("blind index key is not valid base64: %w", err)
+	}
+	return NewBlindIndex(key)
+}
+
+// Token возвращает метку значения value. kind разделяет пространства меток, чтобы,
+// например, слово и номер телефона из одних и тех же цифр давали разные метки
+func (b *BlindIndex) Token(kind, value string) string {
+	mac := hmac.New(sha256.New, b.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil)[:blindTokenSize])
+}
@@ -0,0 +1,230 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// KeySize - размер ключа AES-256 в байтах
+const KeySize = 32
+
+var ErrUnknownKey = errors.New("unknown encryption key id")
+
+// Keyring хранит мастер-ключи (KEK), которыми оборачиваются ключи данных.
+// Новые записи шифруются активным ключом, старые ключи нужны для чтения и ротации
+type Keyring struct {
+	activeID string
+	keks     map[string]cipher.AEAD
+}
+
+// NewKeyring создает связку ключей. Если activeID пуст и ключ один, он становится активным
+func NewKeyring(activeID string, keys map[string][]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no encryption keys provided")
+	}
+	if activeID == "" {
+		if len(keys) > 1 {
+			return nil, errors.New("active key id is required when several keys are configured")
+		}
+		for id := range keys {
+			activeID = id
+		}
+	}
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("active key %q not found: %w", activeID, ErrUnknownKey)
+	}
+
+	kr := &Keyring{activeID: activeID, keks: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", id, err)
+		}
+		kr.keks[id] = aead
+	}
+
+	return kr, nil
+}
+
+// Load собирает связку ключей из файла и/или строки вида "id1:base64,id2:base64".
+// Если ни один источник не задан, возвращает nil - шифрование выключено
+func Load(keyFile, envKeys, activeID string) (*Keyring, error) {
+	keys := make(map[string][]byte)
+
+	if keyFile != "" {
+		f, err := os.Open(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open key file: %w", err)
+		}
+		defer f.Close()
+
+		if err := parseKeys(f, keys); err != nil {
+			return nil, fmt.Errorf("failed to parse key file %s: %w", keyFile, err)
+		}
+	}
+
+	if envKeys != "" {
+		r := strings.NewReader(strings.ReplaceAll(envKeys, ",", "\n"))
+		if err := parseKeys(r, keys); err != nil {
+			return nil, fmt.Errorf("failed to parse keys from env: %w", err)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return NewKeyring(activeID, keys)
+}
+
+// parseKeys читает строки "id:base64key", пустые строки и комментарии (#) пропускаются
+func parseKeys(r io.Reader, keys map[string][]byte) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(line, ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return fmt.Errorf("malformed key line, expected <id>:<base64 key>")
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return fmt.Errorf("key %q is not valid base64: %w", id, err)
+		}
+		if len(key) != KeySize {
+			return fmt.Errorf("key %q must be %d bytes, got %d", id, KeySize, len(key))
+		}
+		keys[id] = key
+	}
+
+	return scanner.Err()
+}
+
+// ActiveKeyID возвращает идентификатор ключа, которым шифруются новые записи
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// KeyIDs возвращает отсортированный список идентификаторов всех ключей
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.keks))
+	for id := range k.keks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// NewDataKey генерирует новый ключ данных и оборачивает его активным мастер-ключом
+func (k *Keyring) NewDataKey() (*DataKey, error) {
+	raw := make([]byte, KeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrapped, err := seal(k.keks[k.activeID], raw, []byte(k.activeID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataKey{KeyID: k.activeID, Wrapped: wrapped, aead: aead}, nil
+}
+
+// OpenDataKey разворачивает сохранённый ключ данных мастер-ключом keyID
+func (k *Keyring) OpenDataKey(keyID string, wrapped []byte) (*DataKey, error) {
+	kek, ok := k.keks[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %q: %w", keyID, ErrUnknownKey)
+	}
+
+	raw, err := open(kek, wrapped, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataKey{KeyID: keyID, Wrapped: wrapped, aead: aead}, nil
+}
+
+// DataKey - ключ данных одной записи вместе с его обёрнутой формой для хранения
+type DataKey struct {
+	KeyID   string
+	Wrapped []byte
+	aead    cipher.AEAD
+}
+
+// Encrypt шифрует строку, привязывая шифротекст к контексту aad (например, UID заказа и имя поля)
+func (dk *DataKey) Encrypt(plaintext, aad string) (string, error) {
+	ct, err := seal(dk.aead, []byte(plaintext), []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ct), nil
+}
+
+// Decrypt расшифровывает строку, зашифрованную Encrypt с тем же aad
+func (dk *DataKey) Decrypt(ciphertext, aad string) (string, error) {
+	ct, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("ciphertext is not valid base64: %w", err)
+	}
+
+	pt, err := open(dk.aead, ct, []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return string(pt), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal шифрует данные и добавляет случайный nonce в начало результата
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open отделяет nonce и расшифровывает данные
+func open(aead cipher.AEAD, ciphertext, aad []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, data := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+
+	pt, err := aead.Open(nil, nonce, data, aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return pt, nil
+}
@@ -0,0 +1,111 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestKeyring(t *testing.T) {
+	t.Run("Encrypt and decrypt", func(t *testing.T) {
+		kr, err := NewKeyring("", map[string][]byte{"k1": testKey(1)})
+		require.NoError(t, err)
+		require.Equal(t, "k1", kr.ActiveKeyID(), "Единственный ключ должен стать активным")
+
+		dk, err := kr.NewDataKey()
+		require.NoError(t, err)
+
+		ct, err := dk.Encrypt("+79001234567", "order1/phone")
+		require.NoError(t, err)
+		require.NotContains(t, ct, "79001234567", "Шифротекст не должен содержать исходное значение")
+
+		opened, err := kr.OpenDataKey(dk.KeyID, dk.Wrapped)
+		require.NoError(t, err)
+		pt, err := opened.Decrypt(ct, "order1/phone")
+		require.NoError(t, err)
+		require.Equal(t, "+79001234567", pt)
+
+		_, err = opened.Decrypt(ct, "order2/phone")
+		require.Error(t, err, "Шифротекст не должен расшифровываться в чужом контексте")
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		oldRing, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+		require.NoError(t, err)
+		dk, err := oldRing.NewDataKey()
+		require.NoError(t, err)
+		ct, err := dk.Encrypt("Test Testov", "order1/name")
+		require.NoError(t, err)
+
+		newRing, err := NewKeyring("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+		require.NoError(t, err)
+
+		opened, err := newRing.OpenDataKey(dk.KeyID, dk.Wrapped)
+		require.NoError(t, err, "Старый ключ должен оставаться доступным для чтения")
+		pt, err := opened.Decrypt(ct, "order1/name")
+		require.NoError(t, err)
+		require.Equal(t, "Test Testov", pt)
+
+		fresh, err := newRing.NewDataKey()
+		require.NoError(t, err)
+		require.Equal(t, "k2", fresh.KeyID, "Новые ключи данных должны оборачиваться активным ключом")
+
+		_, err = oldRing.OpenDataKey(fresh.KeyID, fresh.Wrapped)
+		require.ErrorIs(t, err, ErrUnknownKey)
+	})
+
+	t.Run("Ambiguous active key", func(t *testing.T) {
+		_, err := NewKeyring("", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+		require.Error(t, err)
+	})
+}
+
+func TestLoad(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "keys")
+	content := "# pii keys\nk1:" + base64.StdEncoding.EncodeToString(testKey(1)) + "\n"
+	require.NoError(t, os.WriteFile(keyFile, []byte(content), 0o600))
+
+	kr, err := Load(keyFile, "k2:"+base64.StdEncoding.EncodeToString(testKey(2)), "k2")
+	require.NoError(t, err)
+	require.Equal(t, []string{"k1", "k2"}, kr.KeyIDs())
+	require.Equal(t, "k2", kr.ActiveKeyID())
+
+	kr, err = Load("", "", "")
+	require.NoError(t, err)
+	require.Nil(t, kr, "Без ключей шифрование должно быть выключено")
+
+	_, err = Load("", "k1:c2hvcnQ=", "")
+	require.Error(t, err, "Ключ неверной длины должен отклоняться")
+}
+
+func TestBlindIndex(t *testing.T) {
+	bi, err := NewBlindIndex(testKey(1))
+	require.NoError(t, err)
+
+	token := bi.Token("word", "ivanov")
+	require.Equal(t, token, bi.Token("word", "ivanov"), "Метка должна быть детерминированной")
+	require.NotContains(t, token, "ivanov")
+	require.NotEqual(t, token, bi.Token("phone", "ivanov"), "Разные виды значений должны давать разные метки")
+
+	other, err := NewBlindIndex(testKey(2))
+	require.NoError(t, err)
+	require.NotEqual(t, token, other.Token("word", "ivanov"), "Метка должна зависеть от ключа")
+
+	_, err = NewBlindIndex([]byte("short"))
+	require.Error(t, err)
+
+	disabled, err := LoadBlindIndex("")
+	require.NoError(t, err)
+	require.Nil(t, disabled, "Без ключа индекс выключен")
+	loaded, err := LoadBlindIndex(base64.StdEncoding.EncodeToString(testKey(1)))
+	require.NoError(t, err)
+	require.Equal(t, token, loaded.Token("word", "ivanov"))
+}
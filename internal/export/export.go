@@ -0,0 +1,247 @@
+// Package export записывает строки выгрузки заказов в CSV, NDJSON и Parquet
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"test_task_wb/internal/storage"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRowGroupSize - сколько строк копится в памяти до записи группы строк Parquet
+const parquetRowGroupSize = 50_000
+
+// Format - формат файла выгрузки
+type Format string
+
+const (
+	CSV     Format = "csv"
+	NDJSON  Format = "ndjson"
+	Parquet Format = "parquet"
+)
+
+// ParseFormat проверяет название формата
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case CSV, NDJSON, Parquet:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown export format %q: must be csv, ndjson or parquet", s)
+}
+
+// ContentType возвращает MIME-тип формата
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case NDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/vnd.apache.parquet"
+	}
+}
+
+// Compression - сжатие файла выгрузки. Parquet сжимается по столбцам внутри файла
+type Compression string
+
+const (
+	None Compression = "none"
+	Gzip Compression = "gzip"
+	Zstd Compression = "zstd"
+)
+
+// ParseCompression проверяет название алгоритма сжатия
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(s); c {
+	case None, Gzip, Zstd:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown compression %q: must be none, gzip or zstd", s)
+}
+
+// Extension возвращает расширение файла с учётом сжатия, например ".csv.gz"
+func Extension(f Format, c Compression) string {
+	ext := "." + string(f)
+	if f == Parquet {
+		return ext
+	}
+	switch c {
+	case Gzip:
+		ext += ".gz"
+	case Zstd:
+		ext += ".zst"
+	}
+	return ext
+}
+
+// Writer пишет строки выгрузки. Close дописывает буферы и служебные данные формата,
+// но не закрывает исходный io.Writer
+type Writer interface {
+	Write(storage.ExportRow) error
+	Close() error
+}
+
+// NewWriter создаёт Writer формата f поверх w
+func NewWriter(w io.Writer, f Format, c Compression) (Writer, error) {
+	if f == Parquet {
+		return newParquetWriter(w, c)
+	}
+
+	var compressor io.WriteCloser
+	switch c {
+	case None:
+	case Gzip:
+		compressor = gzip.NewWriter(w)
+	case Zstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		compressor = zw
+	default:
+		return nil, fmt.Errorf("unknown compression %q", c)
+	}
+	if compressor != nil {
+		w = compressor
+	}
+
+	buf := bufio.NewWriter(w)
+	switch f {
+	case CSV:
+		cw := csv.NewWriter(buf)
+		if err := cw.Write(csvColumns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: cw, buf: buf, compressor: compressor}, nil
+	case NDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(buf), buf: buf, compressor: compressor}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", f)
+	}
+}
+
+// csvColumns - заголовок CSV, порядок совпадает с csvRecord
+var csvColumns = []string{
+	"order_uid", "track_number", "entry", "locale", "customer_id", "delivery_service", "date_created",
+	"city", "region", "zip",
+	"transaction", "currency", "provider", "bank", "amount", "payment_dt", "delivery_cost", "goods_total", "custom_fee",
+	"chrt_id", "nm_id", "rid", "item_name", "brand", "size", "price", "sale", "total_price", "status",
+}
+
+func csvRecord(r storage.ExportRow) []string {
+	return []string{
+		r.OrderUID, r.TrackNumber, r.Entry, r.Locale, r.CustomerID, r.DeliveryService, r.DateCreated.Format(time.RFC3339),
+		r.City, r.Region, r.Zip,
+		r.Transaction, r.Currency, r.Provider, r.Bank, strconv.Itoa(r.Amount), strconv.FormatInt(r.PaymentDt, 10),
+		strconv.Itoa(r.DeliveryCost), strconv.Itoa(r.GoodsTotal), strconv.Itoa(r.CustomFee),
+		strconv.Itoa(r.ChrtID), strconv.Itoa(r.NmID), r.Rid, r.ItemName, r.Brand, r.Size,
+		strconv.Itoa(r.Price), strconv.Itoa(r.Sale), strconv.Itoa(r.TotalPrice), strconv.Itoa(r.Status),
+	}
+}
+
+type csvWriter struct {
+	w          *csv.Writer
+	buf        *bufio.Writer
+	compressor io.WriteCloser
+}
+
+func (w *csvWriter) Write(r storage.ExportRow) error {
+	return w.w.Write(csvRecord(r))
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	if err := w.w.Error(); err != nil {
+		return err
+	}
+	return finish(w.buf, w.compressor)
+}
+
+type ndjsonWriter struct {
+	enc        *json.Encoder
+	buf        *bufio.Writer
+	compressor io.WriteCloser
+}
+
+func (w *ndjsonWriter) Write(r storage.ExportRow) error {
+	return w.enc.Encode(r)
+}
+
+func (w *ndjsonWriter) Close() error {
+	return finish(w.buf, w.compressor)
+}
+
+// finish сбрасывает буфер и закрывает сжатие, дописывая его окончание
+func finish(buf *bufio.Writer, compressor io.WriteCloser) error {
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if compressor != nil {
+		return compressor.Close()
+	}
+	return nil
+}
+
+// parquetWriter копит строки и сбрасывает их группами, чтобы весь файл не держался в памяти
+type parquetWriter struct {
+	w       *parquet.GenericWriter[storage.ExportRow]
+	pending []storage.ExportRow
+	rows    int
+}
+
+func newParquetWriter(w io.Writer, c Compression) (*parquetWriter, error) {
+	var opts []parquet.WriterOption
+	switch c {
+	case None:
+	case Gzip:
+		opts = append(opts, parquet.Compression(&parquet.Gzip))
+	case Zstd:
+		opts = append(opts, parquet.Compression(&parquet.Zstd))
+	default:
+		return nil, fmt.Errorf("unknown compression %q", c)
+	}
+	return &parquetWriter{
+		w:       parquet.NewGenericWriter[storage.ExportRow](w, opts...),
+		pending: make([]storage.ExportRow, 0, 1024),
+	}, nil
+}
+
+func (w *parquetWriter) Write(r storage.ExportRow) error {
+	w.pending = append(w.pending, r)
+	if len(w.pending) < cap(w.pending) {
+		return nil
+	}
+	return w.flushPending()
+}
+
+func (w *parquetWriter) flushPending() error {
+	n, err := w.w.Write(w.pending)
+	if err != nil {
+		return fmt.Errorf("failed to write parquet rows: %w", err)
+	}
+	w.rows += n
+	w.pending = w.pending[:0]
+
+	if w.rows >= parquetRowGroupSize {
+		w.rows = 0
+		return w.w.Flush()
+	}
+	return nil
+}
+
+func (w *parquetWriter) Close() error {
+	if len(w.pending) > 0 {
+		if err := w.flushPending(); err != nil {
+			return err
+		}
+	}
+	return w.w.Close()
+}
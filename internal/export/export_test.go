@@ -0,0 +1,117 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"test_task_wb/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/require"
+)
+
+func testRows(n int) []storage.ExportRow {
+	rows := make([]storage.ExportRow, n)
+	for i := range rows {
+		rows[i] = storage.ExportRow{
+			OrderUID:    "b563feb7b2b84b6test",
+			DateCreated: time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC),
+			Currency:    "USD",
+			Amount:      1817,
+			ChrtID:      i + 1,
+			ItemName:    "Mascaras, \"black\"",
+			Brand:       "Vivienne Sabo",
+			TotalPrice:  317,
+		}
+	}
+	return rows
+}
+
+func write(t *testing.T, f Format, c Compression, rows []storage.ExportRow) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, f, c)
+	require.NoError(t, err)
+	for _, r := range rows {
+		require.NoError(t, w.Write(r))
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestWriter_CSV(t *testing.T) {
+	rows := testRows(2)
+	data := write(t, CSV, Gzip, rows)
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	records, err := csv.NewReader(zr).ReadAll()
+	require.NoError(t, err)
+
+	require.Len(t, records, 3, "Ожидается заголовок и по строке на товар")
+	require.Equal(t, csvColumns, records[0])
+	require.Len(t, records[1], len(csvColumns), "Число значений должно совпадать с заголовком")
+	require.Equal(t, "2025-03-01T10:00:00Z", records[1][6])
+	require.Equal(t, `Mascaras, "black"`, records[1][22], "Значения с запятыми и кавычками должны экранироваться")
+}
+
+func TestWriter_NDJSON(t *testing.T) {
+	rows := testRows(3)
+	data := write(t, NDJSON, Zstd, rows)
+
+	zr, err := zstd.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	defer zr.Close()
+
+	var got []storage.ExportRow
+	sc := bufio.NewScanner(zr)
+	for sc.Scan() {
+		var r storage.ExportRow
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &r), "Каждая строка должна быть отдельным JSON-объектом")
+		got = append(got, r)
+	}
+	require.NoError(t, sc.Err())
+	require.Equal(t, rows, got)
+}
+
+func TestWriter_Parquet(t *testing.T) {
+	// строк больше, чем помещается в один буфер, чтобы проверить запись порциями
+	rows := testRows(2500)
+	data := write(t, Parquet, Zstd, rows)
+
+	got, err := parquet.Read[storage.ExportRow](bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	require.Len(t, got, len(rows))
+	require.Equal(t, rows[0], got[0])
+	require.Equal(t, rows[len(rows)-1], got[len(got)-1])
+}
+
+func TestWriter_Empty(t *testing.T) {
+	data := write(t, CSV, None, nil)
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{csvColumns}, records, "Пустая выгрузка должна содержать только заголовок")
+
+	data = write(t, NDJSON, None, nil)
+	require.Empty(t, data)
+
+	data = write(t, Parquet, None, nil)
+	got, err := parquet.Read[storage.ExportRow](bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
+
+func TestParse(t *testing.T) {
+	_, err := ParseFormat("xlsx")
+	require.Error(t, err)
+	_, err = ParseCompression("lz4")
+	require.Error(t, err)
+
+	require.Equal(t, ".csv.gz", Extension(CSV, Gzip))
+	require.Equal(t, ".ndjson.zst", Extension(NDJSON, Zstd))
+	require.Equal(t, ".parquet", Extension(Parquet, Gzip), "Parquet сжимается внутри файла")
+}
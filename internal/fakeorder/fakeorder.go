@@ -0,0 +1,173 @@
+// Package fakeorder генерирует правдоподобные заказы для тестов, бенчмарков и паблишера.
+// Заказы проходят валидацию model.Order и сходятся по суммам (см. Check)
+package fakeorder
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"test_task_wb/internal/model"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+// Generator выдаёт последовательность заказов, которая при одном seed и одних часах
+// всегда одинакова. Не потокобезопасен: каждой горутине нужен свой генератор
+type Generator struct {
+	seed     uint64
+	faker    *gofakeit.Faker
+	rnd      *rand.Rand
+	minItems int
+	maxItems int
+	locales  []string
+	now      func() time.Time
+}
+
+// Option настраивает Generator
+type Option func(*Generator)
+
+// WithSeed задаёт seed. Без него seed выбирается случайно, узнать его можно через Seed
+func WithSeed(seed uint64) Option {
+	return func(g *Generator) {
+		g.seed = seed
+	}
+}
+
+// WithItems задаёт диапазон числа товаров в заказе (включительно)
+func WithItems(minItems, maxItems int) Option {
+	return func(g *Generator) {
+		g.minItems, g.maxItems = minItems, maxItems
+	}
+}
+
+// WithLocales задаёт локали, из которых случайно выбирается локаль заказа (см. Locales)
+func WithLocales(locales ...string) Option {
+	return func(g *Generator) {
+		g.locales = locales
+	}
+}
+
+// WithClock задаёт источник текущего времени для date_created и payment_dt.
+// Вместе с WithSeed делает заказы полностью воспроизводимыми
+func WithClock(now func() time.Time) Option {
+	return func(g *Generator) {
+		g.now = now
+	}
+}
+
+// New создает генератор. По умолчанию заказ содержит от 1 до 5 товаров в локали "en"
+func New(opts ...Option) (*Generator, error) {
+	g := &Generator{
+		seed:     rand.Uint64(),
+		minItems: 1,
+		maxItems: 5,
+		locales:  []string{"en"},
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	var errs []error
+	if g.minItems < 1 || g.maxItems < g.minItems {
+		errs = append(errs, fmt.Errorf("invalid item count range %d-%d", g.minItems, g.maxItems))
+	}
+	if len(g.locales) == 0 {
+		errs = append(errs, errors.New("at least one locale is required"))
+	}
+	for _, l := range g.locales {
+		if _, ok := locales[l]; !ok {
+			errs = append(errs, fmt.Errorf("unknown locale %q, expected one of %v", l, Locales()))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	g.faker = gofakeit.New(g.seed)
+	g.rnd = rand.New(rand.NewPCG(g.seed, g.seed^0x9e3779b97f4a7c15))
+	return g, nil
+}
+
+// Seed возвращает seed, с которым создан генератор
+func (g *Generator) Seed() uint64 {
+	return g.seed
+}
+
+// Order создает валидный заказ со сходящимися суммами
+func (g *Generator) Order() model.Order {
+	f := g.faker
+	loc := locales[g.locales[g.rnd.IntN(len(g.locales))]]
+	orderUID := f.Password(true, false, true, false, false, 20)
+	trackNumber := "WBILM" + f.Password(false, true, false, false, false, 10)
+	now := g.now()
+
+	items := make([]model.Item, g.minItems+g.rnd.IntN(g.maxItems-g.minItems+1))
+	for i := range items {
+		price := f.Number(100, 5000)
+		sale := saleSteps[g.rnd.IntN(len(saleSteps))]
+		items[i] = model.Item{
+			ChrtID:      f.Number(1000000, 9999999),
+			TrackNumber: trackNumber,
+			Price:       price,
+			Rid:         f.Password(true, false, true, false, false, 21),
+			Name:        f.ProductName(),
+			Sale:        sale,
+			Size:        sizes[g.rnd.IntN(len(sizes))],
+			TotalPrice:  ItemTotal(price, sale),
+			NmID:        f.Number(1000000, 9999999),
+			Brand:       f.Company(),
+			Status:      202,
+		}
+	}
+
+	// пошлина начисляется примерно на каждый пятый заказ
+	customFee := 0
+	if g.rnd.IntN(5) == 0 {
+		customFee = f.Number(50, 500)
+	}
+
+	order := model.Order{
+		OrderUID:    orderUID,
+		TrackNumber: trackNumber,
+		Entry:       "WBIL",
+		Delivery:    loc.delivery(f, g.rnd),
+		Payment: model.Payment{
+			Transaction:  orderUID,
+			Currency:     loc.currency,
+			Provider:     "wbpay",
+			PaymentDt:    now.Add(-time.Duration(g.rnd.IntN(3600)) * time.Second).Unix(),
+			Bank:         banks[g.rnd.IntN(len(banks))],
+			DeliveryCost: f.Number(0, 1500),
+			CustomFee:    customFee,
+		},
+		Items:           items,
+		Locale:          loc.code,
+		CustomerID:      "cust" + f.Password(true, false, true, false, false, 10),
+		DeliveryService: deliveryServices[g.rnd.IntN(len(deliveryServices))],
+		Shardkey:        fmt.Sprintf("%d", f.Number(1, 10)),
+		SmID:            f.Number(1, 100),
+		DateCreated:     now,
+		OofShard:        fmt.Sprintf("%d", f.Number(1, 10)),
+	}
+	Reconcile(&order)
+	return order
+}
+
+// Orders создает n заказов
+func (g *Generator) Orders(n int) []model.Order {
+	orders := make([]model.Order, n)
+	for i := range orders {
+		orders[i] = g.Order()
+	}
+	return orders
+}
+
+var (
+	saleSteps        = []int{0, 0, 5, 10, 15, 20, 25, 30, 40, 50, 70}
+	sizes            = []string{"0", "S", "M", "L", "XL", "42", "44"}
+	banks            = []string{"alpha", "sber", "tinkoff", "vtb"}
+	deliveryServices = []string{"meest", "cdek", "boxberry", "dhl"}
+)
@@ -0,0 +1,83 @@
+package fakeorder
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGenerator(t *testing.T, opts ...Option) *Generator {
+	t.Helper()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	g, err := New(append([]Option{WithSeed(42), WithClock(func() time.Time { return now })}, opts...)...)
+	require.NoError(t, err)
+	return g
+}
+
+func TestGenerator(t *testing.T) {
+	validate := validator.New()
+
+	t.Run("Orders are valid and consistent", func(t *testing.T) {
+		g := newTestGenerator(t, WithLocales("en", "ru"), WithItems(1, 8))
+		for _, order := range g.Orders(200) {
+			require.NoError(t, validate.Struct(order), "сгенерированный заказ должен проходить валидацию")
+			require.NoError(t, Check(order), "суммы сгенерированного заказа должны сходиться")
+			require.GreaterOrEqual(t, len(order.Items), 1)
+			require.LessOrEqual(t, len(order.Items), 8)
+		}
+	})
+
+	t.Run("Same seed gives same orders", func(t *testing.T) {
+		a := newTestGenerator(t, WithLocales("en", "ru")).Orders(20)
+		b := newTestGenerator(t, WithLocales("en", "ru")).Orders(20)
+		require.Equal(t, a, b, "при одном seed и одних часах заказы должны совпадать")
+	})
+
+	t.Run("Locale", func(t *testing.T) {
+		order := newTestGenerator(t, WithLocales("ru")).Order()
+		require.Equal(t, "ru", order.Locale)
+		require.Equal(t, "RUB", order.Payment.Currency)
+		require.Regexp(t, `^\+79\d{9}$`, order.Delivery.Phone)
+	})
+
+	t.Run("Invalid options", func(t *testing.T) {
+		_, err := New(WithItems(0, 3), WithLocales("de"))
+		require.ErrorContains(t, err, "item count")
+		require.ErrorContains(t, err, `unknown locale "de"`)
+	})
+}
+
+func TestMutations(t *testing.T) {
+	validate := validator.New()
+	g := newTestGenerator(t)
+
+	for _, m := range ValidationMutations() {
+		t.Run(m.Name, func(t *testing.T) {
+			order := g.Order()
+			m.Apply(&order)
+
+			var verrs validator.ValidationErrors
+			require.True(t, errors.As(validate.Struct(order), &verrs), "заказ должен перестать проходить валидацию")
+			require.Len(t, verrs, 1, "мутация должна ломать ровно одно правило валидации")
+			require.NoError(t, Check(order), "суммы после мутации должны сходиться")
+		})
+	}
+
+	for _, m := range ConsistencyMutations() {
+		t.Run(m.Name, func(t *testing.T) {
+			order := g.Order()
+			m.Apply(&order)
+
+			require.NoError(t, validate.Struct(order), "заказ должен проходить валидацию")
+			err := Check(order)
+			require.Error(t, err, "суммы после мутации не должны сходиться")
+			require.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 1, "мутация должна ломать ровно одну сверку")
+			field := m.Field[strings.LastIndex(m.Field, ".")+1:]
+			require.ErrorContains(t, err, field, "расхождение должно быть в поле мутации")
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package fakeorder
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+
+	"test_task_wb/internal/model"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+// locale определяет, как выглядят данные доставки и валюта заказа
+type locale struct {
+	code     string
+	currency string
+	delivery func(f *gofakeit.Faker, rnd *rand.Rand) model.Delivery
+}
+
+var locales = map[string]locale{
+	"en": {code: "en", currency: "USD", delivery: englishDelivery},
+	"ru": {code: "ru", currency: "RUB", delivery: russianDelivery},
+}
+
+// Locales возвращает коды поддерживаемых локалей
+func Locales() []string {
+	codes := make([]string, 0, len(locales))
+	for code := range locales {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func englishDelivery(f *gofakeit.Faker, _ *rand.Rand) model.Delivery {
+	return model.Delivery{
+		Name:    f.Name(),
+		Phone:   fmt.Sprintf("+1%d%07d", f.Number(201, 989), f.Number(0, 9999999)),
+		Zip:     fmt.Sprintf("%05d", f.Number(1001, 99950)),
+		City:    f.City(),
+		Address: f.StreetNumber() + " " + f.StreetName(),
+		Region:  f.State(),
+		Email:   f.Email(),
+	}
+}
+
+func russianDelivery(f *gofakeit.Faker, rnd *rand.Rand) model.Delivery {
+	city := russianCities[rnd.IntN(len(russianCities))]
+	return model.Delivery{
+		Name:    russianFirstNames[rnd.IntN(len(russianFirstNames))] + " " + russianLastNames[rnd.IntN(len(russianLastNames))],
+		Phone:   fmt.Sprintf("+7%d%07d", f.Number(900, 999), f.Number(0, 9999999)),
+		Zip:     fmt.Sprintf("%06d", f.Number(101000, 692999)),
+		City:    city.name,
+		Address: fmt.Sprintf("ул. %s, д. %d", russianStreets[rnd.IntN(len(russianStreets))], f.Number(1, 150)),
+		Region:  city.region,
+		Email:   f.Email(),
+	}
+}
+
+var (
+	russianFirstNames = []string{"Иван", "Алексей", "Дмитрий", "Сергей", "Анна", "Мария", "Елена", "Ольга"}
+	russianLastNames  = []string{"Иванов", "Смирнов", "Кузнецов", "Попов", "Соколова", "Лебедева", "Козлова", "Новикова"}
+	russianStreets    = []string{"Ленина", "Мира", "Садовая", "Советская", "Лесная", "Школьная", "Набережная"}
+	russianCities     = []struct{ name, region string }{
+		{"Москва", "Москва"},
+		{"Санкт-Петербург", "Санкт-Петербург"},
+		{"Казань", "Республика Татарстан"},
+		{"Екатеринбург", "Свердловская область"},
+		{"Новосибирск", "Новосибирская область"},
+		{"Нижний Новгород", "Нижегородская область"},
+	}
+)
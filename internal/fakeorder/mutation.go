@@ -0,0 +1,107 @@
+package fakeorder
+
+import (
+	"errors"
+	"fmt"
+
+	"test_task_wb/internal/model"
+)
+
+// ItemTotal возвращает цену товара со скидкой в процентах, округлённую вниз
+func ItemTotal(price, sale int) int {
+	return price * (100 - sale) / 100
+}
+
+// Reconcile пересчитывает производные суммы заказа: total_price товаров,
+// goods_total как их сумму и amount как goods_total + delivery_cost + custom_fee
+func Reconcile(o *model.Order) {
+	for i := range o.Items {
+		o.Items[i].TotalPrice = ItemTotal(o.Items[i].Price, o.Items[i].Sale)
+	}
+	reconcilePayment(o)
+}
+
+func reconcilePayment(o *model.Order) {
+	o.Payment.GoodsTotal = 0
+	for _, item := range o.Items {
+		o.Payment.GoodsTotal += item.TotalPrice
+	}
+	o.Payment.Amount = o.Payment.GoodsTotal + o.Payment.DeliveryCost + o.Payment.CustomFee
+}
+
+// Check проверяет, что суммы заказа сходятся. Возвращает все найденные расхождения
+func Check(o model.Order) error {
+	var errs []error
+	goodsTotal := 0
+	for i, item := range o.Items {
+		if item.Sale > 100 {
+			errs = append(errs, fmt.Errorf("items[%d].sale: %d%% is more than 100%%", i, item.Sale))
+		} else if want := ItemTotal(item.Price, item.Sale); item.TotalPrice != want {
+			errs = append(errs, fmt.Errorf("items[%d].total_price: %d, expected %d for price %d and sale %d%%", i, item.TotalPrice, want, item.Price, item.Sale))
+		}
+		goodsTotal += item.TotalPrice
+	}
+	if o.Payment.GoodsTotal != goodsTotal {
+		errs = append(errs, fmt.Errorf("payment.goods_total: %d, expected sum of item totals %d", o.Payment.GoodsTotal, goodsTotal))
+	}
+	if want := o.Payment.GoodsTotal + o.Payment.DeliveryCost + o.Payment.CustomFee; o.Payment.Amount != want {
+		errs = append(errs, fmt.Errorf("payment.amount: %d, expected goods_total + delivery_cost + custom_fee = %d", o.Payment.Amount, want))
+	}
+	return errors.Join(errs...)
+}
+
+// Mutation портит в заказе ровно одно правило: либо тег валидации model.Order, либо сверку сумм из Check
+type Mutation struct {
+	Name string
+	// Field - JSON-путь испорченного поля
+	Field string
+	Apply func(o *model.Order)
+}
+
+// ValidationMutations возвращает мутации, после которых заказ не проходит валидацию,
+// но его суммы по-прежнему сходятся
+func ValidationMutations() []Mutation {
+	return []Mutation{
+		{"missing_uid", "order_uid", func(o *model.Order) { o.OrderUID = "" }},
+		{"non_alphanumeric_uid", "order_uid", func(o *model.Order) { o.OrderUID = "order-" + o.OrderUID }},
+		{"bad_email", "delivery.email", func(o *model.Order) { o.Delivery.Email = "not-an-email" }},
+		{"bad_phone", "delivery.phone", func(o *model.Order) { o.Delivery.Phone = "8-800-555-35-35" }},
+		{"bad_zip", "delivery.zip", func(o *model.Order) { o.Delivery.Zip = "ZIP" + o.Delivery.Zip }},
+		{"bad_currency", "payment.currency", func(o *model.Order) { o.Payment.Currency = "rub" }},
+		{"missing_payment_dt", "payment.payment_dt", func(o *model.Order) { o.Payment.PaymentDt = 0 }},
+		{"bad_locale", "locale", func(o *model.Order) { o.Locale = "eng" }},
+		{"non_numeric_shardkey", "shardkey", func(o *model.Order) { o.Shardkey = "shard" }},
+		{"zero_chrt_id", "items.chrt_id", func(o *model.Order) { o.Items[0].ChrtID = 0 }},
+		// без товаров суммы пересчитываются, чтобы сломанным осталось только items
+		{"no_items", "items", func(o *model.Order) {
+			o.Items = nil
+			reconcilePayment(o)
+		}},
+	}
+}
+
+// ConsistencyMutations возвращает мутации, после которых заказ проходит валидацию,
+// но одна из сумм расходится с остальными
+func ConsistencyMutations() []Mutation {
+	return []Mutation{
+		{"wrong_item_total", "items.total_price", func(o *model.Order) {
+			o.Items[0].TotalPrice++
+			reconcilePayment(o)
+		}},
+		{"wrong_goods_total", "payment.goods_total", func(o *model.Order) {
+			o.Payment.GoodsTotal++
+			o.Payment.Amount++
+		}},
+		{"wrong_amount", "payment.amount", func(o *model.Order) { o.Payment.Amount++ }},
+	}
+}
+
+// MutationByName ищет мутацию среди ValidationMutations и ConsistencyMutations
+func MutationByName(name string) (Mutation, bool) {
+	for _, m := range append(ValidationMutations(), ConsistencyMutations()...) {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Mutation{}, false
+}
@@ -0,0 +1,77 @@
+package grpcserver
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	ordersv1 "test_task_wb/api/orders/v1"
+	"test_task_wb/internal/auth"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ordersMethodPrefix - методы сервиса заказов; health и reflection доступны без аутентификации
+var ordersMethodPrefix = "/" + ordersv1.OrdersService_ServiceDesc.ServiceName + "/"
+
+func (s *Server) unaryAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamAuth(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticate кладёт вызывающего в контекст и проверяет область доступа orders:read,
+// повторяя auth.Middleware и auth.RequireScope из HTTP API
+func (s *Server) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if !strings.HasPrefix(method, ordersMethodPrefix) {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	var p *auth.Principal
+	if s.Auth == nil {
+		p = auth.Anonymous()
+	} else {
+		var err error
+		p, err = s.Auth.AuthenticateCredentials(first("x-api-key"), first("authorization"))
+		if err != nil {
+			slog.Warn("Authentication failed", "error", err, "method", method)
+			return nil, status.Error(codes.Unauthenticated, "unauthorized")
+		}
+	}
+
+	if !p.HasScope(auth.ScopeRead) {
+		slog.Warn("Access denied", "principal", p.Name, "required_scope", auth.ScopeRead, "method", method)
+		return nil, status.Error(codes.PermissionDenied, "missing scope "+auth.ScopeRead)
+	}
+	return auth.WithPrincipal(ctx, p), nil
+}
+
+// authenticatedStream подменяет контекст стрима контекстом с вызывающим
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,253 @@
+// Package grpcserver реализует gRPC API заказов поверх той же логики, что и HTTP API
+package grpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	ordersv1 "test_task_wb/api/orders/v1"
+	"test_task_wb/internal/auth"
+	"test_task_wb/internal/masking"
+	"test_task_wb/internal/model"
+	"test_task_wb/internal/orders"
+	"test_task_wb/internal/storage"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultPageSize - размер страницы ListOrders, если клиент его не указал
+	defaultPageSize = 100
+	// watchBuffer - сколько событий может накопиться у медленного клиента WatchOrders до отключения
+	watchBuffer = 256
+)
+
+// Server содержит gRPC-сервер с сервисами заказов, здоровья и reflection
+type Server struct {
+	ordersv1.UnimplementedOrdersServiceServer
+
+	GRPC    *grpc.Server
+	Health  *health.Server
+	Orders  *orders.Service
+	Feed    *orders.Feed
+	Masking masking.Policy
+	Auth    *auth.Authenticator
+}
+
+// Option настраивает дополнительные параметры сервера
+type Option func(*Server)
+
+// WithMaskingPolicy задает политику маскирования персональных данных в ответах
+func WithMaskingPolicy(p masking.Policy) Option {
+	return func(s *Server) {
+		s.Masking = p
+	}
+}
+
+// WithAuthenticator включает аутентификацию по метаданным x-api-key и authorization.
+// Без него (или с nil) все вызывающие получают полный доступ, кроме персональных данных:
+// ответы маскируются ролью по умолчанию
+func WithAuthenticator(a *auth.Authenticator) Option {
+	return func(s *Server) {
+		s.Auth = a
+	}
+}
+
+// WithFeed подключает ленту изменений для WatchOrders
+func WithFeed(f *orders.Feed) Option {
+	return func(s *Server) {
+		s.Feed = f
+	}
+}
+
+// New создает gRPC-сервер. Статус здоровья изначально NOT_SERVING, его выставляет приложение
+func New(svc *orders.Service, opts ...Option) *Server {
+	s := &Server{
+		Orders:  svc,
+		Masking: masking.DefaultPolicy,
+		Health:  health.NewServer(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.GRPC = grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(s.unaryAuth),
+		grpc.ChainStreamInterceptor(s.streamAuth),
+	)
+	ordersv1.RegisterOrdersServiceServer(s.GRPC, s)
+	healthpb.RegisterHealthServer(s.GRPC, s.Health)
+	reflection.Register(s.GRPC)
+	s.SetServing(false)
+	return s
+}
+
+// SetServing выставляет статус здоровья всего сервера и сервиса заказов
+func (s *Server) SetServing(serving bool) {
+	st := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		st = healthpb.HealthCheckResponse_SERVING
+	}
+	s.Health.SetServingStatus("", st)
+	s.Health.SetServingStatus(ordersv1.OrdersService_ServiceDesc.ServiceName, st)
+}
+
+func (s *Server) GetOrder(ctx context.Context, req *ordersv1.GetOrderRequest) (*ordersv1.GetOrderResponse, error) {
+	if req.GetOrderUid() == "" {
+		return nil, status.Error(codes.InvalidArgument, "order_uid is required")
+	}
+
+	order, err := s.Orders.Get(ctx, req.GetOrderUid())
+	if err != nil {
+		if errors.Is(err, storage.ErrOrderNotFound) {
+			return nil, status.Error(codes.NotFound, "order not found")
+		}
+		if errors.Is(err, storage.ErrOrderDeleted) {
+			return nil, status.Error(codes.FailedPrecondition, "order has been cancelled")
+		}
+		slog.Error("Failed to get order", "error", err, "order_uid", req.GetOrderUid())
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+
+	pb, err := s.project(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	return &ordersv1.GetOrderResponse{Order: pb}, nil
+}
+
+func (s *Server) BatchGetOrders(ctx context.Context, req *ordersv1.BatchGetOrdersRequest) (*ordersv1.BatchGetOrdersResponse, error) {
+	if len(req.GetOrderUids()) > orders.MaxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d order_uids are allowed", orders.MaxBatchSize)
+	}
+
+	found, missing, err := s.Orders.BatchGet(ctx, req.GetOrderUids())
+	if err != nil {
+		slog.Error("Failed to batch get orders", "error", err, "count", len(req.GetOrderUids()))
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+
+	resp := &ordersv1.BatchGetOrdersResponse{MissingOrderUids: missing}
+	for _, order := range found {
+		pb, err := s.project(ctx, order)
+		if err != nil {
+			return nil, err
+		}
+		resp.Orders = append(resp.Orders, pb)
+	}
+	return resp, nil
+}
+
+func (s *Server) ListOrders(ctx context.Context, req *ordersv1.ListOrdersRequest) (*ordersv1.ListOrdersResponse, error) {
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > orders.MaxPageSize:
+		pageSize = orders.MaxPageSize
+	}
+
+	list, next, err := s.Orders.List(ctx, pageSize, req.GetPageToken())
+	if err != nil {
+		if errors.Is(err, orders.ErrInvalidPageToken) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		slog.Error("Failed to list orders", "error", err)
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+
+	resp := &ordersv1.ListOrdersResponse{NextPageToken: next}
+	for _, order := range list {
+		pb, err := s.project(ctx, order)
+		if err != nil {
+			return nil, err
+		}
+		resp.Orders = append(resp.Orders, pb)
+	}
+	return resp, nil
+}
+
+func (s *Server) WatchOrders(_ *ordersv1.WatchOrdersRequest, stream grpc.ServerStreamingServer[ordersv1.WatchOrdersResponse]) error {
+	if s.Feed == nil {
+		return status.Error(codes.Unimplemented, "order feed is not configured")
+	}
+
+	ctx := stream.Context()
+	sub := s.Feed.Subscribe(watchBuffer)
+	defer sub.Close()
+	// заголовки отправляются сразу: получив их, клиент знает, что не пропустит следующие события
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-sub.Events():
+			if !ok {
+				if sub.Lagged() {
+					return status.Error(codes.ResourceExhausted, "client is too slow, resubscribe")
+				}
+				return status.Error(codes.Unavailable, "server is shutting down")
+			}
+
+			resp := &ordersv1.WatchOrdersResponse{
+				Type:     eventTypes[e.Type],
+				OrderUid: e.OrderUID,
+				Time:     timestamp(e.Time),
+			}
+			if e.Order != nil {
+				pb, err := s.project(ctx, *e.Order)
+				if err != nil {
+					return err
+				}
+				resp.Order = pb
+			}
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+var eventTypes = map[orders.EventType]ordersv1.OrderEventType{
+	orders.EventCreated:   ordersv1.OrderEventType_ORDER_EVENT_TYPE_CREATED,
+	orders.EventCancelled: ordersv1.OrderEventType_ORDER_EVENT_TYPE_CANCELLED,
+	orders.EventDeleted:   ordersv1.OrderEventType_ORDER_EVENT_TYPE_DELETED,
+}
+
+// project применяет политику маскирования так же, как HTTP API: без области pii - роль по умолчанию
+func (s *Server) project(ctx context.Context, order model.Order) (*ordersv1.Order, error) {
+	p := auth.FromContext(ctx)
+	role := p.Role
+	if !p.HasScope(auth.ScopePII) {
+		role = s.Masking.DefaultRole
+	}
+
+	projected, err := s.Masking.Apply(role, order)
+	if err == nil {
+		// политика работает с JSON-представлением, поэтому результат собирается обратно в model.Order
+		var data []byte
+		data, err = json.Marshal(projected)
+		if err == nil {
+			order = model.Order{}
+			err = json.Unmarshal(data, &order)
+		}
+	}
+	if err != nil {
+		slog.Error("Failed to apply masking policy", "error", err, "order_uid", order.OrderUID)
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+	return toProto(order), nil
+}
@@ -0,0 +1,94 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	ordersv1 "test_task_wb/api/orders/v1"
+	"test_task_wb/internal/auth"
+	"test_task_wb/internal/model"
+	"test_task_wb/internal/orders"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startTestServer запускает сервер в памяти и возвращает подключённого клиента
+func startTestServer(t *testing.T, opts ...Option) (*Server, *grpc.ClientConn) {
+	t.Helper()
+	s := New(nil, opts...)
+	lis := bufconn.Listen(1 << 20)
+	go s.GRPC.Serve(lis)
+	t.Cleanup(s.GRPC.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return s, conn
+}
+
+func TestAuthentication(t *testing.T) {
+	keys, err := auth.ParseAPIKeys("reader:support:orders:read:" + auth.HashAPIKey("read-key") + ",admin:support:admin:" + auth.HashAPIKey("admin-key"))
+	require.NoError(t, err)
+	s, conn := startTestServer(t, WithAuthenticator(auth.NewAuthenticator(keys, nil, "", "")))
+	s.SetServing(true)
+
+	client := ordersv1.NewOrdersServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = client.GetOrder(ctx, &ordersv1.GetOrderRequest{OrderUid: "order1"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err), "без ключа вызов должен отклоняться")
+
+	adminCtx := metadata.AppendToOutgoingContext(ctx, "x-api-key", "admin-key")
+	_, err = client.GetOrder(adminCtx, &ordersv1.GetOrderRequest{OrderUid: "order1"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err), "без области orders:read вызов должен отклоняться")
+
+	readCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer read-key")
+	_, err = client.GetOrder(readCtx, &ordersv1.GetOrderRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "аутентифицированный вызов доходит до обработчика")
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err, "проверка здоровья не требует аутентификации")
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+}
+
+func TestWatchOrders(t *testing.T) {
+	feed := orders.NewFeed()
+	keys, err := auth.ParseAPIKeys("support:support:orders:read|pii:" + auth.HashAPIKey("support-key"))
+	require.NoError(t, err)
+	_, conn := startTestServer(t, WithFeed(feed), WithAuthenticator(auth.NewAuthenticator(keys, nil, "", "")))
+	client := ordersv1.NewOrdersServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.WatchOrders(metadata.AppendToOutgoingContext(ctx, "x-api-key", "support-key"), &ordersv1.WatchOrdersRequest{})
+	require.NoError(t, err)
+
+	// заголовки приходят после подписки, поэтому событие не потеряется
+	_, err = stream.Header()
+	require.NoError(t, err)
+
+	order := model.Order{OrderUID: "order1", Delivery: model.Delivery{Phone: "+79001234567"}, DateCreated: time.Now()}
+	feed.Publish(orders.Event{Type: orders.EventCreated, OrderUID: order.OrderUID, Order: &order})
+
+	msg, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, ordersv1.OrderEventType_ORDER_EVENT_TYPE_CREATED, msg.GetType())
+	require.Equal(t, "+79001234567", msg.GetOrder().GetDelivery().GetPhone(), "роль support видит персональные данные")
+	require.NotNil(t, msg.GetTime())
+
+	feed.Close()
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err), "при остановке ленты стрим завершается")
+}
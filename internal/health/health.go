@@ -0,0 +1,152 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Probe - вид проверки в терминах оркестратора
+type Probe int
+
+const (
+	// Liveness - процесс жив; провал означает, что его нужно перезапустить
+	Liveness Probe = iota
+	// Readiness - процесс готов принимать трафик
+	Readiness
+	// Startup - процесс завершил инициализацию
+	Startup
+)
+
+// checkTimeout - время на одну проверку зависимости
+const checkTimeout = 2 * time.Second
+
+// ErrDraining - сервис останавливается и больше не принимает трафик
+var ErrDraining = errors.New("service is shutting down")
+
+// CheckFunc проверяет одну зависимость; nil означает, что зависимость в порядке
+type CheckFunc func(ctx context.Context) error
+
+// CheckResult - результат одной проверки в JSON-ответе
+type CheckResult struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report - JSON-ответ эндпоинтов здоровья
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker хранит проверки зависимостей для каждого вида проб
+type Checker struct {
+	mu       sync.RWMutex
+	checks   map[Probe][]check
+	draining atomic.Bool
+}
+
+// NewChecker создает пустой набор проверок
+func NewChecker() *Checker {
+	return &Checker{checks: make(map[Probe][]check)}
+}
+
+// Add регистрирует проверку name для пробы probe
+func (c *Checker) Add(probe Probe, name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[probe] = append(c.checks[probe], check{name: name, fn: fn})
+}
+
+// SetDraining переводит сервис в режим остановки: готовность становится отрицательной,
+// чтобы балансировщик успел убрать экземпляр до закрытия соединений
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+// Run выполняет все проверки пробы параллельно
+func (c *Checker) Run(ctx context.Context, probe Probe) Report {
+	c.mu.RLock()
+	checks := append([]check(nil), c.checks[probe]...)
+	c.mu.RUnlock()
+
+	if probe == Readiness {
+		checks = append(checks, check{name: "draining", fn: func(context.Context) error {
+			if c.draining.Load() {
+				return ErrDraining
+			}
+			return nil
+		}})
+	}
+
+	report := Report{Status: "ok", Checks: make(map[string]CheckResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ch := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			start := time.Now()
+			err := ch.fn(checkCtx)
+
+			res := CheckResult{Status: "ok", DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				res.Status = "fail"
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[ch.name] = res
+			if err != nil {
+				report.Status = "fail"
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+// Handler возвращает обработчик пробы: 200 при успехе всех проверок, иначе 503.
+// С параметром ?verbose=0 тело ответа не содержит деталей проверок
+func (c *Checker) Handler(probe Probe) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context(), probe)
+		if r.URL.Query().Get("verbose") == "0" {
+			report.Checks = nil
+		}
+
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// Register монтирует /healthz, /readyz и /startupz на mux
+func (c *Checker) Register(mux interface {
+	Handle(pattern string, h http.Handler)
+}) {
+	mux.Handle("/healthz", c.Handler(Liveness))
+	mux.Handle("/readyz", c.Handler(Readiness))
+	mux.Handle("/startupz", c.Handler(Startup))
+}
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker(t *testing.T) {
+	c := NewChecker()
+	mux := http.NewServeMux()
+	c.Register(mux)
+
+	restored := false
+	c.Add(Liveness, "loop", func(context.Context) error { return nil })
+	c.Add(Startup, "cache", func(context.Context) error {
+		if !restored {
+			return errors.New("cache is not restored yet")
+		}
+		return nil
+	})
+	c.Add(Readiness, "postgres", func(context.Context) error { return nil })
+
+	get := func(path string) (int, Report) {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		var report Report
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&report))
+		return rr.Code, report
+	}
+
+	t.Run("Startup waits for dependencies", func(t *testing.T) {
+		code, report := get("/startupz")
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.Equal(t, "fail", report.Checks["cache"].Status)
+		require.Equal(t, "cache is not restored yet", report.Checks["cache"].Error)
+
+		restored = true
+		code, _ = get("/startupz")
+		require.Equal(t, http.StatusOK, code, "После восстановления кэша проба запуска должна проходить")
+	})
+
+	t.Run("Readiness goes false while draining", func(t *testing.T) {
+		code, report := get("/readyz")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "ok", report.Checks["postgres"].Status)
+
+		c.SetDraining()
+		code, report = get("/readyz")
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.Equal(t, ErrDraining.Error(), report.Checks["draining"].Error)
+
+		code, _ = get("/healthz")
+		require.Equal(t, http.StatusOK, code, "Остановка не должна влиять на живость процесса")
+	})
+}
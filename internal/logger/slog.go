@@ -1,14 +1,21 @@
 package logger
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 )
 
-// NewSlogLogger создает и настраивает новый JSON логгер
+// level - уровень логирования, который можно менять без пересоздания логгера
+var level = new(slog.LevelVar)
+
+// NewSlogLogger создает и настраивает новый JSON логгер.
+// Уровень по умолчанию - debug, его можно поменять через SetLevel
 func NewSlogLogger() *slog.Logger {
+	level.Set(slog.LevelDebug)
 	opts := &slog.HandlerOptions{
-		Level: slog.LevelDebug,
+		Level: level,
 	}
 
 	handler := slog.NewJSONHandler(os.Stdout, opts)
@@ -16,3 +23,22 @@ func NewSlogLogger() *slog.Logger {
 
 	return logger
 }
+
+// ParseLevel разбирает уровень логирования: debug, info, warn или error
+func ParseLevel(name string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+	}
+	return l, nil
+}
+
+// SetLevel меняет уровень логирования на лету
+func SetLevel(name string) error {
+	l, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
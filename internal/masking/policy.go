@@ -0,0 +1,178 @@
+package masking
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Action определяет, что делать с полем ответа
+type Action string
+
+const (
+	// Keep оставляет поле без изменений
+	Keep Action = "keep"
+	// Mask заменяет большую часть значения звёздочками
+	Mask Action = "mask"
+	// Hide убирает поле из ответа
+	Hide Action = "hide"
+)
+
+// Rule применяет действие к полю, заданному JSON-путём через точку ("delivery.phone").
+// Если на пути встречается массив, правило применяется к каждому его элементу ("items.rid")
+type Rule struct {
+	Path   string `json:"path"`
+	Action Action `json:"action"`
+}
+
+// Policy сопоставляет ролям вызывающих правила проекции ответа
+type Policy struct {
+	// DefaultRole используется для неизвестной или не указанной роли
+	DefaultRole string            `json:"default_role"`
+	Roles       map[string][]Rule `json:"roles"`
+}
+
+// DefaultPolicy: поддержка видит всё, склад - только адрес доставки,
+// аналитика - замаскированные контактные данные
+var DefaultPolicy = Policy{
+	DefaultRole: "analytics",
+	Roles: map[string][]Rule{
+		"support": {},
+		"warehouse": {
+			{Path: "delivery.name", Action: Hide},
+			{Path: "delivery.phone", Action: Hide},
+			{Path: "delivery.email", Action: Hide},
+		},
+		"analytics": {
+			{Path: "delivery.name", Action: Mask},
+			{Path: "delivery.phone", Action: Mask},
+			{Path: "delivery.email", Action: Mask},
+			{Path: "delivery.address", Action: Mask},
+		},
+	},
+}
+
+// LoadPolicy читает политику маскирования из JSON-файла
+func LoadPolicy(path string) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("failed to read masking policy: %w", err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Policy{}, fmt.Errorf("failed to parse masking policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return Policy{}, err
+	}
+
+	return p, nil
+}
+
+// Validate проверяет, что роль по умолчанию существует, а действия известны
+func (p Policy) Validate() error {
+	if _, ok := p.Roles[p.DefaultRole]; !ok {
+		return fmt.Errorf("default role %q is not defined in masking policy", p.DefaultRole)
+	}
+
+	var errs []error
+	for role, rules := range p.Roles {
+		for _, r := range rules {
+			switch r.Action {
+			case Keep, Mask, Hide:
+			default:
+				errs = append(errs, fmt.Errorf("role %q: unknown action %q for path %q", role, r.Action, r.Path))
+			}
+			if r.Path == "" {
+				errs = append(errs, fmt.Errorf("role %q: empty path", role))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Rules возвращает правила роли, подставляя роль по умолчанию для неизвестных ролей
+func (p Policy) Rules(role string) []Rule {
+	if rules, ok := p.Roles[role]; ok {
+		return rules
+	}
+	return p.Roles[p.DefaultRole]
+}
+
+// Apply возвращает JSON-представление v с применёнными правилами роли
+func (p Policy) Apply(role string, v any) (any, error) {
+	rules := p.Rules(role)
+	if len(rules) == 0 {
+		return v, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	for _, r := range rules {
+		applyRule(doc, strings.Split(r.Path, "."), r.Action)
+	}
+
+	return doc, nil
+}
+
+// applyRule рекурсивно спускается по пути и применяет действие к последнему сегменту
+func applyRule(node any, path []string, action Action) {
+	switch n := node.(type) {
+	case []any:
+		for _, elem := range n {
+			applyRule(elem, path, action)
+		}
+	case map[string]any:
+		val, ok := n[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) > 1 {
+			applyRule(val, path[1:], action)
+			return
+		}
+
+		switch action {
+		case Hide:
+			delete(n, path[0])
+		case Mask:
+			if s, ok := val.(string); ok {
+				n[path[0]] = maskString(s)
+			} else {
+				n[path[0]] = "***"
+			}
+		}
+	}
+}
+
+// maskString оставляет первый символ и два последних, для email - ещё и домен
+func maskString(s string) string {
+	if local, domain, ok := strings.Cut(s, "@"); ok {
+		return maskString(local) + "@" + domain
+	}
+
+	runes := []rune(s)
+	if len(runes) <= 4 {
+		return "***"
+	}
+	masked := make([]rune, len(runes))
+	for i, r := range runes {
+		if i == 0 || i >= len(runes)-2 {
+			masked[i] = r
+		} else {
+			masked[i] = '*'
+		}
+	}
+	return string(masked)
+}
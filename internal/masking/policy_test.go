@@ -0,0 +1,73 @@
+package masking
+
+import (
+	"encoding/json"
+	"test_task_wb/internal/model"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Apply(t *testing.T) {
+	order := model.Order{
+		OrderUID: "order1",
+		Delivery: model.Delivery{
+			Name: "Test Testov", Phone: "+9720000000", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Email: "test@gmail.com",
+		},
+		Items: []model.Item{{Rid: "rid1", Name: "Mascaras"}, {Rid: "rid2", Name: "Lipstick"}},
+	}
+
+	project := func(t *testing.T, p Policy, role string) map[string]any {
+		v, err := p.Apply(role, order)
+		require.NoError(t, err)
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		var doc map[string]any
+		require.NoError(t, json.Unmarshal(data, &doc))
+		return doc
+	}
+
+	t.Run("Support sees everything", func(t *testing.T) {
+		delivery := project(t, DefaultPolicy, "support")["delivery"].(map[string]any)
+		require.Equal(t, "+9720000000", delivery["phone"])
+		require.Equal(t, "test@gmail.com", delivery["email"])
+	})
+
+	t.Run("Warehouse sees address only", func(t *testing.T) {
+		delivery := project(t, DefaultPolicy, "warehouse")["delivery"].(map[string]any)
+		require.Equal(t, "Ploshad Mira 15", delivery["address"])
+		require.NotContains(t, delivery, "phone", "Складу не должен отдаваться телефон")
+		require.NotContains(t, delivery, "name")
+		require.NotContains(t, delivery, "email")
+	})
+
+	t.Run("Analytics sees masked contacts", func(t *testing.T) {
+		delivery := project(t, DefaultPolicy, "analytics")["delivery"].(map[string]any)
+		require.Equal(t, "+********00", delivery["phone"])
+		require.Equal(t, "***@gmail.com", delivery["email"])
+		require.Equal(t, "Kiryat Mozkin", delivery["city"], "Немаскируемые поля не должны меняться")
+	})
+
+	t.Run("Unknown role falls back to default", func(t *testing.T) {
+		delivery := project(t, DefaultPolicy, "")["delivery"].(map[string]any)
+		require.Equal(t, "+********00", delivery["phone"])
+	})
+
+	t.Run("Rules apply to every array element", func(t *testing.T) {
+		p := Policy{DefaultRole: "r", Roles: map[string][]Rule{"r": {{Path: "items.rid", Action: Hide}}}}
+		require.NoError(t, p.Validate())
+
+		items := project(t, p, "r")["items"].([]any)
+		for _, item := range items {
+			require.NotContains(t, item.(map[string]any), "rid")
+			require.Contains(t, item.(map[string]any), "name")
+		}
+	})
+
+	t.Run("Invalid policy", func(t *testing.T) {
+		p := Policy{DefaultRole: "r", Roles: map[string][]Rule{"r": {{Path: "delivery.phone", Action: "drop"}}}}
+		require.Error(t, p.Validate())
+		require.Error(t, Policy{DefaultRole: "missing"}.Validate())
+	})
+}
@@ -2,53 +2,167 @@ package metrics
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// Metrics содержит все метрики сервиса
+// Metrics содержит все метрики сервиса.
+// Метрики регистрируются в собственном реестре, поэтому экземпляров может быть несколько
 type Metrics struct {
+	Registry *prometheus.Registry
+
 	MessagesConsumed prometheus.Counter
 	CacheHits        prometheus.Counter
 	CacheMisses      prometheus.Counter
 	DBErrors         prometheus.Counter
 	ValidationErrors prometheus.Counter
 	HTTPServerReqs   *prometheus.CounterVec
+
+	HTTPRequestDuration       *prometheus.HistogramVec
+	MessageProcessingDuration prometheus.Histogram
+	DBQueryDuration           *prometheus.HistogramVec
+	LastMessageProcessed      prometheus.Gauge
+	ConsumerLag               prometheus.Gauge
+
+	KafkaPartitionLag        *prometheus.GaugeVec
+	KafkaHighWaterMark       *prometheus.GaugeVec
+	KafkaCommittedOffset     *prometheus.GaugeVec
+	KafkaPartitionAssignment *prometheus.GaugeVec
+	KafkaFetchErrors         prometheus.Counter
+	KafkaRebalances          prometheus.Counter
+
+	StreamClients     *prometheus.GaugeVec
+	StreamDisconnects *prometheus.CounterVec
 }
 
-// NewMetrics создает и регистрирует новые метрики
+// NewMetrics создает новый реестр и регистрирует в нём метрики сервиса,
+// а также стандартные метрики Go-рантайма и процесса
 func NewMetrics() *Metrics {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	factory := promauto.With(reg)
+
 	return &Metrics{
-		MessagesConsumed: promauto.NewCounter(prometheus.CounterOpts{
+		Registry: reg,
+		MessagesConsumed: factory.NewCounter(prometheus.CounterOpts{
 			Name: "service_messages_consumed_total",
 			Help: "The total number of messages consumed from Kafka.",
 		}),
-		CacheHits: promauto.NewCounter(prometheus.CounterOpts{
+		CacheHits: factory.NewCounter(prometheus.CounterOpts{
 			Name: "service_cache_hits_total",
 			Help: "The total number of cache hits.",
 		}),
-		CacheMisses: promauto.NewCounter(prometheus.CounterOpts{
+		CacheMisses: factory.NewCounter(prometheus.CounterOpts{
 			Name: "service_cache_misses_total",
 			Help: "The total number of cache misses.",
 		}),
-		DBErrors: promauto.NewCounter(prometheus.CounterOpts{
+		DBErrors: factory.NewCounter(prometheus.CounterOpts{
 			Name: "service_db_errors_total",
 			Help: "The total number of database errors.",
 		}),
-		ValidationErrors: promauto.NewCounter(prometheus.CounterOpts{
+		ValidationErrors: factory.NewCounter(prometheus.CounterOpts{
 			Name: "service_validation_errors_total",
 			Help: "The total number of validation errors on incoming messages.",
 		}),
-		HTTPServerReqs: promauto.NewCounterVec(prometheus.CounterOpts{
+		HTTPServerReqs: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "service_http_requests_total",
 			Help: "The total number of HTTP requests.",
-		}, []string{"code", "method"}),
+		}, []string{"code", "method", "route"}),
+		HTTPRequestDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "service_http_request_duration_seconds",
+			Help:    "HTTP request latency by chi route pattern.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		MessageProcessingDuration: factory.NewHistogram(prometheus.HistogramOpts{
+			Name:    "service_message_processing_duration_seconds",
+			Help:    "End-to-end processing time of a Kafka message, from receipt to commit.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		DBQueryDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "service_db_query_duration_seconds",
+			Help:    "Database operation latency by operation.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation"}),
+		LastMessageProcessed: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "service_last_message_processed_timestamp_seconds",
+			Help: "Unix time when the last Kafka message was processed.",
+		}),
+		ConsumerLag: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "service_kafka_consumer_lag",
+			Help: "Consumer lag reported by the Kafka reader.",
+		}),
+		KafkaPartitionLag: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "service_kafka_partition_lag",
+			Help: "Difference between the high-water mark and the committed offset of the consumer group.",
+		}, []string{"partition"}),
+		KafkaHighWaterMark: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "service_kafka_partition_high_water_mark",
+			Help: "Offset of the next message to be written to the partition.",
+		}, []string{"partition"}),
+		KafkaCommittedOffset: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "service_kafka_partition_committed_offset",
+			Help: "Offset committed by the consumer group, -1 if nothing was committed yet.",
+		}, []string{"partition"}),
+		KafkaPartitionAssignment: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "service_kafka_partition_assignment",
+			Help: "Consumer group member currently assigned to the partition.",
+		}, []string{"partition", "member"}),
+		KafkaFetchErrors: factory.NewCounter(prometheus.CounterOpts{
+			Name: "service_kafka_fetch_errors_total",
+			Help: "The total number of errors reported by the Kafka reader.",
+		}),
+		KafkaRebalances: factory.NewCounter(prometheus.CounterOpts{
+			Name: "service_kafka_rebalances_total",
+			Help: "The total number of consumer group rebalances seen by the Kafka reader.",
+		}),
+		StreamClients: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "service_stream_clients",
+			Help: "The number of clients connected to the live order feed.",
+		}, []string{"transport"}),
+		StreamDisconnects: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "service_stream_disconnects_total",
+			Help: "The total number of live order feed disconnects by reason.",
+		}, []string{"transport", "reason"}),
 	}
 }
 
+// RegisterCacheShards регистрирует метрику числа записей в каждом сегменте кэша.
+// shardLens вызывается при каждом сборе метрик
+func (m *Metrics) RegisterCacheShards(shardLens func() []int) {
+	m.Registry.MustRegister(&cacheCollector{
+		desc: prometheus.NewDesc(
+			"service_cache_entries",
+			"The number of orders stored in each cache shard.",
+			[]string{"shard"}, nil,
+		),
+		shardLens: shardLens,
+	})
+}
+
 // Handler возвращает http.Handler для эндпоинта /metrics
-func Handler() http.Handler {
-	return promhttp.Handler()
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// cacheCollector снимает размеры сегментов кэша в момент сбора метрик
+type cacheCollector struct {
+	desc      *prometheus.Desc
+	shardLens func() []int
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for i, n := range c.shardLens() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), strconv.Itoa(i))
+	}
 }
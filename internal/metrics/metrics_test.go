@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMetrics(t *testing.T) {
+	first := NewMetrics()
+	require.NotPanics(t, func() { NewMetrics() }, "Несколько экземпляров Metrics не должны конфликтовать в реестре")
+
+	first.HTTPServerReqs.WithLabelValues("200", http.MethodGet, "/order/{orderUID}").Inc()
+	first.DBQueryDuration.WithLabelValues("get_order_by_uid").Observe(0.01)
+	first.RegisterCacheShards(func() []int { return []int{3, 5} })
+
+	rr := httptest.NewRecorder()
+	first.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	body, err := io.ReadAll(rr.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `service_http_requests_total{code="200",method="GET",route="/order/{orderUID}"} 1`)
+	require.Contains(t, string(body), `service_db_query_duration_seconds_count{operation="get_order_by_uid"} 1`)
+	require.Contains(t, string(body), `service_cache_entries{shard="1"} 5`)
+}
@@ -0,0 +1,112 @@
+package orders
+
+import (
+	"sync"
+	"test_task_wb/internal/model"
+	"time"
+)
+
+// EventType - вид изменения заказа
+type EventType string
+
+const (
+	EventCreated   EventType = "created"
+	EventCancelled EventType = "cancelled"
+	EventDeleted   EventType = "deleted"
+)
+
+// Event - изменение заказа, которое консьюмер применил к БД и кэшу.
+// Order заполнен только для EventCreated
+type Event struct {
+	Type     EventType
+	OrderUID string
+	Order    *model.Order
+	Time     time.Time
+}
+
+// Feed рассылает события всем подписчикам. Публикация никогда не блокирует консьюмер:
+// подписчик, не успевший разобрать свой буфер, отключается
+type Feed struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// Subscription - подписка на события Feed
+type Subscription struct {
+	feed *Feed
+	ch   chan Event
+	// lagged выставляется, если подписка закрыта из-за переполнения буфера
+	lagged bool
+}
+
+// NewFeed создает пустую ленту событий
+func NewFeed() *Feed {
+	return &Feed{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe подписывается на события с буфером buffer. После Close ленты канал подписки сразу закрыт
+func (f *Feed) Subscribe(buffer int) *Subscription {
+	sub := &Subscription{feed: f, ch: make(chan Event, buffer)}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		close(sub.ch)
+		return sub
+	}
+	f.subs[sub] = struct{}{}
+	return sub
+}
+
+// Publish отправляет событие всем подписчикам
+func (f *Feed) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for sub := range f.subs {
+		select {
+		case sub.ch <- e:
+		default:
+			sub.lagged = true
+			delete(f.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// Close закрывает все подписки; используется при остановке сервиса, чтобы завершить долгие стримы
+func (f *Feed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for sub := range f.subs {
+		delete(f.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Events возвращает канал событий. Канал закрывается при отписке, переполнении буфера или остановке ленты
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Lagged сообщает, что подписка была закрыта из-за переполнения буфера
+func (s *Subscription) Lagged() bool {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	return s.lagged
+}
+
+// Close отписывается от ленты. Повторный вызов безопасен
+func (s *Subscription) Close() {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	if _, ok := s.feed.subs[s]; ok {
+		delete(s.feed.subs, s)
+		close(s.ch)
+	}
+}
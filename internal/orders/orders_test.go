@@ -0,0 +1,113 @@
+package orders
+
+import (
+	"test_task_wb/internal/model"
+	"test_task_wb/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeed(t *testing.T) {
+	t.Run("Subscribers receive events", func(t *testing.T) {
+		feed := NewFeed()
+		a, b := feed.Subscribe(1), feed.Subscribe(1)
+
+		feed.Publish(Event{Type: EventCreated, OrderUID: "order1", Order: &model.Order{OrderUID: "order1"}})
+
+		for _, sub := range []*Subscription{a, b} {
+			e := <-sub.Events()
+			require.Equal(t, "order1", e.OrderUID, "событие должно дойти до каждого подписчика")
+			require.False(t, e.Time.IsZero(), "время события должно заполняться при публикации")
+		}
+	})
+
+	t.Run("Slow subscriber is dropped", func(t *testing.T) {
+		feed := NewFeed()
+		slow, fast := feed.Subscribe(1), feed.Subscribe(2)
+
+		feed.Publish(Event{Type: EventCreated, OrderUID: "order1"})
+		feed.Publish(Event{Type: EventDeleted, OrderUID: "order1"})
+
+		<-slow.Events()
+		_, ok := <-slow.Events()
+		require.False(t, ok, "переполненная подписка должна закрываться")
+		require.True(t, slow.Lagged())
+
+		require.Len(t, fast.Events(), 2, "быстрый подписчик получает все события")
+		require.False(t, fast.Lagged())
+	})
+
+	t.Run("Close ends subscriptions", func(t *testing.T) {
+		feed := NewFeed()
+		sub := feed.Subscribe(1)
+		feed.Close()
+
+		_, ok := <-sub.Events()
+		require.False(t, ok, "после Close ленты подписка закрыта")
+		require.False(t, sub.Lagged(), "закрытие ленты не считается отставанием")
+		sub.Close()
+
+		_, ok = <-feed.Subscribe(1).Events()
+		require.False(t, ok, "подписка на закрытую ленту сразу закрыта")
+	})
+}
+
+func TestPageToken(t *testing.T) {
+	cursor := storage.OrderCursor{DateCreated: time.Date(2025, 3, 1, 12, 0, 0, 123456789, time.UTC), OrderUID: "b563feb7b2b84b6test"}
+
+	decoded, err := decodePageToken(encodePageToken(cursor))
+	require.NoError(t, err)
+	require.True(t, cursor.DateCreated.Equal(decoded.DateCreated), "время курсора должно сохраняться до наносекунд")
+	require.Equal(t, cursor.OrderUID, decoded.OrderUID)
+
+	for _, token := range []string{"not base64!", "bm8tc2VwYXJhdG9y", "eHx5"} {
+		_, err := decodePageToken(token)
+		require.ErrorIs(t, err, ErrInvalidPageToken, "токен %q", token)
+	}
+}
+
+func TestBuildSearchQuery(t *testing.T) {
+	q, err := buildSearchQuery("  Vivienne sab% ", false)
+	require.NoError(t, err)
+	require.Equal(t, "vivienne:* & sab:*", q.TSQuery, "Каждое слово должно искаться как префикс")
+	require.Equal(t, "Vivienne sab", q.Pattern, "Спецсимволы LIKE должны удаляться из подстроки")
+	require.Equal(t, []string{"vivienne", "sab"}, q.Words, "Слова нужны для поиска по слепому индексу")
+	require.Empty(t, q.PhoneDigits)
+
+	q, err = buildSearchQuery("+7 (999) 12", true)
+	require.NoError(t, err)
+	require.Equal(t, "799912", q.PhoneDigits)
+
+	q, err = buildSearchQuery("+7 (999) 12", false)
+	require.NoError(t, err)
+	require.Empty(t, q.PhoneDigits, "Без доступа к PII поиск по телефону не выполняется")
+
+	q, err = buildSearchQuery("ab", false)
+	require.NoError(t, err)
+	require.Empty(t, q.Pattern, "Слишком короткая строка не должна искаться по подстроке")
+
+	_, err = buildSearchQuery(" %%-- ", true)
+	require.ErrorIs(t, err, ErrEmptyQuery)
+}
+
+func TestHighlights(t *testing.T) {
+	order := model.Order{
+		Delivery: model.Delivery{Name: "Ivan <Petrov>", Phone: "+7 999 123-45-67", City: "Moscow"},
+		Items:    []model.Item{{Name: "Mascara", Brand: "Vivienne Sabo"}, {Name: "Mask", Brand: "Other"}},
+	}
+
+	got := Highlights(order, "mas petrov", false)
+	require.Equal(t, []Highlight{
+		{Field: "items[0].name", Fragment: "<mark>Mas</mark>cara"},
+		{Field: "items[1].name", Fragment: "<mark>Mas</mark>k"},
+	}, got, "Без доступа к PII персональные поля не подсвечиваются")
+
+	got = Highlights(order, "petrov", true)
+	require.Equal(t, []Highlight{{Field: "delivery.name", Fragment: "Ivan &lt;<mark>Petrov</mark>&gt;"}}, got,
+		"Текст вокруг совпадений должен экранироваться")
+
+	got = Highlights(order, "123 45", true)
+	require.Contains(t, got, Highlight{Field: "delivery.phone", Fragment: "<mark>+7 999 123-45-67</mark>"})
+}
@@ -0,0 +1,202 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"test_task_wb/internal/model"
+	"test_task_wb/internal/storage"
+	"unicode/utf8"
+)
+
+// MaxSearchLimit ограничивает размер страницы результатов поиска
+const MaxSearchLimit = 100
+
+// ErrEmptyQuery возвращается для поисковой строки без букв и цифр
+var ErrEmptyQuery = errors.New("search query has no words")
+
+// minPatternLength - с какой длины включается поиск по подстроке: более короткие не используют триграммный индекс
+const minPatternLength = 3
+
+// SearchResult - найденный заказ и его релевантность
+type SearchResult struct {
+	Order model.Order
+	Rank  float64
+}
+
+// Highlight - поле заказа, совпавшее с запросом. Совпадения во Fragment обрамлены тегом <mark>,
+// остальной текст экранирован для HTML
+type Highlight struct {
+	Field    string `json:"field"`
+	Fragment string `json:"fragment"`
+}
+
+// SearchPage - страница результатов поиска
+type SearchPage struct {
+	Results []SearchResult
+	// More сообщает, что за страницей есть ещё результаты
+	More bool
+	// PIIIncomplete объясняет, почему поиск по персональным полям мог пропустить часть заказов; пустая строка - не мог
+	PIIIncomplete string
+}
+
+// Search ищет заказы по товарам и доставке и возвращает страницу результатов по убыванию релевантности.
+// Персональные поля доставки ищутся только с includePII; зашифрованные из них находятся по целым словам
+// и по окончанию номера телефона
+func (s *Service) Search(ctx context.Context, text string, includePII bool, limit, offset int) (SearchPage, error) {
+	q, err := buildSearchQuery(text, includePII)
+	if err != nil {
+		return SearchPage{}, err
+	}
+	// лишняя строка показывает, есть ли следующая страница
+	q.Limit, q.Offset = limit+1, offset
+
+	var page SearchPage
+	if includePII {
+		if page.PIIIncomplete, err = s.db.PIISearchGap(ctx); err != nil {
+			return SearchPage{}, err
+		}
+	}
+
+	hits, err := s.db.SearchOrders(ctx, q)
+	if err != nil {
+		return SearchPage{}, err
+	}
+	if len(hits) > limit {
+		hits, page.More = hits[:limit], true
+	}
+
+	uids := make([]string, len(hits))
+	ranks := make(map[string]float64, len(hits))
+	for i, h := range hits {
+		uids[i] = h.OrderUID
+		ranks[h.OrderUID] = h.Rank
+	}
+	// заказ, отменённый между поиском и загрузкой, просто пропадает из страницы
+	found, _, err := s.BatchGet(ctx, uids)
+	if err != nil {
+		return SearchPage{}, err
+	}
+
+	page.Results = make([]SearchResult, len(found))
+	for i, order := range found {
+		page.Results[i] = SearchResult{Order: order, Rank: ranks[order.OrderUID]}
+	}
+	return page, nil
+}
+
+// phoneDigits возвращает цифры строки, если она похожа на часть номера телефона
+func phoneDigits(text string) string {
+	var digits strings.Builder
+	for _, r := range text {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case strings.ContainsRune("+-() ", r):
+		default:
+			return ""
+		}
+	}
+	if digits.Len() < storage.MinPhoneDigits {
+		return ""
+	}
+	return digits.String()
+}
+
+// buildSearchQuery готовит запрос к БД: каждое слово ищется как префикс, вся строка - как подстрока
+func buildSearchQuery(text string, includePII bool) (storage.SearchQuery, error) {
+	terms := storage.SearchWords(text)
+	if len(terms) == 0 {
+		return storage.SearchQuery{}, ErrEmptyQuery
+	}
+
+	prefixes := make([]string, len(terms))
+	for i, t := range terms {
+		prefixes[i] = t + ":*"
+	}
+
+	pattern := strings.Map(func(r rune) rune {
+		if r == '%' || r == '_' || r == '\\' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(text))
+	if utf8.RuneCountInString(pattern) < minPatternLength {
+		pattern = ""
+	}
+
+	q := storage.SearchQuery{
+		TSQuery:    strings.Join(prefixes, " & "),
+		Pattern:    pattern,
+		Words:      terms,
+		IncludePII: includePII,
+	}
+	if includePII {
+		q.PhoneDigits = phoneDigits(strings.TrimSpace(text))
+	}
+	return q, nil
+}
+
+// Highlights возвращает поля заказа, в которых встречаются слова запроса.
+// Персональные поля доставки проверяются только с includePII
+func Highlights(order model.Order, text string, includePII bool) []Highlight {
+	terms := storage.SearchWords(text)
+	if len(terms) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = regexp.QuoteMeta(t)
+	}
+	re := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+
+	var out []Highlight
+	add := func(field, value string) {
+		if fragment, ok := markMatches(re, value); ok {
+			out = append(out, Highlight{Field: field, Fragment: fragment})
+		}
+	}
+
+	for i, item := range order.Items {
+		add(fmt.Sprintf("items[%d].name", i), item.Name)
+		add(fmt.Sprintf("items[%d].brand", i), item.Brand)
+	}
+	add("delivery.city", order.Delivery.City)
+	add("delivery.region", order.Delivery.Region)
+	add("delivery.zip", order.Delivery.Zip)
+	if !includePII {
+		return out
+	}
+
+	add("delivery.name", order.Delivery.Name)
+	add("delivery.address", order.Delivery.Address)
+	add("delivery.email", order.Delivery.Email)
+	// номер телефона сравнивается по цифрам, поэтому выделяется целиком
+	if digits := phoneDigits(strings.TrimSpace(text)); digits != "" && strings.Contains(storage.PhoneDigits(order.Delivery.Phone), digits) {
+		out = append(out, Highlight{Field: "delivery.phone", Fragment: "<mark>" + html.EscapeString(order.Delivery.Phone) + "</mark>"})
+	} else {
+		add("delivery.phone", order.Delivery.Phone)
+	}
+	return out
+}
+
+// markMatches обрамляет совпадения re тегом <mark> и экранирует остальной текст
+func markMatches(re *regexp.Regexp, value string) (string, bool) {
+	matches := re.FindAllStringIndex(value, -1)
+	if len(matches) == 0 {
+		return "", false
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(html.EscapeString(value[last:m[0]]))
+		b.WriteString("<mark>" + html.EscapeString(value[m[0]:m[1]]) + "</mark>")
+		last = m[1]
+	}
+	b.WriteString(html.EscapeString(value[last:]))
+	return b.String(), true
+}
@@ -0,0 +1,186 @@
+// Package orders содержит общую логику чтения заказов для HTTP и gRPC API
+package orders
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"test_task_wb/internal/cache"
+	"test_task_wb/internal/metrics"
+	"test_task_wb/internal/model"
+	"test_task_wb/internal/storage"
+	"time"
+)
+
+const (
+	// MaxPageSize ограничивает размер страницы ListOrders
+	MaxPageSize = 1000
+	// MaxBatchSize ограничивает число UID в одном запросе BatchGet
+	MaxBatchSize = 500
+)
+
+// ErrInvalidPageToken возвращается для токена страницы, выданного не нами или повреждённого
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// Service ищет заказы сначала в кэше, затем в БД, и кладёт найденное в БД в кэш
+type Service struct {
+	cache   cache.OrderCache
+	metrics *metrics.Metrics
+	db      *storage.Storage
+}
+
+// NewService создает сервис чтения заказов
+func NewService(c cache.OrderCache, m *metrics.Metrics, db *storage.Storage) *Service {
+	return &Service{cache: c, metrics: m, db: db}
+}
+
+// Get возвращает заказ по UID. Ошибки storage.ErrOrderNotFound и storage.ErrOrderDeleted передаются как есть
+func (s *Service) Get(ctx context.Context, orderUID string) (model.Order, error) {
+	order, found := s.cache.Get(orderUID)
+	if found {
+		slog.Debug("Cache hit", "order_uid", orderUID)
+		s.metrics.CacheHits.Inc()
+		return order, nil
+	}
+
+	slog.Debug("Cache miss", "order_uid", orderUID)
+	s.metrics.CacheMisses.Inc()
+
+	order, err := s.db.GetOrderByUID(ctx, orderUID)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	s.cache.Set(order.OrderUID, order)
+	slog.Debug("Order retrieved from DB and cached", "order_uid", orderUID)
+	return order, nil
+}
+
+// GetBy возвращает заказ по вторичному ключу: трек-номеру, транзакции или RID товара.
+// Кэш с вторичным индексом отвечает из памяти, найденный в БД заказ кладётся в кэш
+func (s *Service) GetBy(ctx context.Context, kind cache.KeyKind, key string) (model.Order, error) {
+	if idx, ok := s.cache.(cache.SecondaryIndex); ok {
+		if order, found := idx.GetBy(kind, key); found {
+			slog.Debug("Cache hit", "key_kind", kind, "key", key)
+			s.metrics.CacheHits.Inc()
+			return order, nil
+		}
+	}
+
+	slog.Debug("Cache miss", "key_kind", kind, "key", key)
+	s.metrics.CacheMisses.Inc()
+
+	var order model.Order
+	var err error
+	switch kind {
+	case cache.KeyTrackNumber:
+		order, err = s.db.GetOrderByTrackNumber(ctx, key)
+	case cache.KeyTransaction:
+		order, err = s.db.GetOrderByTransaction(ctx, key)
+	case cache.KeyItemRID:
+		order, err = s.db.GetOrderByItemRID(ctx, key)
+	default:
+		return model.Order{}, fmt.Errorf("unknown lookup key kind %q", kind)
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	s.cache.Set(order.OrderUID, order)
+	return order, nil
+}
+
+// BatchGet возвращает найденные заказы в порядке запроса и UID, которых нет или которые отменены.
+// Заказы из кэша отдаются сразу, промахи загружаются из БД одним запросом и кладутся в кэш.
+// Повторяющиеся UID обрабатываются один раз
+func (s *Service) BatchGet(ctx context.Context, orderUIDs []string) (found []model.Order, missing []string, err error) {
+	seen := make(map[string]struct{}, len(orderUIDs))
+	uids := make([]string, 0, len(orderUIDs))
+	byUID := make(map[string]model.Order, len(orderUIDs))
+	var misses []string
+	for _, uid := range orderUIDs {
+		if _, ok := seen[uid]; ok {
+			continue
+		}
+		seen[uid] = struct{}{}
+		uids = append(uids, uid)
+
+		if order, ok := s.cache.Get(uid); ok {
+			s.metrics.CacheHits.Inc()
+			byUID[uid] = order
+			continue
+		}
+		s.metrics.CacheMisses.Inc()
+		misses = append(misses, uid)
+	}
+
+	if len(misses) > 0 {
+		loaded, err := s.db.GetOrdersByUIDs(ctx, misses)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, order := range loaded {
+			s.cache.Set(order.OrderUID, order)
+			byUID[order.OrderUID] = order
+		}
+		slog.Debug("Batch misses loaded from DB", "requested", len(misses), "found", len(loaded))
+	}
+
+	for _, uid := range uids {
+		if order, ok := byUID[uid]; ok {
+			found = append(found, order)
+		} else {
+			missing = append(missing, uid)
+		}
+	}
+	return found, missing, nil
+}
+
+// List возвращает страницу заказов от новых к старым и токен следующей страницы.
+// Пустой токен означает первую страницу в запросе и последнюю в ответе
+func (s *Service) List(ctx context.Context, pageSize int, pageToken string) ([]model.Order, string, error) {
+	var after *storage.OrderCursor
+	if pageToken != "" {
+		cursor, err := decodePageToken(pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &cursor
+	}
+
+	orders, err := s.db.ListOrders(ctx, pageSize, after)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(orders) == pageSize {
+		last := orders[len(orders)-1]
+		next = encodePageToken(storage.OrderCursor{DateCreated: last.DateCreated, OrderUID: last.OrderUID})
+	}
+	return orders, next, nil
+}
+
+// токен страницы - base64 от "время|order_uid" последнего заказа страницы
+func encodePageToken(c storage.OrderCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.DateCreated.UTC().Format(time.RFC3339Nano) + "|" + c.OrderUID))
+}
+
+func decodePageToken(token string) (storage.OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return storage.OrderCursor{}, ErrInvalidPageToken
+	}
+	ts, uid, ok := strings.Cut(string(raw), "|")
+	if !ok || uid == "" {
+		return storage.OrderCursor{}, ErrInvalidPageToken
+	}
+	dateCreated, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return storage.OrderCursor{}, ErrInvalidPageToken
+	}
+	return storage.OrderCursor{DateCreated: dateCreated, OrderUID: uid}, nil
+}
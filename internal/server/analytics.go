@@ -0,0 +1,261 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"test_task_wb/internal/auth"
+	"test_task_wb/internal/storage"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// defaultAnalyticsRange - интервал отчёта, если ?from= не указан
+	defaultAnalyticsRange = 30 * 24 * time.Hour
+	// maxAnalyticsRange ограничивает интервал отчёта, чтобы один запрос не сканировал всю историю
+	maxAnalyticsRange = 366 * 24 * time.Hour
+	// defaultTopLimit и maxTopLimit - число строк в топах по умолчанию и максимум
+	defaultTopLimit = 10
+	maxTopLimit     = 100
+)
+
+// errBadParam - ошибка в параметрах отчёта, её текст уходит клиенту
+type errBadParam struct{ msg string }
+
+func (e errBadParam) Error() string { return e.msg }
+
+// analyticsReport - отчёт с интервалом, за который он посчитан
+type analyticsReport[T any] struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	Rows []T       `json:"rows"`
+}
+
+// mountAnalytics монтирует отчёты, которые считаются в Postgres
+func (s *Server) mountAnalytics(r chi.Router) {
+	r.Get("/revenue", s.handleRevenue())
+	r.Get("/top-brands", s.handleTopItems(storage.GroupByBrand))
+	r.Get("/top-products", s.handleTopItems(storage.GroupByNmID))
+	r.Get("/delivery-costs", s.handleDeliveryCosts())
+	r.Get("/locations", s.handleLocations())
+	r.Get("/sales", s.handleSales())
+}
+
+// handleRevenue возвращает обработчик отчёта о выручке по дням и валютам
+func (s *Server) handleRevenue() http.HandlerFunc {
+	return analyticsHandler("revenue",
+		[]string{"day", "currency", "orders", "revenue"},
+		func(r *http.Request, tr storage.TimeRange) ([]storage.DailyRevenue, error) {
+			return s.DB.RevenueByDay(r.Context(), tr)
+		},
+		func(d storage.DailyRevenue) []string {
+			return []string{d.Day.Format(time.DateOnly), d.Currency, itoa(d.Orders), itoa(d.Revenue)}
+		})
+}
+
+// handleTopItems возвращает обработчик топа брендов или артикулов. ?order_by=units|revenue, ?limit=
+func (s *Server) handleTopItems(by storage.ItemGrouping) http.HandlerFunc {
+	return analyticsHandler("top-"+string(by),
+		[]string{string(by), "currency", "units", "revenue"},
+		func(r *http.Request, tr storage.TimeRange) ([]storage.ItemStat, error) {
+			order := storage.ItemOrder(r.URL.Query().Get("order_by"))
+			switch order {
+			case "":
+				order = storage.OrderByUnits
+			case storage.OrderByUnits, storage.OrderByRevenue:
+			default:
+				return nil, errBadParam{"Query parameter 'order_by' must be 'units' or 'revenue'"}
+			}
+			limit, err := topLimit(r)
+			if err != nil {
+				return nil, err
+			}
+			return s.DB.TopItems(r.Context(), tr, by, order, limit)
+		},
+		func(st storage.ItemStat) []string {
+			return []string{st.Key, st.Currency, itoa(st.Units), itoa(st.Revenue)}
+		})
+}
+
+// handleDeliveryCosts возвращает обработчик отчёта о средней стоимости доставки по службам
+func (s *Server) handleDeliveryCosts() http.HandlerFunc {
+	return analyticsHandler("delivery-costs",
+		[]string{"delivery_service", "currency", "orders", "avg_delivery_cost"},
+		func(r *http.Request, tr storage.TimeRange) ([]storage.DeliveryCostStat, error) {
+			return s.DB.DeliveryCosts(r.Context(), tr)
+		},
+		func(st storage.DeliveryCostStat) []string {
+			return []string{st.DeliveryService, st.Currency, itoa(st.Orders), ftoa(st.AvgCost)}
+		})
+}
+
+// handleLocations возвращает обработчик отчёта о числе заказов по регионам или городам. ?by=region|city, ?limit=
+func (s *Server) handleLocations() http.HandlerFunc {
+	return analyticsHandler("locations",
+		[]string{"location", "orders"},
+		func(r *http.Request, tr storage.TimeRange) ([]storage.LocationStat, error) {
+			by := storage.LocationGrouping(r.URL.Query().Get("by"))
+			switch by {
+			case "":
+				by = storage.GroupByRegion
+			case storage.GroupByRegion, storage.GroupByCity:
+			default:
+				return nil, errBadParam{"Query parameter 'by' must be 'region' or 'city'"}
+			}
+			limit, err := topLimit(r)
+			if err != nil {
+				return nil, err
+			}
+			return s.DB.OrdersByLocation(r.Context(), tr, by, limit)
+		},
+		func(st storage.LocationStat) []string {
+			return []string{st.Location, itoa(st.Orders)}
+		})
+}
+
+// handleSales возвращает обработчик отчёта о средней скидке; отчёт состоит из одной строки
+func (s *Server) handleSales() http.HandlerFunc {
+	return analyticsHandler("sales",
+		[]string{"items", "discounted_items", "avg_sale", "avg_discounted_sale"},
+		func(r *http.Request, tr storage.TimeRange) ([]storage.SaleStat, error) {
+			st, err := s.DB.AverageSale(r.Context(), tr)
+			if err != nil {
+				return nil, err
+			}
+			return []storage.SaleStat{st}, nil
+		},
+		func(st storage.SaleStat) []string {
+			return []string{itoa(st.Items), itoa(st.DiscountedItems), ftoa(st.AvgSale), ftoa(st.AvgDiscountedSale)}
+		})
+}
+
+// analyticsHandler разбирает интервал, строит отчёт через query и отдает его в JSON или, с ?format=csv
+// либо Accept: text/csv, в CSV с колонками columns
+func analyticsHandler[T any](name string, columns []string,
+	query func(*http.Request, storage.TimeRange) ([]T, error), record func(T) []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		asCSV, err := wantsCSV(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tr, err := parseTimeRange(r, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rows, err := query(r, tr)
+		if err != nil {
+			var bad errBadParam
+			if errors.As(err, &bad) {
+				http.Error(w, bad.msg, http.StatusBadRequest)
+				return
+			}
+			slog.Error("Failed to build analytics report", "error", err, "report", name, "principal", auth.FromContext(r.Context()).Name)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if asCSV {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+			w.WriteHeader(http.StatusOK)
+			cw := csv.NewWriter(w)
+			_ = cw.Write(columns)
+			for _, row := range rows {
+				_ = cw.Write(record(row))
+			}
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				slog.Warn("Failed to write CSV report", "error", err, "report", name)
+			}
+			return
+		}
+
+		if rows == nil {
+			rows = []T{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(analyticsReport[T]{From: tr.From, To: tr.To, Rows: rows}); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
+
+// parseTimeRange читает ?from= и ?to= в формате RFC 3339 или YYYY-MM-DD (полночь UTC).
+// По умолчанию отчёт строится за последние 30 дней до now
+func parseTimeRange(r *http.Request, now time.Time) (storage.TimeRange, error) {
+	q := r.URL.Query()
+	tr := storage.TimeRange{To: now.UTC()}
+
+	if v := q.Get("to"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return storage.TimeRange{}, errBadParam{"Query parameter 'to' must be RFC 3339 or YYYY-MM-DD"}
+		}
+		tr.To = t
+	}
+	tr.From = tr.To.Add(-defaultAnalyticsRange)
+	if v := q.Get("from"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return storage.TimeRange{}, errBadParam{"Query parameter 'from' must be RFC 3339 or YYYY-MM-DD"}
+		}
+		tr.From = t
+	}
+
+	if !tr.From.Before(tr.To) {
+		return storage.TimeRange{}, errBadParam{"'from' must be before 'to'"}
+	}
+	if tr.To.Sub(tr.From) > maxAnalyticsRange {
+		return storage.TimeRange{}, errBadParam{"Time range must not exceed 366 days"}
+	}
+	return tr, nil
+}
+
+func parseTimeParam(v string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t.UTC(), err
+}
+
+// wantsCSV выбирает формат ответа: параметр ?format= важнее заголовка Accept
+func wantsCSV(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		return true, nil
+	case "json":
+		return false, nil
+	case "":
+		return strings.Contains(r.Header.Get("Accept"), "text/csv"), nil
+	default:
+		return false, errBadParam{"Query parameter 'format' must be 'json' or 'csv'"}
+	}
+}
+
+// topLimit читает ?limit= для отчётов-топов
+func topLimit(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultTopLimit, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > maxTopLimit {
+		return 0, errBadParam{"Query parameter 'limit' must be between 1 and " + strconv.Itoa(maxTopLimit)}
+	}
+	return n, nil
+}
+
+func itoa(n int64) string { return strconv.FormatInt(n, 10) }
+
+func ftoa(f float64) string { return strconv.FormatFloat(f, 'f', 2, 64) }
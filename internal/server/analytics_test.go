@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"test_task_wb/internal/cache"
+	"test_task_wb/internal/metrics"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimeRange(t *testing.T) {
+	now := time.Date(2025, 3, 15, 12, 0, 0, 0, time.UTC)
+	parse := func(query string) (time.Time, time.Time, error) {
+		tr, err := parseTimeRange(httptest.NewRequest(http.MethodGet, "/analytics/revenue?"+query, nil), now)
+		return tr.From, tr.To, err
+	}
+
+	from, to, err := parse("")
+	require.NoError(t, err)
+	require.Equal(t, now, to)
+	require.Equal(t, now.Add(-30*24*time.Hour), from, "По умолчанию отчёт строится за 30 дней")
+
+	from, to, err = parse("from=2025-01-01&to=2025-02-01T10:00:00%2B03:00")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), from)
+	require.Equal(t, time.Date(2025, 2, 1, 7, 0, 0, 0, time.UTC), to, "Время должно приводиться к UTC")
+
+	for _, query := range []string{"from=yesterday", "from=2025-02-01&to=2025-01-01", "from=2023-01-01&to=2025-01-01"} {
+		_, _, err := parse(query)
+		require.Error(t, err, "Интервал %q должен отклоняться", query)
+	}
+}
+
+func TestAnalyticsValidation(t *testing.T) {
+	// некорректные параметры отклоняются до обращения к БД
+	server := NewServer(cache.NewLRUCache(10), metrics.NewMetrics(), nil)
+
+	for _, path := range []string{
+		"/analytics/revenue?format=xml",
+		"/analytics/revenue?from=2025-13-01",
+		"/analytics/top-brands?order_by=price",
+		"/analytics/top-products?limit=0",
+		"/analytics/locations?by=street",
+	} {
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusBadRequest, rr.Code, "Запрос %s должен отклоняться", path)
+	}
+}
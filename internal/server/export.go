@@ -0,0 +1,121 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"test_task_wb/internal/auth"
+	"test_task_wb/internal/export"
+	"test_task_wb/internal/storage"
+	"time"
+)
+
+// exportWriteTimeout - сколько ждать записи очередной порции выгрузки; клиент, не читающий ответ дольше, отключается
+const exportWriteTimeout = 30 * time.Second
+
+// handleExportOrders возвращает обработчик выгрузки товаров заказов с полями заказа, оплаты и доставки.
+// ?format=csv|ndjson|parquet (по умолчанию csv), фильтры ?from=, ?to=, ?delivery_service=, ?customer_id=.
+// Ответ пишется по мере чтения курсора БД, поэтому выгрузка не ограничена WriteTimeout сервера
+func (s *Server) handleExportOrders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		setAuditTargets(r, exportAuditTarget(query))
+
+		format := export.CSV
+		if v := query.Get("format"); v != "" {
+			f, err := export.ParseFormat(v)
+			if err != nil {
+				http.Error(w, "Query parameter 'format' must be 'csv', 'ndjson' or 'parquet'", http.StatusBadRequest)
+				return
+			}
+			format = f
+		}
+		filter, err := parseExportFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ew := &exportResponseWriter{w: w, rc: http.NewResponseController(w)}
+		out, err := export.NewWriter(ew, format, export.None)
+		if err != nil {
+			slog.Error("Failed to create export writer", "error", err, "format", format)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", `attachment; filename="orders`+export.Extension(format, export.None)+`"`)
+
+		p := auth.FromContext(r.Context())
+		n, err := s.DB.ExportOrders(r.Context(), filter, out.Write)
+		if err == nil {
+			err = out.Close()
+		}
+		if err != nil {
+			if !ew.written {
+				slog.Error("Failed to export orders", "error", err, "principal", p.Name)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			// часть ответа уже отправлена: обрыв соединения не даёт клиенту принять неполный файл за целый
+			slog.Error("Order export interrupted", "error", err, "rows", n, "principal", p.Name)
+			panic(http.ErrAbortHandler)
+		}
+		slog.Info("Orders exported", "rows", n, "format", format, "principal", p.Name)
+	}
+}
+
+// parseExportFilter читает фильтры выгрузки; формат дат тот же, что в отчётах аналитики
+func parseExportFilter(r *http.Request) (storage.ExportFilter, error) {
+	q := r.URL.Query()
+	f := storage.ExportFilter{
+		DeliveryService: q.Get("delivery_service"),
+		CustomerID:      q.Get("customer_id"),
+	}
+	if v := q.Get("from"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return storage.ExportFilter{}, errBadParam{"Query parameter 'from' must be RFC 3339 or YYYY-MM-DD"}
+		}
+		f.From = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return storage.ExportFilter{}, errBadParam{"Query parameter 'to' must be RFC 3339 or YYYY-MM-DD"}
+		}
+		f.To = t
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return storage.ExportFilter{}, errBadParam{"'from' must be before 'to'"}
+	}
+	return f, nil
+}
+
+// exportAuditTarget описывает фильтр выгрузки для журнала аудита; пустая строка - выгружались все заказы
+func exportAuditTarget(query url.Values) string {
+	filter := url.Values{}
+	for _, key := range []string{"from", "to", "delivery_service", "customer_id"} {
+		if v := query.Get(key); v != "" {
+			filter.Set(key, v)
+		}
+	}
+	return filter.Encode()
+}
+
+// exportResponseWriter продлевает дедлайн записи перед каждой порцией и запоминает,
+// ушло ли клиенту хоть что-то: до этого об ошибке ещё можно сообщить кодом ответа
+type exportResponseWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	written bool
+}
+
+func (e *exportResponseWriter) Write(p []byte) (int, error) {
+	if err := e.rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return 0, err
+	}
+	e.written = true
+	return e.w.Write(p)
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"test_task_wb/internal/cache"
+	"test_task_wb/internal/metrics"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportValidation(t *testing.T) {
+	// некорректные параметры отклоняются до открытия курсора в БД
+	server := NewServer(cache.NewLRUCache(10), metrics.NewMetrics(), nil)
+
+	for _, path := range []string{
+		"/orders/export?format=xlsx",
+		"/orders/export?from=yesterday",
+		"/orders/export?to=2025-02-30",
+		"/orders/export?from=2025-03-02&to=2025-03-01",
+	} {
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusBadRequest, rr.Code, "Запрос %s должен отклоняться", path)
+	}
+}
@@ -1,17 +1,30 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
+	"test_task_wb/internal/audit"
+	"test_task_wb/internal/auth"
+	"test_task_wb/internal/broker"
 	"test_task_wb/internal/cache"
+	"test_task_wb/internal/health"
+	"test_task_wb/internal/masking"
 	"test_task_wb/internal/metrics"
+	"test_task_wb/internal/model"
+	"test_task_wb/internal/orders"
 	"test_task_wb/internal/storage"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Server struct {
@@ -19,31 +32,216 @@ type Server struct {
 	Cache   cache.OrderCache
 	Metrics *metrics.Metrics
 	DB      *storage.Storage
+	Orders  *orders.Service
+	Masking masking.Policy
+	Auth    *auth.Authenticator
+	Audit   *audit.Recorder
+	Lag     *broker.LagMonitor
+	Health  *health.Checker
+	Limiter *RateLimiter
+	Feed    *orders.Feed
+}
+
+// Option настраивает дополнительные параметры сервера
+type Option func(*Server)
+
+// WithMaskingPolicy задает политику маскирования персональных данных в ответах
+func WithMaskingPolicy(p masking.Policy) Option {
+	return func(s *Server) {
+		s.Masking = p
+	}
+}
+
+// WithAuthenticator включает аутентификацию запросов к API
+func WithAuthenticator(a *auth.Authenticator) Option {
+	return func(s *Server) {
+		s.Auth = a
+	}
+}
+
+// WithAuditRecorder включает журнал аудита обращений к заказам
+func WithAuditRecorder(rec *audit.Recorder) Option {
+	return func(s *Server) {
+		s.Audit = rec
+	}
+}
+
+// WithLagMonitor включает эндпоинт с состоянием Kafka-консьюмера
+func WithLagMonitor(lm *broker.LagMonitor) Option {
+	return func(s *Server) {
+		s.Lag = lm
+	}
+}
+
+// WithHealthChecks монтирует публичные эндпоинты /healthz, /readyz и /startupz
+func WithHealthChecks(h *health.Checker) Option {
+	return func(s *Server) {
+		s.Health = h
+	}
+}
+
+// WithRateLimiter включает ограничение частоты запросов к API
+func WithRateLimiter(rl *RateLimiter) Option {
+	return func(s *Server) {
+		s.Limiter = rl
+	}
+}
+
+// WithFeed включает живую ленту заказов по SSE и WebSocket
+func WithFeed(f *orders.Feed) Option {
+	return func(s *Server) {
+		s.Feed = f
+	}
 }
 
 // NewServer создает новый экземпляр сервера с зависимостями
-func NewServer(c cache.OrderCache, m *metrics.Metrics, db *storage.Storage) *Server {
+func NewServer(c cache.OrderCache, m *metrics.Metrics, db *storage.Storage, opts ...Option) *Server {
 	s := &Server{
 		Router:  chi.NewRouter(),
 		Cache:   c,
 		Metrics: m,
 		DB:      db,
+		Orders:  orders.NewService(c, m, db),
+		Masking: masking.DefaultPolicy,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
-	s.Router.Use(s.metricsMiddleware)
+	s.Router.Use(otelhttp.NewMiddleware("http.server"), s.tracingMiddleware, s.metricsMiddleware)
 	s.initRoutes()
 	return s
 }
 
 func (s *Server) initRoutes() {
-	s.Router.Get("/order/{orderUID}", s.handleGetOrder())
+	if s.Health != nil {
+		s.Health.Register(s.Router)
+	}
+
+	s.Router.Group(func(r chi.Router) {
+		r.Use(auth.Middleware(s.Auth))
+		if s.Limiter != nil {
+			r.Use(s.Limiter.Middleware)
+		}
+
+		r.With(auth.RequireScope(auth.ScopeRead)).
+			Get("/order/{orderUID}", s.withAudit("order.get", "orderUID", s.handleGetOrder()))
+		r.With(auth.RequireScope(auth.ScopeRead)).
+			Get("/track/{trackNumber}", s.withAudit("order.get_by_track", "trackNumber", s.handleGetOrderBy(cache.KeyTrackNumber, "trackNumber")))
+		r.With(auth.RequireScope(auth.ScopeRead)).
+			Get("/payment/{transaction}", s.withAudit("order.get_by_transaction", "transaction", s.handleGetOrderBy(cache.KeyTransaction, "transaction")))
+		r.With(auth.RequireScope(auth.ScopeRead)).
+			Get("/item/{rid}", s.withAudit("order.get_by_rid", "rid", s.handleGetOrderBy(cache.KeyItemRID, "rid")))
+		r.With(auth.RequireScope(auth.ScopeRead)).
+			Post("/orders/batch-get", s.withAudit("order.batch_get", "", s.handleBatchGetOrders()))
+		r.With(auth.RequireScope(auth.ScopeRead)).
+			Get("/orders/search", s.withAudit("order.search", "", s.handleSearchOrders()))
+		r.With(auth.RequireScope(auth.ScopeAnalytics)).
+			Get("/orders/export", s.withAudit("order.export", "", s.handleExportOrders()))
+		r.With(auth.RequireScope(auth.ScopeWrite)).
+			Delete("/order/{orderUID}", s.withAudit("order.delete", "orderUID", s.handleDeleteOrder()))
+		r.With(auth.RequireScope(auth.ScopeAdmin)).
+			Post("/admin/customers/{customerID}/erase", s.withAudit("customer.erase", "customerID", s.handleEraseCustomer()))
+		r.With(auth.RequireScope(auth.ScopeAdmin)).
+			Post("/admin/cache/warm", s.withAudit("cache.warm", "", s.handleWarmCache()))
+		if s.Feed != nil {
+			r.With(auth.RequireScope(auth.ScopeRead)).
+				Get("/orders/stream", s.handleOrderStream())
+			r.With(auth.RequireScope(auth.ScopeRead)).
+				Get("/orders/ws", s.handleOrderWebSocket())
+		}
+		r.With(auth.RequireScope(auth.ScopeAnalytics)).
+			Route("/analytics", s.mountAnalytics)
+		if s.Lag != nil {
+			r.With(auth.RequireScope(auth.ScopeAdmin)).
+				Get("/admin/consumer", s.handleConsumerStatus())
+		}
+	})
+}
+
+// maxAuditTarget - длина столбца access_log.target в символах
+const maxAuditTarget = 255
+
+type auditTargetsKey struct{}
+
+// setAuditTargets сообщает withAudit, к каким объектам обратился запрос, если их нет в URL-параметрах:
+// например, UID пакетного чтения. На каждый объект в журнал пишется отдельная запись
+func setAuditTargets(r *http.Request, targets ...string) {
+	if t, ok := r.Context().Value(auditTargetsKey{}).(*[]string); ok {
+		*t = targets
+	}
 }
 
-// metricsMiddleware добавляет метрики к ответам
+// withAudit записывает в журнал аудита, кто обратился к объекту из URL-параметра param (или к объектам,
+// переданным обработчиком через setAuditTargets) и с каким результатом.
+// Запись делается и тогда, когда обработчик оборвал ответ: часть данных к этому моменту уже отдана
+func (s *Server) withAudit(action, param string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		targets := new([]string)
+		r = r.WithContext(context.WithValue(r.Context(), auditTargetsKey{}, targets))
+		defer func() {
+			p := auth.FromContext(r.Context())
+			list := *targets
+			if param != "" {
+				list = []string{chi.URLParam(r, param)}
+			}
+			if len(list) == 0 {
+				list = []string{""}
+			}
+			for _, target := range list {
+				s.Audit.Record(audit.Entry{
+					Principal:  p.Name,
+					AuthMethod: p.Method,
+					Action:     action,
+					Target:     truncateRunes(target, maxAuditTarget),
+					Status:     ww.Status(),
+				})
+			}
+		}()
+		next.ServeHTTP(ww, r)
+	}
+}
+
+// truncateRunes обрезает строку до n символов, не разрывая многобайтовые символы
+func truncateRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// tracingMiddleware называет серверный спан по шаблону маршрута chi (например, "GET /order/{orderUID}").
+// Шаблон становится известен только после маршрутизации, поэтому имя задаётся после обработки запроса
+func (s *Server) tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			return
+		}
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(attribute.String("http.route", route))
+	})
+}
+
+// metricsMiddleware добавляет метрики к ответам: счётчик и латентность по шаблону маршрута chi
 func (s *Server) metricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
 		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 		next.ServeHTTP(ww, r)
-		s.Metrics.HTTPServerReqs.WithLabelValues(strconv.Itoa(ww.Status()), r.Method).Inc()
+
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "unmatched"
+		}
+		s.Metrics.HTTPServerReqs.WithLabelValues(strconv.Itoa(ww.Status()), r.Method, route).Inc()
+		s.Metrics.HTTPRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
 	})
 }
 
@@ -56,40 +254,270 @@ func (s *Server) handleGetOrder() http.HandlerFunc {
 			return
 		}
 
-		order, found := s.Cache.Get(orderUID)
-		if found {
-			slog.Debug("Cache hit", "order_uid", orderUID)
-			s.Metrics.CacheHits.Inc()
+		order, err := s.Orders.Get(r.Context(), orderUID)
+		if err != nil {
+			if errors.Is(err, storage.ErrOrderNotFound) {
+				http.Error(w, "Order not found", http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, storage.ErrOrderDeleted) {
+				http.Error(w, "Order has been cancelled", http.StatusGone)
+				return
+			}
+
+			slog.Error("Failed to get order from DB", "error", err, "order_uid", orderUID, "principal", auth.FromContext(r.Context()).Name)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		s.writeOrder(w, r, order)
+	}
+}
+
+// handleGetOrderBy возвращает обработчик поиска заказа по вторичному ключу из URL-параметра param
+func (s *Server) handleGetOrderBy(kind cache.KeyKind, param string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := chi.URLParam(r, param)
+		if key == "" {
+			http.Error(w, "Lookup key is required", http.StatusBadRequest)
+			return
+		}
+
+		order, err := s.Orders.GetBy(r.Context(), kind, key)
+		if err != nil {
+			if errors.Is(err, storage.ErrOrderNotFound) {
+				http.Error(w, "Order not found", http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, storage.ErrOrderDeleted) {
+				http.Error(w, "Order has been cancelled", http.StatusGone)
+				return
+			}
+
+			slog.Error("Failed to look up order", "error", err, "key_kind", kind, "key", key, "principal", auth.FromContext(r.Context()).Name)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		s.writeOrder(w, r, order)
+	}
+}
+
+// writeOrder отдает заказ в формате JSON, маскируя персональные данные согласно роли вызывающего
+func (s *Server) writeOrder(w http.ResponseWriter, r *http.Request, order model.Order) {
+	projected, err := s.projectOrder(r, order)
+	if err != nil {
+		slog.Error("Failed to apply masking policy", "error", err, "order_uid", order.OrderUID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(projected); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// batchGetRequest - тело запроса POST /orders/batch-get
+type batchGetRequest struct {
+	OrderUIDs []string `json:"order_uids"`
+}
+
+// batchGetResponse - найденные заказы в порядке запроса и UID, которых нет или которые отменены
+type batchGetResponse struct {
+	Orders  []any    `json:"orders"`
+	Missing []string `json:"missing"`
+}
+
+// maxBatchGetBody ограничивает тело запроса пакетного чтения: 500 UID с запасом помещаются в 64 КиБ
+const maxBatchGetBody = 64 << 10
+
+// handleBatchGetOrders возвращает обработчик пакетного чтения заказов.
+// Попадания в кэш отдаются сразу, промахи загружаются из БД одним запросом
+func (s *Server) handleBatchGetOrders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req batchGetRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchGetBody)).Decode(&req); err != nil {
+			http.Error(w, "Request body must be a JSON object with 'order_uids'", http.StatusBadRequest)
+			return
+		}
+		if len(req.OrderUIDs) == 0 {
+			http.Error(w, "'order_uids' must not be empty", http.StatusBadRequest)
+			return
+		}
+		if len(req.OrderUIDs) > orders.MaxBatchSize {
+			http.Error(w, "Too many order UIDs, at most "+strconv.Itoa(orders.MaxBatchSize)+" are allowed", http.StatusBadRequest)
+			return
+		}
+		if slices.Contains(req.OrderUIDs, "") {
+			http.Error(w, "Order UIDs must not be empty", http.StatusBadRequest)
+			return
+		}
+		// каждый запрошенный заказ попадает в журнал отдельно, как при одиночном чтении
+		setAuditTargets(r, slices.Compact(slices.Sorted(slices.Values(req.OrderUIDs)))...)
+
+		p := auth.FromContext(r.Context())
+
+		found, missing, err := s.Orders.BatchGet(r.Context(), req.OrderUIDs)
+		if err != nil {
+			slog.Error("Failed to batch get orders", "error", err, "count", len(req.OrderUIDs), "principal", p.Name)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := batchGetResponse{Orders: make([]any, 0, len(found)), Missing: missing}
+		if resp.Missing == nil {
+			resp.Missing = []string{}
+		}
+		for _, order := range found {
+			projected, err := s.projectOrder(r, order)
+			if err != nil {
+				slog.Error("Failed to apply masking policy", "error", err, "order_uid", order.OrderUID)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			resp.Orders = append(resp.Orders, projected)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
+
+// projectOrder маскирует персональные данные заказа согласно роли вызывающего.
+// Без области доступа pii применяется роль по умолчанию
+func (s *Server) projectOrder(r *http.Request, order model.Order) (any, error) {
+	p := auth.FromContext(r.Context())
+	role := p.Role
+	if !p.HasScope(auth.ScopePII) {
+		role = s.Masking.DefaultRole
+	}
+	return s.Masking.Apply(role, order)
+}
+
+// handleDeleteOrder возвращает обработчик административного удаления заказа.
+// По умолчанию заказ отменяется (мягкое удаление), с параметром ?mode=hard удаляется из БД полностью
+func (s *Server) handleDeleteOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orderUID := chi.URLParam(r, "orderUID")
+		if orderUID == "" {
+			http.Error(w, "Order UID is required", http.StatusBadRequest)
+			return
+		}
+
+		p := auth.FromContext(r.Context())
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			if err := json.NewEncoder(w).Encode(order); err != nil {
-				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		var err error
+		switch mode := r.URL.Query().Get("mode"); mode {
+		case "", "soft":
+			err = s.DB.CancelOrder(r.Context(), orderUID)
+		case "hard":
+			if !p.HasScope(auth.ScopeAdmin) {
+				http.Error(w, "Forbidden: missing scope "+auth.ScopeAdmin, http.StatusForbidden)
+				return
 			}
+			err = s.DB.DeleteOrder(r.Context(), orderUID)
+		default:
+			http.Error(w, "Unknown delete mode, expected 'soft' or 'hard'", http.StatusBadRequest)
 			return
 		}
 
-		slog.Debug("Cache miss", "order_uid", orderUID)
-		s.Metrics.CacheMisses.Inc()
+		s.Cache.Delete(orderUID)
 
-		order, err := s.DB.GetOrderByUID(r.Context(), orderUID)
 		if err != nil {
 			if errors.Is(err, storage.ErrOrderNotFound) {
 				http.Error(w, "Order not found", http.StatusNotFound)
 				return
 			}
 
-			slog.Error("Failed to get order from DB", "error", err, "order_uid", orderUID)
+			slog.Error("Failed to delete order from DB", "error", err, "order_uid", orderUID, "principal", p.Name)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		s.Cache.Set(order.OrderUID, order)
-		slog.Debug("Order retrieved from DB and cached", "order_uid", orderUID)
+		slog.Info("Order removed via admin API", "order_uid", orderUID, "mode", r.URL.Query().Get("mode"), "principal", p.Name)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleEraseCustomer возвращает обработчик удаления персональных данных клиента.
+// После обезличивания в БД затронутые заказы вытесняются из кэша
+func (s *Server) handleEraseCustomer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customerID := chi.URLParam(r, "customerID")
+		if customerID == "" {
+			http.Error(w, "Customer ID is required", http.StatusBadRequest)
+			return
+		}
+
+		p := auth.FromContext(r.Context())
+
+		result, err := s.DB.EraseCustomer(r.Context(), customerID, "api:"+p.Name)
+		if err != nil {
+			slog.Error("Failed to erase customer data", "error", err, "customer_id", customerID, "principal", p.Name)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		for _, uid := range result.OrderUIDs {
+			s.Cache.Delete(uid)
+		}
+		slog.Info("Customer data erased via admin API", "customer_id", customerID, "orders_affected", len(result.OrderUIDs), "principal", p.Name)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
+
+// handleConsumerStatus возвращает обработчик с последним срезом состояния Kafka-консьюмера:
+// отставание по партициям, распределение партиций и счётчики ридера
+func (s *Server) handleConsumerStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(s.Lag.Snapshot()); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
+
+// maxWarmLimit - сколько заказов самое большее загружает один прогрев кэша
+const maxWarmLimit = 10_000
+
+// handleWarmCache возвращает обработчик прогрева кэша: последние ?limit= заказов загружаются из БД.
+// limit ограничивается maxWarmLimit, чтобы один запрос не читал в память всю таблицу заказов
+func (s *Server) handleWarmCache() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			http.Error(w, "Query parameter 'limit' must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(limit, maxWarmLimit)
+
+		p := auth.FromContext(r.Context())
+
+		loaded, err := s.DB.GetAllOrders(r.Context(), limit)
+		if err != nil {
+			slog.Error("Failed to load orders for cache warm-up", "error", err, "principal", p.Name)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		for _, order := range loaded {
+			s.Cache.Set(order.OrderUID, order)
+		}
+		slog.Info("Cache warmed via admin API", "orders_loaded", len(loaded), "limit", limit, "principal", p.Name)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(order); err != nil {
+		if err := json.NewEncoder(w).Encode(map[string]int{"orders_loaded": len(loaded)}); err != nil {
 			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		}
 	}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"test_task_wb/internal/auth"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTTL - через сколько неактивный клиент забывается
+const limiterIdleTTL = 10 * time.Minute
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter ограничивает частоту запросов каждого клиента (по имени вызывающего или IP).
+// Лимиты можно менять на лету, они применяются и к уже известным клиентам
+type RateLimiter struct {
+	mu      sync.Mutex
+	limit   rate.Limit
+	burst   int
+	clients map[string]*clientLimiter
+	lastGC  time.Time
+}
+
+// NewRateLimiter создает ограничитель на rps запросов в секунду с запасом burst.
+// rps <= 0 отключает ограничение
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	rl := &RateLimiter{clients: make(map[string]*clientLimiter)}
+	rl.SetLimits(rps, burst)
+	return rl
+}
+
+// SetLimits меняет лимиты для всех клиентов
+func (rl *RateLimiter) SetLimits(rps float64, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.limit = rate.Limit(rps)
+	if rps <= 0 {
+		rl.limit = rate.Inf
+	}
+	rl.burst = max(burst, 1)
+	now := time.Now()
+	for _, c := range rl.clients {
+		c.limiter.SetLimitAt(now, rl.limit)
+		c.limiter.SetBurstAt(now, rl.burst)
+	}
+}
+
+// Limits возвращает текущие лимиты; rps == 0 означает отсутствие ограничения
+func (rl *RateLimiter) Limits() (rps float64, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.limit == rate.Inf {
+		return 0, rl.burst
+	}
+	return float64(rl.limit), rl.burst
+}
+
+// allow сообщает, можно ли обслужить запрос клиента key
+func (rl *RateLimiter) allow(key string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.limit == rate.Inf {
+		return true
+	}
+
+	now := time.Now()
+	if now.Sub(rl.lastGC) > limiterIdleTTL {
+		for k, c := range rl.clients {
+			if now.Sub(c.lastSeen) > limiterIdleTTL {
+				delete(rl.clients, k)
+			}
+		}
+		rl.lastGC = now
+	}
+
+	c, ok := rl.clients[key]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.clients[key] = c
+	}
+	c.lastSeen = now
+	return c.limiter.AllowN(now, 1)
+}
+
+// Middleware отвечает 429, если клиент превысил лимит. Должен стоять после аутентификации,
+// чтобы аутентифицированные клиенты различались по имени, а не по IP
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := clientKey(r)
+		if !rl.allow(key) {
+			rps, _ := rl.Limits()
+			slog.Warn("Rate limit exceeded", "client", key, "path", r.URL.Path)
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(1/rps), 1)))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientKey - анонимные клиенты различаются по IP, остальные по имени вызывающего
+func clientKey(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p.Method != auth.MethodAnonymous {
+		return p.Method + ":" + p.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := NewRateLimiter(1, 2)
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/order/x", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	require.Equal(t, http.StatusOK, do("10.0.0.1:1000"))
+	require.Equal(t, http.StatusOK, do("10.0.0.1:1001"))
+	require.Equal(t, http.StatusTooManyRequests, do("10.0.0.1:1002"), "Запросы сверх burst должны отклоняться")
+	require.Equal(t, http.StatusOK, do("10.0.0.2:1000"), "Лимит считается для каждого клиента отдельно")
+
+	rl.SetLimits(0, 1)
+	require.Equal(t, http.StatusOK, do("10.0.0.1:1003"), "Нулевой лимит отключает ограничение на лету")
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"test_task_wb/internal/auth"
+	"test_task_wb/internal/model"
+	"test_task_wb/internal/orders"
+)
+
+// defaultSearchLimit - размер страницы поиска, если ?limit= не указан
+const defaultSearchLimit = 20
+
+// searchResult - найденный заказ в ответе поиска
+type searchResult struct {
+	Order      any                `json:"order"`
+	Rank       float64            `json:"rank"`
+	Highlights []orders.Highlight `json:"highlights"`
+}
+
+// searchResponse - страница результатов. NextOffset отсутствует на последней странице.
+// PIISearchIncomplete заполняется, когда поиск по персональным полям мог пропустить заказы:
+// ключ слепого индекса не задан или у части зашифрованных строк доставки ещё нет меток pii_tokens
+type searchResponse struct {
+	Results             []searchResult `json:"results"`
+	NextOffset          *int           `json:"next_offset,omitempty"`
+	PIISearchIncomplete string         `json:"pii_search_incomplete,omitempty"`
+}
+
+// handleSearchOrders возвращает обработчик поиска заказов по товарам, бренду, городу и данным получателя.
+// Персональные поля доставки ищутся и подсвечиваются только для вызывающих с областью pii;
+// если часть зашифрованных строк доставки не попала в слепой индекс, ответ говорит об этом в pii_search_incomplete
+func (s *Server) handleSearchOrders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		text := query.Get("q")
+		// в журнал попадает запрос целиком: по нему видно, чьи данные могли найтись
+		setAuditTargets(r, query.Encode())
+
+		limit := defaultSearchLimit
+		if v := query.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > orders.MaxSearchLimit {
+				http.Error(w, "Query parameter 'limit' must be between 1 and "+strconv.Itoa(orders.MaxSearchLimit), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		offset := 0
+		if v := query.Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Query parameter 'offset' must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			offset = n
+		}
+
+		p := auth.FromContext(r.Context())
+		includePII := p.HasScope(auth.ScopePII)
+
+		page, err := s.Orders.Search(r.Context(), text, includePII, limit, offset)
+		if err != nil {
+			if errors.Is(err, orders.ErrEmptyQuery) {
+				http.Error(w, "Query parameter 'q' must contain letters or digits", http.StatusBadRequest)
+				return
+			}
+			slog.Error("Failed to search orders", "error", err, "principal", p.Name)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := searchResponse{
+			Results:             make([]searchResult, 0, len(page.Results)),
+			PIISearchIncomplete: page.PIIIncomplete,
+		}
+		for _, res := range page.Results {
+			var masked model.Order
+			projected, err := s.projectOrder(r, res.Order)
+			if err == nil {
+				masked, err = searchableFields(projected)
+			}
+			if err != nil {
+				slog.Error("Failed to apply masking policy", "error", err, "order_uid", res.Order.OrderUID)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			resp.Results = append(resp.Results, searchResult{
+				Order: projected,
+				Rank:  res.Rank,
+				// подсветка строится по замаскированному заказу, чтобы не раскрыть скрытые ролью поля
+				Highlights: orders.Highlights(masked, text, includePII),
+			})
+		}
+		if page.More {
+			next := offset + limit
+			resp.NextOffset = &next
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
+
+// searchableFields извлекает из проекции заказа поля, по которым строится подсветка.
+// Разбираются только строковые поля, поэтому маскирование числовых полей политикой не мешает
+func searchableFields(projected any) (model.Order, error) {
+	data, err := json.Marshal(projected)
+	if err != nil {
+		return model.Order{}, err
+	}
+	var doc struct {
+		Delivery model.Delivery `json:"delivery"`
+		Items    []struct {
+			Name  string `json:"name"`
+			Brand string `json:"brand"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return model.Order{}, err
+	}
+
+	order := model.Order{Delivery: doc.Delivery, Items: make([]model.Item, len(doc.Items))}
+	for i, item := range doc.Items {
+		order.Items[i] = model.Item{Name: item.Name, Brand: item.Brand}
+	}
+	return order, nil
+}
@@ -3,14 +3,20 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"test_task_wb/internal/audit"
+	"test_task_wb/internal/auth"
 	"test_task_wb/internal/cache"
 	"test_task_wb/internal/metrics"
 	"test_task_wb/internal/model"
+	"test_task_wb/internal/orders"
 	"test_task_wb/internal/storage"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/require"
 )
@@ -23,7 +29,7 @@ func TestServer_handleGetOrder(t *testing.T) {
 
 	log.SetFlags(0)
 
-	dbPool, err := storage.NewDB(context.Background(), testDSN)
+	dbPool, err := storage.NewDB(context.Background(), testDSN, storage.DefaultRetryBudget)
 	require.NoError(t, err, "Не удалось подключиться к тестовой БД 'postgres-test' на порту 5433")
 
 	dbStorage := storage.NewStorage(dbPool)
@@ -54,3 +60,187 @@ func TestServer_handleGetOrder(t *testing.T) {
 		require.Equal(t, http.StatusNotFound, rr.Code, "Код ответа должен быть 404 Not Found")
 	})
 }
+
+func TestServer_PIIMasking(t *testing.T) {
+	piiOrder := model.Order{
+		OrderUID: "order456",
+		Delivery: model.Delivery{Name: "Test Testov", Phone: "+9720000000", Address: "Ploshad Mira 15", Email: "test@gmail.com"},
+	}
+	get := func(server *Server, header, value string) model.Order {
+		server.Cache.Set(piiOrder.OrderUID, piiOrder)
+		req := httptest.NewRequest(http.MethodGet, "/order/order456", nil)
+		req.Header.Set(header, value)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var returnedOrder model.Order
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&returnedOrder))
+		return returnedOrder
+	}
+
+	t.Run("Anonymous caller cannot pick a role", func(t *testing.T) {
+		// без аутентификации заказ отдаётся из кэша, обращения к БД нет
+		server := NewServer(cache.NewLRUCache(10), metrics.NewMetrics(), nil)
+		returnedOrder := get(server, "X-Role", "support")
+		require.NotEqual(t, piiOrder.Delivery.Name, returnedOrder.Delivery.Name, "Анонимному вызывающему имя должно маскироваться")
+		require.NotEqual(t, piiOrder.Delivery.Phone, returnedOrder.Delivery.Phone, "Анонимному вызывающему телефон должен маскироваться")
+		require.NotEqual(t, piiOrder.Delivery.Email, returnedOrder.Delivery.Email)
+		require.NotEqual(t, piiOrder.Delivery.Address, returnedOrder.Delivery.Address)
+	})
+
+	t.Run("Role from API key", func(t *testing.T) {
+		keys, err := auth.ParseAPIKeys("warehouse-bot:warehouse:orders:read|pii:" + auth.HashAPIKey("warehouse-key"))
+		require.NoError(t, err)
+		server := NewServer(cache.NewLRUCache(10), metrics.NewMetrics(), nil, WithAuthenticator(auth.NewAuthenticator(keys, nil, "", "")))
+
+		returnedOrder := get(server, "X-API-Key", "warehouse-key")
+		require.Equal(t, piiOrder.Delivery.Address, returnedOrder.Delivery.Address, "Складу должен отдаваться адрес")
+		require.Empty(t, returnedOrder.Delivery.Phone, "Складу не должен отдаваться телефон")
+	})
+}
+
+func TestServer_handleBatchGetOrders(t *testing.T) {
+	orderCache := cache.NewLRUCache(10)
+	// все запрошенные заказы лежат в кэше, поэтому обращения к БД не будет
+	server := NewServer(orderCache, metrics.NewMetrics(), nil)
+	for _, uid := range []string{"order1", "order2"} {
+		orderCache.Set(uid, model.Order{OrderUID: uid})
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders/batch-get", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Cache hits in request order", func(t *testing.T) {
+		rr := post(`{"order_uids": ["order2", "order1", "order2"]}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var resp struct {
+			Orders  []model.Order `json:"orders"`
+			Missing []string      `json:"missing"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		require.Len(t, resp.Orders, 2, "Повторяющийся UID должен возвращаться один раз")
+		require.Equal(t, "order2", resp.Orders[0].OrderUID, "Заказы должны идти в порядке запроса")
+		require.Equal(t, "order1", resp.Orders[1].OrderUID)
+		require.Empty(t, resp.Missing)
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		tooMany := make([]string, orders.MaxBatchSize+1)
+		for i := range tooMany {
+			tooMany[i] = fmt.Sprintf("order%d", i)
+		}
+		body, err := json.Marshal(map[string][]string{"order_uids": tooMany})
+		require.NoError(t, err)
+
+		for name, body := range map[string]string{
+			"not json":  `order1,order2`,
+			"empty":     `{"order_uids": []}`,
+			"blank uid": `{"order_uids": ["order1", ""]}`,
+			"too many":  string(body),
+		} {
+			require.Equal(t, http.StatusBadRequest, post(body).Code, "Запрос %q должен отклоняться", name)
+		}
+	})
+}
+
+func TestServer_handleSearchOrders_Validation(t *testing.T) {
+	// запрос отклоняется до обращения к БД
+	server := NewServer(cache.NewLRUCache(10), metrics.NewMetrics(), nil)
+
+	for name, query := range map[string]string{
+		"no words":        "q=%25%25",
+		"missing query":   "",
+		"bad limit":       "q=mascara&limit=1000",
+		"negative offset": "q=mascara&offset=-1",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/orders/search?"+query, nil)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusBadRequest, rr.Code, "Запрос %q должен отклоняться", name)
+	}
+}
+
+func TestServer_handleGetOrderBy(t *testing.T) {
+	orderCache := cache.NewLRUCache(10)
+	// заказ лежит в кэше, поэтому вторичный индекс отвечает без обращения к БД
+	server := NewServer(orderCache, metrics.NewMetrics(), nil)
+	order := model.Order{
+		OrderUID:    "order789",
+		TrackNumber: "WBILMTESTTRACK",
+		Payment:     model.Payment{Transaction: "tx789"},
+		Items:       []model.Item{{Rid: "ab4219087a764ae0btest"}},
+	}
+	orderCache.Set(order.OrderUID, order)
+
+	for _, path := range []string{"/track/WBILMTESTTRACK", "/payment/tx789", "/item/ab4219087a764ae0btest"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, "Заказ должен находиться по %s", path)
+
+		var returnedOrder model.Order
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&returnedOrder))
+		require.Equal(t, order.OrderUID, returnedOrder.OrderUID)
+	}
+}
+
+// auditSink запоминает сохранённые записи журнала аудита
+type auditSink struct {
+	entries []audit.Entry
+}
+
+func (s *auditSink) SaveAccessLog(_ context.Context, entries []audit.Entry) error {
+	s.entries = append(s.entries, entries...)
+	return nil
+}
+
+// auditTargets выполняет запрос и возвращает объекты записей журнала аудита
+func auditTargets(t *testing.T, server *Server, req *http.Request) []string {
+	t.Helper()
+	sink := &auditSink{}
+	server.Audit = audit.NewRecorder(sink, 1024)
+	go server.Audit.Run()
+
+	server.Router.ServeHTTP(httptest.NewRecorder(), req)
+	server.Audit.Close()
+
+	targets := make([]string, 0, len(sink.entries))
+	for _, e := range sink.entries {
+		targets = append(targets, e.Target)
+	}
+	return targets
+}
+
+func TestServer_AuditTargets(t *testing.T) {
+	orderCache := cache.NewLRUCache(10)
+	server := NewServer(orderCache, metrics.NewMetrics(), nil)
+	for _, uid := range []string{"order1", "order2"} {
+		orderCache.Set(uid, model.Order{OrderUID: uid})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/orders/batch-get", strings.NewReader(`{"order_uids": ["order2", "order1", "order2"]}`))
+	require.Equal(t, []string{"order1", "order2"}, auditTargets(t, server, req), "Каждый прочитанный заказ должен попасть в журнал")
+
+	// запрос без слов отклоняется до обращения к БД, но попытка поиска всё равно записывается
+	req = httptest.NewRequest(http.MethodGet, "/orders/search?q=%25%25&limit=5", nil)
+	require.Equal(t, []string{"limit=5&q=%25%25"}, auditTargets(t, server, req), "В журнал должна попадать строка поиска")
+
+	long := strings.Repeat("я", 300)
+	req = httptest.NewRequest(http.MethodGet, "/orders/search?q="+long+"&limit=1000", nil)
+	targets := auditTargets(t, server, req)
+	require.Len(t, targets, 1)
+	require.Equal(t, maxAuditTarget, utf8.RuneCountInString(targets[0]), "Объект должен обрезаться до размера столбца")
+
+	// неизвестный формат отклоняется до обращения к БД
+	req = httptest.NewRequest(http.MethodGet, "/orders/export?format=xlsx&customer_id=c1&from=2025-01-01&limit=3", nil)
+	require.Equal(t, []string{"customer_id=c1&from=2025-01-01"}, auditTargets(t, server, req), "В журнал должен попадать фильтр выгрузки")
+
+	req = httptest.NewRequest(http.MethodGet, "/order/order1", nil)
+	require.Equal(t, []string{"order1"}, auditTargets(t, server, req))
+}
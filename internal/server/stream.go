@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"test_task_wb/internal/auth"
+	"test_task_wb/internal/orders"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+const (
+	// streamBuffer - сколько событий может накопиться у клиента ленты, прежде чем его отключат
+	streamBuffer = 256
+	// streamHeartbeat - период служебных сообщений, по которым прокси и клиент видят, что соединение живо
+	streamHeartbeat = 15 * time.Second
+	// streamWriteTimeout - сколько ждать записи одного события; клиент, не читающий сокет дольше, отключается
+	streamWriteTimeout = 10 * time.Second
+)
+
+// Причины завершения стрима, они же значения метки reason в service_stream_disconnects_total
+const (
+	streamClientClosed = "client_closed"
+	streamLagged       = "lagged"
+	streamShutdown     = "shutdown"
+	streamWriteFailed  = "write_failed"
+)
+
+// streamEvent - событие ленты в том виде, в котором его получает клиент
+type streamEvent struct {
+	Type     orders.EventType `json:"type"`
+	OrderUID string           `json:"order_uid"`
+	Time     time.Time        `json:"time"`
+	Order    any              `json:"order,omitempty"`
+}
+
+// streamFilter отбирает события по службе доставки и клиенту.
+// События без заказа (отмена, удаление) проходят только при пустом фильтре
+type streamFilter struct {
+	deliveryService string
+	customerID      string
+}
+
+func parseStreamFilter(r *http.Request) streamFilter {
+	q := r.URL.Query()
+	return streamFilter{deliveryService: q.Get("delivery_service"), customerID: q.Get("customer_id")}
+}
+
+func (f streamFilter) match(e orders.Event) bool {
+	if f.deliveryService == "" && f.customerID == "" {
+		return true
+	}
+	if e.Order == nil {
+		return false
+	}
+	return (f.deliveryService == "" || e.Order.DeliveryService == f.deliveryService) &&
+		(f.customerID == "" || e.Order.CustomerID == f.customerID)
+}
+
+// streamOutput - транспорт живой ленты
+type streamOutput interface {
+	send(e streamEvent) error
+	ping() error
+	// close сообщает клиенту, почему сервер завершает стрим
+	close(reason string)
+}
+
+// handleOrderStream возвращает обработчик живой ленты заказов в формате Server-Sent Events
+func (s *Server) handleOrderStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		// лента живёт дольше WriteTimeout сервера, поэтому дедлайн выставляется на каждую запись отдельно
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			slog.Error("Failed to reset write deadline for event stream", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		sub := s.Feed.Subscribe(streamBuffer)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		out := &sseOutput{w: w, rc: rc}
+		// первое сообщение задаёт интервал переподключения и подтверждает клиенту, что подписка активна
+		if err := out.write("retry: 3000\n\n"); err != nil {
+			return
+		}
+		s.serveStream(r.Context(), r, "sse", sub, out)
+	}
+}
+
+// handleOrderWebSocket возвращает обработчик живой ленты заказов по WebSocket.
+// Сообщения клиента не ожидаются, события отправляются JSON-сообщениями
+func (s *Server) handleOrderWebSocket() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// после hijack дедлайны сервера остаются на соединении и оборвали бы его через ReadTimeout
+		rc := http.NewResponseController(w)
+		for _, reset := range []func(time.Time) error{rc.SetReadDeadline, rc.SetWriteDeadline} {
+			if err := reset(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				slog.Error("Failed to reset deadlines for websocket", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		sub := s.Feed.Subscribe(streamBuffer)
+		defer sub.Close()
+
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			// Accept сам отвечает клиенту кодом ошибки
+			slog.Debug("Failed to accept websocket", "error", err, "remote_addr", r.RemoteAddr)
+			return
+		}
+		defer conn.CloseNow()
+
+		// читатель нужен для обработки служебных кадров; контекст отменяется, когда клиент закрывает соединение
+		ctx := conn.CloseRead(r.Context())
+		s.serveStream(ctx, r, "websocket", sub, &wsOutput{ctx: ctx, conn: conn})
+	}
+}
+
+// serveStream передаёт клиенту подходящие под фильтр события подписки, пока клиент не отключится
+// или лента не закроет подписку
+func (s *Server) serveStream(ctx context.Context, r *http.Request, transport string, sub *orders.Subscription, out streamOutput) {
+	clients := s.Metrics.StreamClients.WithLabelValues(transport)
+	clients.Inc()
+	defer clients.Dec()
+
+	filter := parseStreamFilter(r)
+	reason := s.pumpStream(ctx, r, sub, filter, out)
+	s.Metrics.StreamDisconnects.WithLabelValues(transport, reason).Inc()
+
+	if reason == streamLagged || reason == streamShutdown {
+		out.close(reason)
+	}
+	slog.Debug("Order stream closed", "transport", transport, "reason", reason, "principal", auth.FromContext(r.Context()).Name)
+}
+
+func (s *Server) pumpStream(ctx context.Context, r *http.Request, sub *orders.Subscription, filter streamFilter, out streamOutput) string {
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return streamClientClosed
+		case <-ticker.C:
+			if err := out.ping(); err != nil {
+				return streamWriteFailed
+			}
+		case e, ok := <-sub.Events():
+			if !ok {
+				if sub.Lagged() {
+					return streamLagged
+				}
+				return streamShutdown
+			}
+			if !filter.match(e) {
+				continue
+			}
+
+			se := streamEvent{Type: e.Type, OrderUID: e.OrderUID, Time: e.Time}
+			if e.Order != nil {
+				projected, err := s.projectOrder(r, *e.Order)
+				if err != nil {
+					slog.Error("Failed to apply masking policy", "error", err, "order_uid", e.OrderUID)
+					continue
+				}
+				se.Order = projected
+			}
+			if err := out.send(se); err != nil {
+				return streamWriteFailed
+			}
+		}
+	}
+}
+
+// sseOutput пишет события в формате text/event-stream
+type sseOutput struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (o *sseOutput) write(msg string) error {
+	if err := o.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := fmt.Fprint(o.w, msg); err != nil {
+		return err
+	}
+	return o.rc.Flush()
+}
+
+func (o *sseOutput) send(e streamEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return o.write(fmt.Sprintf("event: %s\ndata: %s\n\n", e.Type, data))
+}
+
+func (o *sseOutput) ping() error {
+	return o.write(": ping\n\n")
+}
+
+// close отправляет событие disconnect: имя error занято встроенным событием EventSource
+func (o *sseOutput) close(reason string) {
+	_ = o.write(fmt.Sprintf("event: disconnect\ndata: {\"reason\":%q}\n\n", reason))
+}
+
+// wsOutput пишет события JSON-сообщениями WebSocket
+type wsOutput struct {
+	ctx  context.Context
+	conn *websocket.Conn
+}
+
+func (o *wsOutput) send(e streamEvent) error {
+	ctx, cancel := context.WithTimeout(o.ctx, streamWriteTimeout)
+	defer cancel()
+	return wsjson.Write(ctx, o.conn, e)
+}
+
+func (o *wsOutput) ping() error {
+	ctx, cancel := context.WithTimeout(o.ctx, streamWriteTimeout)
+	defer cancel()
+	return o.conn.Ping(ctx)
+}
+
+// close закрывает соединение с кодом, по которому клиент поймёт, стоит ли переподключаться
+func (o *wsOutput) close(reason string) {
+	code := websocket.StatusGoingAway
+	if reason == streamLagged {
+		code = websocket.StatusTryAgainLater
+	}
+	_ = o.conn.Close(code, reason)
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"test_task_wb/internal/cache"
+	"test_task_wb/internal/metrics"
+	"test_task_wb/internal/model"
+	"test_task_wb/internal/orders"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/stretchr/testify/require"
+)
+
+func newStreamServer(t *testing.T) (*httptest.Server, *orders.Feed) {
+	t.Helper()
+	feed := orders.NewFeed()
+	s := NewServer(cache.NewLRUCache(10), metrics.NewMetrics(), nil, WithFeed(feed))
+	ts := httptest.NewServer(s.Router)
+	t.Cleanup(func() {
+		feed.Close()
+		ts.Close()
+	})
+	return ts, feed
+}
+
+func created(uid, service, customer string) orders.Event {
+	return orders.Event{Type: orders.EventCreated, OrderUID: uid, Order: &model.Order{
+		OrderUID: uid, DeliveryService: service, CustomerID: customer,
+	}}
+}
+
+// readSSE возвращает следующее сообщение потока без комментариев: имя события и данные
+func readSSE(t *testing.T, r *bufio.Reader) (event, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && (event != "" || data != ""):
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestOrderStream_SSE(t *testing.T) {
+	ts, feed := newStreamServer(t)
+
+	resp, err := http.Get(ts.URL + "/orders/stream?delivery_service=meest")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// retry приходит после подписки, поэтому следующие события не потеряются
+	r := bufio.NewReader(resp.Body)
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "retry: 3000\n", line)
+
+	feed.Publish(created("skipped", "dhl", "c1"))
+	feed.Publish(orders.Event{Type: orders.EventDeleted, OrderUID: "removed"})
+	feed.Publish(created("wanted", "meest", "c2"))
+
+	event, data := readSSE(t, r)
+	require.Equal(t, "created", event)
+	require.Contains(t, data, `"order_uid":"wanted"`, "Фильтр должен пропускать только заказы выбранной службы доставки")
+
+	feed.Close()
+	event, data = readSSE(t, r)
+	require.Equal(t, "disconnect", event)
+	require.JSONEq(t, `{"reason":"shutdown"}`, data)
+}
+
+// recordingOutput запоминает отправленные события и причину закрытия
+type recordingOutput struct {
+	events []streamEvent
+	reason string
+}
+
+func (o *recordingOutput) send(e streamEvent) error {
+	o.events = append(o.events, e)
+	return nil
+}
+
+func (o *recordingOutput) ping() error { return nil }
+
+func (o *recordingOutput) close(reason string) { o.reason = reason }
+
+func TestOrderStream_SlowClient(t *testing.T) {
+	feed := orders.NewFeed()
+	s := NewServer(cache.NewLRUCache(10), metrics.NewMetrics(), nil, WithFeed(feed))
+	sub := feed.Subscribe(streamBuffer)
+
+	// клиент не успевает читать: буфер переполняется, и лента отключает его, не блокируя публикацию
+	for i := 0; i <= streamBuffer; i++ {
+		feed.Publish(orders.Event{Type: orders.EventDeleted, OrderUID: "flood"})
+	}
+
+	out := &recordingOutput{}
+	r := httptest.NewRequest(http.MethodGet, "/orders/stream", nil)
+	s.serveStream(context.Background(), r, "sse", sub, out)
+
+	require.Len(t, out.events, streamBuffer, "Уже накопленные события должны быть доставлены до отключения")
+	require.Equal(t, streamLagged, out.reason)
+}
+
+func TestOrderStream_WebSocket(t *testing.T) {
+	ts, feed := newStreamServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(ts.URL, "http")+"/orders/ws?customer_id=c2", nil)
+	require.NoError(t, err)
+	defer conn.CloseNow()
+
+	// подписка создаётся до завершения рукопожатия
+	feed.Publish(created("other", "meest", "c1"))
+	feed.Publish(created("mine", "dhl", "c2"))
+
+	var got streamEvent
+	require.NoError(t, wsjson.Read(ctx, conn, &got))
+	require.Equal(t, orders.EventCreated, got.Type)
+	require.Equal(t, "mine", got.OrderUID)
+	require.NotNil(t, got.Order)
+
+	feed.Close()
+	_, _, err = conn.Read(ctx)
+	require.Equal(t, websocket.StatusGoingAway, websocket.CloseStatus(err), "При остановке сервер должен закрыть соединение с кодом 1001")
+}
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TimeRange - полуинтервал [From, To) по дате создания заказа
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// ItemGrouping - поле товара, по которому считается топ
+type ItemGrouping string
+
+const (
+	GroupByBrand ItemGrouping = "brand"
+	GroupByNmID  ItemGrouping = "nm_id"
+)
+
+// ItemOrder - показатель, по которому сортируется топ товаров
+type ItemOrder string
+
+const (
+	OrderByUnits   ItemOrder = "units"
+	OrderByRevenue ItemOrder = "revenue"
+)
+
+// LocationGrouping - поле доставки, по которому считаются заказы
+type LocationGrouping string
+
+const (
+	GroupByRegion LocationGrouping = "region"
+	GroupByCity   LocationGrouping = "city"
+)
+
+// DailyRevenue - выручка за сутки (UTC) в одной валюте
+type DailyRevenue struct {
+	Day      time.Time `json:"day"`
+	Currency string    `json:"currency"`
+	Orders   int64     `json:"orders"`
+	Revenue  int64     `json:"revenue"`
+}
+
+// ItemStat - продажи бренда или артикула в одной валюте. Каждая строка товара считается одной единицей
+type ItemStat struct {
+	Key      string `json:"key"`
+	Currency string `json:"currency"`
+	Units    int64  `json:"units"`
+	Revenue  int64  `json:"revenue"`
+}
+
+// DeliveryCostStat - средняя стоимость доставки службы в одной валюте
+type DeliveryCostStat struct {
+	DeliveryService string  `json:"delivery_service"`
+	Currency        string  `json:"currency"`
+	Orders          int64   `json:"orders"`
+	AvgCost         float64 `json:"avg_delivery_cost"`
+}
+
+// LocationStat - число заказов в регионе или городе
+type LocationStat struct {
+	Location string `json:"location"`
+	Orders   int64  `json:"orders"`
+}
+
+// SaleStat - средняя скидка по проданным товарам
+type SaleStat struct {
+	Items           int64   `json:"items"`
+	DiscountedItems int64   `json:"discounted_items"`
+	AvgSale         float64 `json:"avg_sale"`
+	// AvgDiscountedSale - средняя скидка только среди товаров со скидкой
+	AvgDiscountedSale float64 `json:"avg_discounted_sale"`
+}
+
+// analyticsScope - общее условие отчётов: неотменённые заказы в интервале
+const analyticsScope = `o.deleted_at IS NULL AND o.date_created >= $1 AND o.date_created < $2`
+
+// Интервал, границы которого приходятся на полночь UTC, считается по дневным агрегатам (см. rollup.go),
+// остальные - по исходным таблицам. Отчёт по регионам и городам всегда строится по исходным таблицам
+
+// RevenueByDay возвращает выручку по дням и валютам
+func (s *Storage) RevenueByDay(ctx context.Context, r TimeRange) ([]DailyRevenue, error) {
+	if r.dayAligned() {
+		return s.revenueFromRollups(ctx, r)
+	}
+	defer s.observe("analytics_revenue", time.Now())
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT date_trunc('day', o.date_created, 'UTC'), p.currency, count(*), sum(p.amount)
+		FROM orders AS o
+		JOIN payments AS p ON p.order_uid = o.order_uid
+		WHERE `+analyticsScope+`
+		GROUP BY 1, 2
+		ORDER BY 1, 2`, r.From, r.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revenue: %w", err)
+	}
+	return collectRows(rows, func(row pgx.CollectableRow) (DailyRevenue, error) {
+		var d DailyRevenue
+		err := row.Scan(&d.Day, &d.Currency, &d.Orders, &d.Revenue)
+		d.Day = d.Day.UTC()
+		return d, err
+	})
+}
+
+// TopItems возвращает limit брендов или артикулов с наибольшими продажами.
+// Выручка в разных валютах не складывается, поэтому ключ встречается по разу на валюту
+func (s *Storage) TopItems(ctx context.Context, r TimeRange, by ItemGrouping, order ItemOrder, limit int) ([]ItemStat, error) {
+	defer s.observe("analytics_top_items", time.Now())
+
+	// группировка и сортировка подставляются в запрос, поэтому допускаются только известные значения
+	var key string
+	switch by {
+	case GroupByBrand:
+		key = "i.brand"
+	case GroupByNmID:
+		key = "i.nm_id::text"
+	default:
+		return nil, fmt.Errorf("unknown item grouping %q", by)
+	}
+	var orderBy string
+	switch order {
+	case OrderByUnits:
+		orderBy = "units DESC, revenue DESC"
+	case OrderByRevenue:
+		orderBy = "revenue DESC, units DESC"
+	default:
+		return nil, fmt.Errorf("unknown item order %q", order)
+	}
+	// по артикулам агрегатов нет: их слишком много для дневной таблицы
+	if by == GroupByBrand && r.dayAligned() {
+		return s.topBrandsFromRollups(ctx, r, orderBy, limit)
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+key+`, p.currency, count(*) AS units, sum(i.total_price) AS revenue
+		FROM items AS i
+		JOIN orders AS o ON o.order_uid = i.order_uid
+		JOIN payments AS p ON p.order_uid = o.order_uid
+		WHERE `+analyticsScope+`
+		GROUP BY 1, 2
+		ORDER BY `+orderBy+`, 1, 2
+		LIMIT $3`, r.From, r.To, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top items: %w", err)
+	}
+	return collectRows(rows, func(row pgx.CollectableRow) (ItemStat, error) {
+		var st ItemStat
+		err := row.Scan(&st.Key, &st.Currency, &st.Units, &st.Revenue)
+		return st, err
+	})
+}
+
+// DeliveryCosts возвращает среднюю стоимость доставки по службам доставки и валютам
+func (s *Storage) DeliveryCosts(ctx context.Context, r TimeRange) ([]DeliveryCostStat, error) {
+	if r.dayAligned() {
+		return s.deliveryCostsFromRollups(ctx, r)
+	}
+	defer s.observe("analytics_delivery_costs", time.Now())
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT o.delivery_service, p.currency, count(*), avg(p.delivery_cost)::float8
+		FROM orders AS o
+		JOIN payments AS p ON p.order_uid = o.order_uid
+		WHERE `+analyticsScope+`
+		GROUP BY 1, 2
+		ORDER BY 1, 2`, r.From, r.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query delivery costs: %w", err)
+	}
+	return collectRows(rows, func(row pgx.CollectableRow) (DeliveryCostStat, error) {
+		var st DeliveryCostStat
+		err := row.Scan(&st.DeliveryService, &st.Currency, &st.Orders, &st.AvgCost)
+		return st, err
+	})
+}
+
+// OrdersByLocation возвращает limit регионов или городов с наибольшим числом заказов
+func (s *Storage) OrdersByLocation(ctx context.Context, r TimeRange, by LocationGrouping, limit int) ([]LocationStat, error) {
+	defer s.observe("analytics_locations", time.Now())
+
+	var column string
+	switch by {
+	case GroupByRegion:
+		column = "d.region"
+	case GroupByCity:
+		column = "d.city"
+	default:
+		return nil, fmt.Errorf("unknown location grouping %q", by)
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+column+`, count(*)
+		FROM orders AS o
+		JOIN deliveries AS d ON d.order_uid = o.order_uid
+		WHERE `+analyticsScope+`
+		GROUP BY 1
+		ORDER BY 2 DESC, 1
+		LIMIT $3`, r.From, r.To, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders by location: %w", err)
+	}
+	return collectRows(rows, func(row pgx.CollectableRow) (LocationStat, error) {
+		var st LocationStat
+		err := row.Scan(&st.Location, &st.Orders)
+		return st, err
+	})
+}
+
+// AverageSale возвращает среднюю скидку по товарам заказов из интервала
+func (s *Storage) AverageSale(ctx context.Context, r TimeRange) (SaleStat, error) {
+	if r.dayAligned() {
+		return s.averageSaleFromRollups(ctx, r)
+	}
+	defer s.observe("analytics_sales", time.Now())
+
+	var st SaleStat
+	err := s.pool.QueryRow(ctx, `
+		SELECT count(*),
+			   count(*) FILTER (WHERE i.sale > 0),
+			   coalesce(avg(i.sale), 0)::float8,
+			   coalesce(avg(i.sale) FILTER (WHERE i.sale > 0), 0)::float8
+		FROM items AS i
+		JOIN orders AS o ON o.order_uid = i.order_uid
+		WHERE `+analyticsScope, r.From, r.To).Scan(&st.Items, &st.DiscountedItems, &st.AvgSale, &st.AvgDiscountedSale)
+	if err != nil {
+		return SaleStat{}, fmt.Errorf("failed to query average sale: %w", err)
+	}
+	return st, nil
+}
+
+// collectRows собирает строки отчёта и закрывает rows
+func collectRows[T any](rows pgx.Rows, scan func(pgx.CollectableRow) (T, error)) ([]T, error) {
+	out, err := pgx.CollectRows(rows, scan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report rows: %w", err)
+	}
+	return out, nil
+}
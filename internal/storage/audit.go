@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"test_task_wb/internal/audit"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveAccessLog сохраняет пачку записей журнала доступа одной командой COPY
+func (s *Storage) SaveAccessLog(ctx context.Context, entries []audit.Entry) error {
+	defer s.observe("save_access_log", time.Now())
+
+	rows := make([][]any, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, []any{e.Principal, e.AuthMethod, e.Action, e.Target, e.Status, e.At})
+	}
+
+	_, err := s.pool.CopyFrom(ctx,
+		pgx.Identifier{"access_log"},
+		[]string{"principal", "auth_method", "action", "target", "status", "accessed_at"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save access log: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"test_task_wb/internal/model"
+	"time"
+)
+
+// ErasureResult описывает результат удаления персональных данных клиента
+type ErasureResult struct {
+	CustomerID  string    `json:"customer_id"`
+	OrderUIDs   []string  `json:"order_uids"`
+	RequestedBy string    `json:"requested_by"`
+	ErasedAt    time.Time `json:"erased_at"`
+}
+
+// EraseCustomer заменяет персональные данные получателя (имя, телефон, адрес, email)
+// во всех заказах клиента на случайные псевдонимы и записывает факт удаления в журнал аудита.
+// Финансовые данные и товары не затрагиваются, чтобы не ломать отчётность
+func (s *Storage) EraseCustomer(ctx context.Context, customerID, requestedBy string) (ErasureResult, error) {
+	defer s.observe("erase_customer", time.Now())
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ErasureResult{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT order_uid FROM orders WHERE customer_id = $1 FOR UPDATE`, customerID)
+	if err != nil {
+		return ErasureResult{}, fmt.Errorf("failed to select customer orders: %w", err)
+	}
+	orderUIDs := make([]string, 0)
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			rows.Close()
+			return ErasureResult{}, fmt.Errorf("failed to scan order uid: %w", err)
+		}
+		orderUIDs = append(orderUIDs, uid)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return ErasureResult{}, fmt.Errorf("error after iterating customer orders: %w", rows.Err())
+	}
+
+	deliverySQL := `UPDATE deliveries SET name = $2, phone = $3, address = $4, email = $5, enc_key_id = $6, enc_data_key = $7, pii_tokens = $8 WHERE order_uid = $1`
+	for _, uid := range orderUIDs {
+		token, err := pseudonym()
+		if err != nil {
+			return ErasureResult{}, err
+		}
+		sealed, err := s.sealDelivery(uid, model.Delivery{
+			Name:    "anon-" + token,
+			Phone:   "+0" + token[:10],
+			Address: "erased",
+			Email:   "anon-" + token + "@erased.invalid",
+		})
+		if err != nil {
+			return ErasureResult{}, err
+		}
+		_, err = tx.Exec(ctx, deliverySQL, uid, sealed.Name, sealed.Phone, sealed.Address, sealed.Email, sealed.KeyID, sealed.DataKey, sealed.Tokens)
+		if err != nil {
+			return ErasureResult{}, fmt.Errorf("failed to anonymize delivery for order %s: %w", uid, err)
+		}
+	}
+
+	result := ErasureResult{
+		CustomerID:  customerID,
+		OrderUIDs:   orderUIDs,
+		RequestedBy: requestedBy,
+	}
+	auditSQL := `INSERT INTO customer_erasures (customer_id, order_uids, requested_by) VALUES ($1, $2, $3) RETURNING erased_at`
+	if err := tx.QueryRow(ctx, auditSQL, customerID, orderUIDs, requestedBy).Scan(&result.ErasedAt); err != nil {
+		return ErasureResult{}, fmt.Errorf("failed to record erasure: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return ErasureResult{}, fmt.Errorf("failed to commit erasure: %w", err)
+	}
+
+	return result, nil
+}
+
+// pseudonym генерирует случайный цифровой токен. Исходное значение из него восстановить нельзя
+func pseudonym() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate pseudonym: %w", err)
+	}
+	for i := range b {
+		b[i] = '0' + b[i]%10
+	}
+	return string(b), nil
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// exportFetchSize - сколько строк выгрузки читается из курсора за раз
+const exportFetchSize = 1000
+
+// ExportFilter ограничивает выгрузку. Нулевые поля не применяются
+type ExportFilter struct {
+	// From и To - полуинтервал [From, To) по дате создания заказа
+	From            time.Time
+	To              time.Time
+	DeliveryService string
+	CustomerID      string
+}
+
+// ExportRow - строка выгрузки: товар вместе с полями его заказа, оплаты и доставки.
+// Контактные данные получателя (имя, телефон, email, адрес) в выгрузку не попадают
+type ExportRow struct {
+	OrderUID        string    `json:"order_uid" parquet:"order_uid"`
+	TrackNumber     string    `json:"track_number" parquet:"track_number"`
+	Entry           string    `json:"entry" parquet:"entry"`
+	Locale          string    `json:"locale" parquet:"locale"`
+	CustomerID      string    `json:"customer_id" parquet:"customer_id"`
+	DeliveryService string    `json:"delivery_service" parquet:"delivery_service"`
+	DateCreated     time.Time `json:"date_created" parquet:"date_created,timestamp(millisecond)"`
+	City            string    `json:"city" parquet:"city"`
+	Region          string    `json:"region" parquet:"region"`
+	Zip             string    `json:"zip" parquet:"zip"`
+	Transaction     string    `json:"transaction" parquet:"transaction"`
+	Currency        string    `json:"currency" parquet:"currency"`
+	Provider        string    `json:"provider" parquet:"provider"`
+	Bank            string    `json:"bank" parquet:"bank"`
+	Amount          int       `json:"amount" parquet:"amount"`
+	PaymentDt       int64     `json:"payment_dt" parquet:"payment_dt"`
+	DeliveryCost    int       `json:"delivery_cost" parquet:"delivery_cost"`
+	GoodsTotal      int       `json:"goods_total" parquet:"goods_total"`
+	CustomFee       int       `json:"custom_fee" parquet:"custom_fee"`
+	ChrtID          int       `json:"chrt_id" parquet:"chrt_id"`
+	NmID            int       `json:"nm_id" parquet:"nm_id"`
+	Rid             string    `json:"rid" parquet:"rid"`
+	ItemName        string    `json:"item_name" parquet:"item_name"`
+	Brand           string    `json:"brand" parquet:"brand"`
+	Size            string    `json:"size" parquet:"size"`
+	Price           int       `json:"price" parquet:"price"`
+	Sale            int       `json:"sale" parquet:"sale"`
+	TotalPrice      int       `json:"total_price" parquet:"total_price"`
+	Status          int       `json:"status" parquet:"status"`
+}
+
+// ExportOrders передаёт в fn товары неотменённых заказов, подходящих под фильтр, от старых заказов к новым.
+// Строки читаются серверным курсором порциями, поэтому память не зависит от размера выгрузки.
+// Ошибка fn прерывает выгрузку. Возвращает число переданных строк
+func (s *Storage) ExportOrders(ctx context.Context, f ExportFilter, fn func(ExportRow) error) (int64, error) {
+	defer s.observe("export_orders", time.Now())
+
+	from := pgtype.Timestamptz{InfinityModifier: pgtype.NegativeInfinity, Valid: true}
+	if !f.From.IsZero() {
+		from = pgtype.Timestamptz{Time: f.From, Valid: true}
+	}
+	to := pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true}
+	if !f.To.IsZero() {
+		to = pgtype.Timestamptz{Time: f.To, Valid: true}
+	}
+
+	// курсор живёт только внутри транзакции и видит один снимок данных
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		DECLARE export_cursor NO SCROLL CURSOR FOR
+		SELECT o.order_uid, o.track_number, o.entry, o.locale, o.customer_id, o.delivery_service, o.date_created,
+			   d.city, d.region, d.zip,
+			   p.transaction, p.currency, p.provider, p.bank, p.amount, p.payment_dt, p.delivery_cost, p.goods_total, p.custom_fee,
+			   i.chrt_id, i.nm_id, i.rid, i.name, i.brand, i.size, i.price, i.sale, i.total_price, i.status
+		FROM orders AS o
+		JOIN deliveries AS d ON d.order_uid = o.order_uid
+		JOIN payments AS p ON p.order_uid = o.order_uid
+		JOIN items AS i ON i.order_uid = o.order_uid
+		WHERE o.deleted_at IS NULL
+		  AND o.date_created >= $1 AND o.date_created < $2
+		  AND ($3 = '' OR o.delivery_service = $3)
+		  AND ($4 = '' OR o.customer_id = $4)
+		ORDER BY o.date_created, o.order_uid, i.id`, from, to, f.DeliveryService, f.CustomerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to declare export cursor: %w", err)
+	}
+
+	var total int64
+	for {
+		rows, err := tx.Query(ctx, fmt.Sprintf("FETCH FORWARD %d FROM export_cursor", exportFetchSize))
+		if err != nil {
+			return total, fmt.Errorf("failed to fetch export rows: %w", err)
+		}
+		batch, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ExportRow, error) {
+			var r ExportRow
+			err := row.Scan(&r.OrderUID, &r.TrackNumber, &r.Entry, &r.Locale, &r.CustomerID, &r.DeliveryService, &r.DateCreated,
+				&r.City, &r.Region, &r.Zip,
+				&r.Transaction, &r.Currency, &r.Provider, &r.Bank, &r.Amount, &r.PaymentDt, &r.DeliveryCost, &r.GoodsTotal, &r.CustomFee,
+				&r.ChrtID, &r.NmID, &r.Rid, &r.ItemName, &r.Brand, &r.Size, &r.Price, &r.Sale, &r.TotalPrice, &r.Status)
+			r.DateCreated = r.DateCreated.UTC()
+			return r, err
+		})
+		if err != nil {
+			return total, fmt.Errorf("failed to scan export rows: %w", err)
+		}
+
+		for _, r := range batch {
+			if err := fn(r); err != nil {
+				return total, err
+			}
+			total++
+		}
+		if len(batch) < exportFetchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"test_task_wb/internal/model"
+	"time"
+)
+
+// sealedDelivery - персональные поля доставки в том виде, в котором они хранятся в БД.
+// KeyID и DataKey пусты, если строка хранится в открытом виде.
+// Tokens - метки слепого индекса, они есть только у зашифрованной строки при настроенном индексе
+type sealedDelivery struct {
+	Name    string
+	Phone   string
+	Address string
+	Email   string
+	KeyID   *string
+	DataKey []byte
+	Tokens  []string
+}
+
+// sealDelivery шифрует персональные поля доставки новым ключом данных.
+// Без настроенной связки ключей поля сохраняются как есть
+func (s *Storage) sealDelivery(orderUID string, d model.Delivery) (sealedDelivery, error) {
+	if s.keyring == nil {
+		return sealedDelivery{Name: d.Name, Phone: d.Phone, Address: d.Address, Email: d.Email}, nil
+	}
+
+	dk, err := s.keyring.NewDataKey()
+	if err != nil {
+		return sealedDelivery{}, err
+	}
+
+	sealed := sealedDelivery{KeyID: &dk.KeyID, DataKey: dk.Wrapped, Tokens: s.piiTokens(d)}
+	fields := []struct {
+		name string
+		src  string
+		dst  *string
+	}{
+		{"name", d.Name, &sealed.Name},
+		{"phone", d.Phone, &sealed.Phone},
+		{"address", d.Address, &sealed.Address},
+		{"email", d.Email, &sealed.Email},
+	}
+	for _, f := range fields {
+		ct, err := dk.Encrypt(f.src, orderUID+"/"+f.name)
+		if err != nil {
+			return sealedDelivery{}, fmt.Errorf("failed to encrypt delivery %s: %w", f.name, err)
+		}
+		*f.dst = ct
+	}
+
+	return sealed, nil
+}
+
+// piiTokens возвращает метки слепого индекса доставки: слова имени, адреса и email
+// и окончания номера телефона длиной от MinPhoneDigits цифр. Без индекса возвращает nil
+func (s *Storage) piiTokens(d model.Delivery) []string {
+	if s.blind == nil {
+		return nil
+	}
+
+	// пустой, а не nil: NULL означает, что метки ещё не посчитаны
+	seen := make(map[string]bool)
+	tokens := []string{}
+	add := func(kind, value string) {
+		t := s.blind.Token(kind, value)
+		if !seen[t] {
+			seen[t] = true
+			tokens = append(tokens, t)
+		}
+	}
+	for _, w := range SearchWords(d.Name + " " + d.Address + " " + d.Email) {
+		add(tokenWord, w)
+	}
+	digits := PhoneDigits(d.Phone)
+	for i := 0; len(digits)-i >= MinPhoneDigits; i++ {
+		add(tokenPhone, digits[i:])
+	}
+	return tokens
+}
+
+// openDelivery расшифровывает персональные поля доставки на месте.
+// Строки без идентификатора ключа считаются незашифрованными
+func (s *Storage) openDelivery(orderUID string, d *model.Delivery, keyID *string, dataKey []byte) error {
+	if keyID == nil {
+		return nil
+	}
+	if s.keyring == nil {
+		return errors.New("delivery is encrypted but no encryption keys are configured")
+	}
+
+	dk, err := s.keyring.OpenDataKey(*keyID, dataKey)
+	if err != nil {
+		return err
+	}
+
+	fields := []struct {
+		name string
+		val  *string
+	}{
+		{"name", &d.Name},
+		{"phone", &d.Phone},
+		{"address", &d.Address},
+		{"email", &d.Email},
+	}
+	for _, f := range fields {
+		pt, err := dk.Decrypt(*f.val, orderUID+"/"+f.name)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt delivery %s: %w", f.name, err)
+		}
+		*f.val = pt
+	}
+
+	return nil
+}
+
+// ReencryptResult - итог перешифрования одной пачки строк доставки
+type ReencryptResult struct {
+	// Selected - сколько строк выбрано в пачку; меньше batchSize - подходящих строк дальше нет
+	Selected int
+	Updated  int
+	// Failed - сколько строк не удалось расшифровать (например, ключ выведен из связки); они остаются как есть
+	Failed int
+	// LastID - id последней выбранной строки, с которого продолжается следующая пачка
+	LastID int
+}
+
+// ReencryptDeliveries перешифровывает пачку строк доставки с id больше afterID, которые зашифрованы
+// не активным ключом, хранятся в открытом виде или ещё не попали в слепой индекс.
+// Строка, которую не удалось расшифровать, пропускается, чтобы не останавливать ротацию остальных
+func (s *Storage) ReencryptDeliveries(ctx context.Context, afterID, batchSize int) (ReencryptResult, error) {
+	if s.keyring == nil {
+		return ReencryptResult{}, nil
+	}
+	defer s.observe("reencrypt_deliveries", time.Now())
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ReencryptResult{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT id, order_uid, name, phone, address, email, enc_key_id, enc_data_key
+		FROM deliveries
+		WHERE id > $4 AND (enc_key_id IS DISTINCT FROM $1 OR ($3 AND pii_tokens IS NULL))
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`
+
+	rows, err := tx.Query(ctx, query, s.keyring.ActiveKeyID(), batchSize, s.blind != nil, afterID)
+	if err != nil {
+		return ReencryptResult{}, fmt.Errorf("failed to select deliveries for re-encryption: %w", err)
+	}
+
+	type deliveryRow struct {
+		id       int
+		orderUID string
+		delivery model.Delivery
+		keyID    *string
+		dataKey  []byte
+	}
+	var batch []deliveryRow
+	for rows.Next() {
+		var r deliveryRow
+		err := rows.Scan(&r.id, &r.orderUID, &r.delivery.Name, &r.delivery.Phone, &r.delivery.Address, &r.delivery.Email, &r.keyID, &r.dataKey)
+		if err != nil {
+			rows.Close()
+			return ReencryptResult{}, fmt.Errorf("failed to scan delivery row: %w", err)
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return ReencryptResult{}, fmt.Errorf("error after iterating delivery rows: %w", rows.Err())
+	}
+
+	updateSQL := `UPDATE deliveries SET name = $2, phone = $3, address = $4, email = $5, enc_key_id = $6, enc_data_key = $7, pii_tokens = $8 WHERE id = $1`
+	res := ReencryptResult{Selected: len(batch)}
+	for _, r := range batch {
+		res.LastID = r.id
+		if err := s.openDelivery(r.orderUID, &r.delivery, r.keyID, r.dataKey); err != nil {
+			slog.Warn("Skipping delivery that cannot be decrypted", "error", err, "delivery_id", r.id, "order_uid", r.orderUID, "key_id", *r.keyID)
+			res.Failed++
+			continue
+		}
+		sealed, err := s.sealDelivery(r.orderUID, r.delivery)
+		if err != nil {
+			return ReencryptResult{}, err
+		}
+		_, err = tx.Exec(ctx, updateSQL, r.id, sealed.Name, sealed.Phone, sealed.Address, sealed.Email, sealed.KeyID, sealed.DataKey, sealed.Tokens)
+		if err != nil {
+			return ReencryptResult{}, fmt.Errorf("failed to update delivery %d: %w", r.id, err)
+		}
+		res.Updated++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return ReencryptResult{}, fmt.Errorf("failed to commit re-encryption: %w", err)
+	}
+
+	return res, nil
+}
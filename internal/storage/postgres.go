@@ -5,31 +5,75 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"test_task_wb/internal/encryption"
+	"test_task_wb/internal/metrics"
 	"test_task_wb/internal/model"
 	"time"
 
 	"github.com/cenkalti/backoff/v5"
+	"github.com/exaring/otelpgx"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-var ErrOrderNotFound = errors.New("order not found")
+var (
+	ErrOrderNotFound = errors.New("order not found")
+	ErrOrderDeleted  = errors.New("order deleted")
+)
 
 // пул соединений с БД
 type Storage struct {
-	pool *pgxpool.Pool
+	pool    *pgxpool.Pool
+	keyring *encryption.Keyring
+	blind   *encryption.BlindIndex
+	metrics *metrics.Metrics
+}
+
+// Option настраивает дополнительные возможности Storage
+type Option func(*Storage)
+
+// WithKeyring включает шифрование персональных данных доставки заданной связкой ключей
+func WithKeyring(kr *encryption.Keyring) Option {
+	return func(s *Storage) {
+		s.keyring = kr
+	}
+}
+
+// WithBlindIndex включает поиск по зашифрованным персональным данным доставки через слепой индекс
+func WithBlindIndex(bi *encryption.BlindIndex) Option {
+	return func(s *Storage) {
+		s.blind = bi
+	}
 }
 
+// RetryBudget ограничивает повторные попытки подключения к БД при старте
+type RetryBudget struct {
+	Total       time.Duration // общее время на все попытки
+	Attempt     time.Duration // таймаут одной попытки
+	MaxInterval time.Duration // максимальная пауза между попытками
+}
+
+// DefaultRetryBudget - бюджет повторных попыток по умолчанию
+var DefaultRetryBudget = RetryBudget{Total: 2 * time.Minute, Attempt: 5 * time.Second, MaxInterval: 30 * time.Second}
+
 // NewDB создает и возвращает новый пул соединений с базой данных,
-// используя технику повторных попыток
-func NewDB(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
+// используя технику повторных попыток. Запросы пула трассируются через OpenTelemetry
+func NewDB(ctx context.Context, dsn string, budget RetryBudget) (*pgxpool.Pool, error) {
 	var pool *pgxpool.Pool
 	var lastErr error
 
-	retryCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database DSN: %w", err)
+	}
+	poolConfig.ConnConfig.Tracer = otelpgx.NewTracer()
+
+	retryCtx, cancel := context.WithTimeout(ctx, budget.Total)
 	defer cancel()
 
 	b := backoff.NewExponentialBackOff()
-	b.MaxInterval = 30 * time.Second
+	b.MaxInterval = budget.MaxInterval
 
 	ticker := backoff.NewTicker(b)
 	defer ticker.Stop()
@@ -41,10 +85,10 @@ func NewDB(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 			return nil, fmt.Errorf("retries stopped, context timeout exceeded: %w", lastErr)
 		}
 
-		attemptCtx, attemptCancel := context.WithTimeout(retryCtx, 5*time.Second)
+		attemptCtx, attemptCancel := context.WithTimeout(retryCtx, budget.Attempt)
 
 		var err error
-		pool, err = pgxpool.New(attemptCtx, dsn)
+		pool, err = pgxpool.NewWithConfig(attemptCtx, poolConfig)
 		attemptCancel()
 
 		if err == nil {
@@ -59,13 +103,26 @@ func NewDB(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 	return nil, fmt.Errorf("failed to connect to database after all attempts: %w", lastErr)
 }
 
+// WithMetrics включает сбор длительности операций с БД
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(s *Storage) {
+		s.metrics = m
+	}
+}
+
 // Создание нового экземпляра Storage.
-func NewStorage(pool *pgxpool.Pool) *Storage {
-	return &Storage{pool: pool}
+func NewStorage(pool *pgxpool.Pool, opts ...Option) *Storage {
+	s := &Storage{pool: pool}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // SaveOrder сохраняет заказ в базу данных в рамках одной транзакции.
 func (s *Storage) SaveOrder(ctx context.Context, order model.Order) error {
+	defer s.observe("save_order", time.Now())
+
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -79,9 +136,13 @@ func (s *Storage) SaveOrder(ctx context.Context, order model.Order) error {
 		return fmt.Errorf("failed to insert order: %w", err)
 	}
 
-	deliverySQL := `INSERT INTO deliveries (order_uid, name, phone, zip, city, address, region, email)
-					  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	_, err = tx.Exec(ctx, deliverySQL, order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
+	sealed, err := s.sealDelivery(order.OrderUID, order.Delivery)
+	if err != nil {
+		return err
+	}
+	deliverySQL := `INSERT INTO deliveries (order_uid, name, phone, zip, city, address, region, email, enc_key_id, enc_data_key, pii_tokens)
+					  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	_, err = tx.Exec(ctx, deliverySQL, order.OrderUID, sealed.Name, sealed.Phone, order.Delivery.Zip, order.Delivery.City, sealed.Address, order.Delivery.Region, sealed.Email, sealed.KeyID, sealed.DataKey, sealed.Tokens)
 	if err != nil {
 		return fmt.Errorf("failed to insert delivery: %w", err)
 	}
@@ -102,50 +163,134 @@ func (s *Storage) SaveOrder(ctx context.Context, order model.Order) error {
 		}
 	}
 
+	if err := applyRollups(ctx, tx, order.OrderUID, 1); err != nil {
+		return err
+	}
+
 	return tx.Commit(ctx)
 }
 
 // GetAllOrders загружает N заказов из базы данных для восстановления кэша
 func (s *Storage) GetAllOrders(ctx context.Context, limit int) ([]model.Order, error) {
+	defer s.observe("get_all_orders", time.Now())
+
 	query := `
 		WITH recent_orders AS (
 			SELECT order_uid, track_number, entry, locale, internal_signature,
 				   customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
 			FROM orders
+			WHERE deleted_at IS NULL
 			ORDER BY date_created DESC
 			LIMIT $1
 		)
-		SELECT
-			o.*,
-			d.name as delivery_name, d.phone, d.zip, d.city, d.address, d.region, d.email,
-			p.transaction, p.request_id, p.currency, p.provider, p.amount,
-			p.payment_dt, p.bank, p.delivery_cost, p.goods_total, p.custom_fee,
-			i.chrt_id, i.track_number as item_track_number, i.price, i.rid, i.name as item_name,
-			i.sale, i.size, i.total_price, i.nm_id, i.brand, i.status
+		` + orderColumns + `
 		FROM recent_orders AS o
-		LEFT JOIN deliveries AS d ON o.order_uid = d.order_uid
-		LEFT JOIN payments AS p ON o.order_uid = p.order_uid
-		LEFT JOIN items AS i ON o.order_uid = i.order_uid
+		` + orderJoins + `
 		ORDER BY o.date_created DESC;`
 
 	rows, err := s.pool.Query(ctx, query, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query to get all orders: %w", err)
 	}
+	return s.scanOrders(rows)
+}
+
+// OrderCursor - позиция в списке заказов, отсортированном от новых к старым
+type OrderCursor struct {
+	DateCreated time.Time
+	OrderUID    string
+}
+
+// ListOrders возвращает страницу неотменённых заказов от новых к старым, начиная после after.
+// Пагинация по ключу (date_created, order_uid) не сбивается при вставке новых заказов
+func (s *Storage) ListOrders(ctx context.Context, limit int, after *OrderCursor) ([]model.Order, error) {
+	defer s.observe("list_orders", time.Now())
+
+	// без курсора сравнение с +infinity пропускает все заказы
+	afterTime := pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true}
+	afterUID := ""
+	if after != nil {
+		afterTime = pgtype.Timestamptz{Time: after.DateCreated, Valid: true}
+		afterUID = after.OrderUID
+	}
+
+	query := `
+		WITH page AS (
+			SELECT order_uid, track_number, entry, locale, internal_signature,
+				   customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+			FROM orders
+			WHERE deleted_at IS NULL AND (date_created, order_uid) < ($2::timestamptz, $3)
+			ORDER BY date_created DESC, order_uid DESC
+			LIMIT $1
+		)
+		` + orderColumns + `
+		FROM page AS o
+		` + orderJoins + `
+		ORDER BY o.date_created DESC, o.order_uid DESC;`
+
+	rows, err := s.pool.Query(ctx, query, limit, afterTime, afterUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+	return s.scanOrders(rows)
+}
+
+// GetOrdersByUIDs загружает неотменённые заказы из списка одним запросом.
+// Порядок результата не определён, отсутствующие и отменённые заказы пропускаются
+func (s *Storage) GetOrdersByUIDs(ctx context.Context, uids []string) ([]model.Order, error) {
+	defer s.observe("get_orders_by_uids", time.Now())
+
+	query := `
+		WITH batch AS (
+			SELECT order_uid, track_number, entry, locale, internal_signature,
+				   customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+			FROM orders
+			WHERE order_uid = ANY($1) AND deleted_at IS NULL
+		)
+		` + orderColumns + `
+		FROM batch AS o
+		` + orderJoins + `;`
+
+	rows, err := s.pool.Query(ctx, query, uids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders by uids: %w", err)
+	}
+	return s.scanOrders(rows)
+}
+
+// orderColumns и orderJoins - общая часть запросов, собирающих заказы целиком из CTE "o"
+const (
+	orderColumns = `SELECT
+			o.*,
+			d.name as delivery_name, d.phone, d.zip, d.city, d.address, d.region, d.email, d.enc_key_id, d.enc_data_key,
+			p.transaction, p.request_id, p.currency, p.provider, p.amount,
+			p.payment_dt, p.bank, p.delivery_cost, p.goods_total, p.custom_fee,
+			i.chrt_id, i.track_number as item_track_number, i.price, i.rid, i.name as item_name,
+			i.sale, i.size, i.total_price, i.nm_id, i.brand, i.status`
+	orderJoins = `LEFT JOIN deliveries AS d ON o.order_uid = d.order_uid
+		LEFT JOIN payments AS p ON o.order_uid = p.order_uid
+		LEFT JOIN items AS i ON o.order_uid = i.order_uid`
+)
+
+// scanOrders собирает заказы из строк "заказ x товар", сохраняя порядок строк, и закрывает rows
+func (s *Storage) scanOrders(rows pgx.Rows) ([]model.Order, error) {
 	defer rows.Close()
 
 	orderMap := make(map[string]*model.Order)
+	var uids []string
 
 	for rows.Next() {
 		var o model.Order
 		var d model.Delivery
 		var p model.Payment
 		var i model.Item
+		var keyID *string
+		var dataKey []byte
 
 		err := rows.Scan(
 			&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature,
 			&o.CustomerID, &o.DeliveryService, &o.Shardkey, &o.SmID, &o.DateCreated, &o.OofShard,
-			&d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email,
+			&d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email, &keyID, &dataKey,
 			&p.Transaction, &p.RequestID, &p.Currency, &p.Provider, &p.Amount,
 			&p.PaymentDt, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee,
 			&i.ChrtID, &i.TrackNumber, &i.Price, &i.Rid, &i.Name,
@@ -156,12 +301,16 @@ func (s *Storage) GetAllOrders(ctx context.Context, limit int) ([]model.Order, e
 		}
 
 		if existingOrder, ok := orderMap[o.OrderUID]; !ok {
+			if err := s.openDelivery(o.OrderUID, &d, keyID, dataKey); err != nil {
+				return nil, fmt.Errorf("failed to decrypt delivery for order %s: %w", o.OrderUID, err)
+			}
 			o.Delivery = d
 			o.Payment = p
 			if i.ChrtID > 0 {
 				o.Items = []model.Item{i}
 			}
 			orderMap[o.OrderUID] = &o
+			uids = append(uids, o.OrderUID)
 		} else {
 			if i.ChrtID > 0 {
 				existingOrder.Items = append(existingOrder.Items, i)
@@ -172,20 +321,23 @@ func (s *Storage) GetAllOrders(ctx context.Context, limit int) ([]model.Order, e
 		return nil, fmt.Errorf("error after iterating through orders: %w", rows.Err())
 	}
 
-	orders := make([]model.Order, 0, len(orderMap))
-	for _, order := range orderMap {
-		orders = append(orders, *order)
+	orders := make([]model.Order, 0, len(uids))
+	for _, uid := range uids {
+		orders = append(orders, *orderMap[uid])
 	}
 
 	return orders, nil
 }
 
-// GetOrderByUID ищет один заказ по его UID и собирает все связанные с ним товары
+// GetOrderByUID ищет один заказ по его UID и собирает все связанные с ним товары.
+// Для отменённого (мягко удалённого) заказа возвращает ErrOrderDeleted
 func (s *Storage) GetOrderByUID(ctx context.Context, uid string) (model.Order, error) {
+	defer s.observe("get_order_by_uid", time.Now())
+
 	query := `
 		SELECT
-			o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, 
-			d.name as delivery_name, d.phone, d.zip, d.city, d.address, d.region, d.email,
+			o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, o.deleted_at,
+			d.name as delivery_name, d.phone, d.zip, d.city, d.address, d.region, d.email, d.enc_key_id, d.enc_data_key,
 			p.transaction, p.request_id, p.currency, p.provider, p.amount,p.payment_dt, p.bank, p.delivery_cost, p.goods_total, p.custom_fee,
 			i.chrt_id, i.track_number as item_track_number, i.price, i.rid, i.name as item_name,i.sale, i.size, i.total_price, i.nm_id, i.brand, i.status
 		FROM orders AS o
@@ -201,6 +353,9 @@ func (s *Storage) GetOrderByUID(ctx context.Context, uid string) (model.Order, e
 	defer rows.Close()
 
 	var order model.Order
+	var deletedAt *time.Time
+	var keyID *string
+	var dataKey []byte
 	itemsMap := make(map[int]struct{})
 	found := false
 
@@ -210,8 +365,8 @@ func (s *Storage) GetOrderByUID(ctx context.Context, uid string) (model.Order, e
 
 		err := rows.Scan(
 			&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature,
-			&order.CustomerID, &order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard,
-			&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip, &order.Delivery.City, &order.Delivery.Address, &order.Delivery.Region, &order.Delivery.Email,
+			&order.CustomerID, &order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &deletedAt,
+			&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip, &order.Delivery.City, &order.Delivery.Address, &order.Delivery.Region, &order.Delivery.Email, &keyID, &dataKey,
 			&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency, &order.Payment.Provider, &order.Payment.Amount,
 			&order.Payment.PaymentDt, &order.Payment.Bank, &order.Payment.DeliveryCost, &order.Payment.GoodsTotal, &order.Payment.CustomFee,
 			&i.ChrtID, &i.TrackNumber, &i.Price, &i.Rid, &i.Name,
@@ -235,10 +390,137 @@ func (s *Storage) GetOrderByUID(ctx context.Context, uid string) (model.Order, e
 	if rows.Err() != nil {
 		return model.Order{}, fmt.Errorf("error after iterating order rows: %w", rows.Err())
 	}
+	if deletedAt != nil {
+		return model.Order{}, ErrOrderDeleted
+	}
+	if err := s.openDelivery(order.OrderUID, &order.Delivery, keyID, dataKey); err != nil {
+		return model.Order{}, fmt.Errorf("failed to decrypt delivery: %w", err)
+	}
 
 	return order, nil
 }
 
+// GetOrderByTrackNumber ищет заказ по трек-номеру
+func (s *Storage) GetOrderByTrackNumber(ctx context.Context, trackNumber string) (model.Order, error) {
+	return s.getOrderByLookup(ctx, "get_order_by_track_number",
+		`SELECT order_uid, deleted_at FROM orders WHERE track_number = $1`, trackNumber)
+}
+
+// GetOrderByTransaction ищет заказ по идентификатору транзакции оплаты
+func (s *Storage) GetOrderByTransaction(ctx context.Context, transaction string) (model.Order, error) {
+	return s.getOrderByLookup(ctx, "get_order_by_transaction",
+		`SELECT o.order_uid, o.deleted_at FROM payments AS p JOIN orders AS o ON o.order_uid = p.order_uid WHERE p.transaction = $1`, transaction)
+}
+
+// GetOrderByItemRID ищет заказ по RID одного из его товаров
+func (s *Storage) GetOrderByItemRID(ctx context.Context, rid string) (model.Order, error) {
+	return s.getOrderByLookup(ctx, "get_order_by_item_rid",
+		`SELECT o.order_uid, o.deleted_at FROM items AS i JOIN orders AS o ON o.order_uid = i.order_uid WHERE i.rid = $1`, rid)
+}
+
+// getOrderByLookup находит UID заказа запросом lookup, возвращающим (order_uid, deleted_at), и загружает заказ целиком.
+// Если ключ встречается у нескольких заказов, берётся самый новый неотменённый
+func (s *Storage) getOrderByLookup(ctx context.Context, operation, lookup, key string) (model.Order, error) {
+	start := time.Now()
+
+	var uid string
+	var deletedAt *time.Time
+	err := s.pool.QueryRow(ctx, `
+		SELECT l.order_uid, l.deleted_at
+		FROM (`+lookup+`) AS l
+		JOIN orders AS o ON o.order_uid = l.order_uid
+		ORDER BY l.deleted_at IS NOT NULL, o.date_created DESC
+		LIMIT 1`, key).Scan(&uid, &deletedAt)
+	s.observe(operation, start)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Order{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return model.Order{}, fmt.Errorf("failed to look up order: %w", err)
+	}
+	if deletedAt != nil {
+		return model.Order{}, ErrOrderDeleted
+	}
+	return s.GetOrderByUID(ctx, uid)
+}
+
+// CancelOrder помечает заказ как отменённый (мягкое удаление) и вычитает его из дневных агрегатов.
+// Данные заказа остаются в БД, повторная отмена не меняет исходное время отмены
+func (s *Storage) CancelOrder(ctx context.Context, uid string) error {
+	defer s.observe("cancel_order", time.Now())
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE orders SET deleted_at = NOW() WHERE order_uid = $1 AND deleted_at IS NULL`, uid)
+	if err != nil {
+		return fmt.Errorf("failed to cancel order: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		// заказа нет или он уже отменён: во втором случае отмена ничего не меняет
+		var exists bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE order_uid = $1)`, uid).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check order: %w", err)
+		}
+		if !exists {
+			return ErrOrderNotFound
+		}
+		return nil
+	}
+
+	if err := applyRollups(ctx, tx, uid, -1); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// DeleteOrder полностью удаляет заказ из БД (жёсткое удаление).
+// Доставка, оплата и товары удаляются каскадно; неотменённый заказ вычитается из дневных агрегатов
+func (s *Storage) DeleteOrder(ctx context.Context, uid string) error {
+	defer s.observe("delete_order", time.Now())
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var deletedAt *time.Time
+	err = tx.QueryRow(ctx, `SELECT deleted_at FROM orders WHERE order_uid = $1 FOR UPDATE`, uid).Scan(&deletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock order: %w", err)
+	}
+	// отменённый заказ уже вычтен при отмене
+	if deletedAt == nil {
+		if err := applyRollups(ctx, tx, uid, -1); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM orders WHERE order_uid = $1`, uid); err != nil {
+		return fmt.Errorf("failed to delete order: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// observe записывает длительность операции с БД, если метрики подключены
+func (s *Storage) observe(operation string, start time.Time) {
+	if s.metrics != nil {
+		s.metrics.DBQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Ping проверяет доступность базы данных
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
 func (s *Storage) Close() {
 	s.pool.Close()
 }
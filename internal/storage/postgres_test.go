@@ -1,9 +1,12 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"log"
 	"os"
+	"test_task_wb/internal/audit"
+	"test_task_wb/internal/encryption"
 	"test_task_wb/internal/model"
 	"testing"
 	"time"
@@ -45,17 +48,14 @@ func TestMain(m *testing.M) {
 }
 
 func truncateTables(t *testing.T, ctx context.Context, pool *pgxpool.Pool) {
-	_, err := pool.Exec(ctx, "TRUNCATE TABLE items, payments, deliveries, orders RESTART IDENTITY CASCADE")
+	_, err := pool.Exec(ctx, "TRUNCATE TABLE items, payments, deliveries, orders, customer_erasures, access_log, daily_order_rollups, daily_brand_rollups RESTART IDENTITY CASCADE")
 	require.NoError(t, err)
 }
 
-func TestStorage_SaveAndGetAllOrders(t *testing.T) {
-	ctx := context.Background()
-
-	truncateTables(t, ctx, testStorage.pool)
-
-	order := model.Order{
-		OrderUID:    "testuid123",
+// newTestOrder создает валидный тестовый заказ с заданным UID
+func newTestOrder(uid string) model.Order {
+	return model.Order{
+		OrderUID:    uid,
 		TrackNumber: "track1",
 		Entry:       "WBIL",
 		Delivery: model.Delivery{
@@ -63,7 +63,7 @@ func TestStorage_SaveAndGetAllOrders(t *testing.T) {
 			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com",
 		},
 		Payment: model.Payment{
-			Transaction: "testuid123", RequestID: "", Currency: "USD", Provider: "wbpay",
+			Transaction: uid, RequestID: "", Currency: "USD", Provider: "wbpay",
 			Amount: 1817, PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: 1500,
 			GoodsTotal: 317, CustomFee: 0,
 		},
@@ -74,6 +74,14 @@ func TestStorage_SaveAndGetAllOrders(t *testing.T) {
 		Locale: "en", InternalSignature: "", CustomerID: "test", DeliveryService: "meest",
 		Shardkey: "9", SmID: 99, DateCreated: time.Now().UTC().Truncate(time.Second), OofShard: "1",
 	}
+}
+
+func TestStorage_SaveAndGetAllOrders(t *testing.T) {
+	ctx := context.Background()
+
+	truncateTables(t, ctx, testStorage.pool)
+
+	order := newTestOrder("testuid123")
 
 	err := testStorage.SaveOrder(ctx, order)
 	require.NoError(t, err, "Сохранение заказа не должно вызывать ошибку")
@@ -90,3 +98,457 @@ func TestStorage_SaveAndGetAllOrders(t *testing.T) {
 	require.Len(t, restored.Items, 1, "У заказа должен быть один товар")
 	require.Equal(t, order.Items[0].ChrtID, restored.Items[0].ChrtID)
 }
+
+func TestStorage_GetOrdersByUIDs(t *testing.T) {
+	ctx := context.Background()
+
+	truncateTables(t, ctx, testStorage.pool)
+
+	first := newTestOrder("batchuid1")
+	second := newTestOrder("batchuid2")
+	cancelled := newTestOrder("batchuid3")
+	for _, o := range []model.Order{first, second, cancelled} {
+		require.NoError(t, testStorage.SaveOrder(ctx, o))
+	}
+	require.NoError(t, testStorage.CancelOrder(ctx, cancelled.OrderUID))
+
+	found, err := testStorage.GetOrdersByUIDs(ctx, []string{second.OrderUID, "non_existent_order", cancelled.OrderUID, first.OrderUID})
+	require.NoError(t, err)
+	require.Len(t, found, 2, "Отсутствующие и отменённые заказы не должны возвращаться")
+
+	uids := []string{found[0].OrderUID, found[1].OrderUID}
+	require.ElementsMatch(t, []string{first.OrderUID, second.OrderUID}, uids)
+	for _, o := range found {
+		require.Len(t, o.Items, 1, "Товары заказа должны собираться так же, как при одиночном чтении")
+	}
+}
+
+func TestStorage_SearchOrders(t *testing.T) {
+	ctx := context.Background()
+
+	truncateTables(t, ctx, testStorage.pool)
+
+	mascara := newTestOrder("searchuid1")
+	lipstick := newTestOrder("searchuid2")
+	lipstick.Items[0].Name, lipstick.Items[0].Brand = "Lipstick", "Maybelline"
+	lipstick.Delivery.Name, lipstick.Delivery.Phone = "Anna Smirnova", "+79991234567"
+	for _, o := range []model.Order{mascara, lipstick} {
+		require.NoError(t, testStorage.SaveOrder(ctx, o))
+	}
+
+	uids := func(q SearchQuery) []string {
+		q.Limit = 10
+		hits, err := testStorage.SearchOrders(ctx, q)
+		require.NoError(t, err)
+		var out []string
+		for _, h := range hits {
+			out = append(out, h.OrderUID)
+		}
+		return out
+	}
+
+	require.Equal(t, []string{"searchuid2"}, uids(SearchQuery{TSQuery: "maybel:*"}), "Бренд должен находиться по префиксу")
+	require.Equal(t, []string{"searchuid1"}, uids(SearchQuery{Pattern: "scar"}), "Название товара должно находиться по подстроке")
+	require.ElementsMatch(t, []string{"searchuid1", "searchuid2"}, uids(SearchQuery{TSQuery: "kiryat:*"}), "Город не относится к персональным данным")
+
+	require.Empty(t, uids(SearchQuery{TSQuery: "smirnova:*"}), "Без доступа к PII имя получателя не ищется")
+	require.Equal(t, []string{"searchuid2"}, uids(SearchQuery{TSQuery: "smirnova:*", IncludePII: true}))
+	require.Equal(t, []string{"searchuid2"}, uids(SearchQuery{PhoneDigits: "12345", IncludePII: true}), "Телефон должен находиться по части номера")
+
+	require.NoError(t, testStorage.CancelOrder(ctx, lipstick.OrderUID))
+	require.Empty(t, uids(SearchQuery{TSQuery: "maybel:*"}), "Отменённые заказы не должны находиться")
+}
+
+func TestStorage_SecondaryLookups(t *testing.T) {
+	ctx := context.Background()
+
+	truncateTables(t, ctx, testStorage.pool)
+
+	order := newTestOrder("lookupuid1")
+	order.TrackNumber = "LOOKUPTRACK1"
+	require.NoError(t, testStorage.SaveOrder(ctx, order))
+
+	lookups := map[string]func(context.Context, string) (model.Order, error){
+		order.TrackNumber:         testStorage.GetOrderByTrackNumber,
+		order.Payment.Transaction: testStorage.GetOrderByTransaction,
+		order.Items[0].Rid:        testStorage.GetOrderByItemRID,
+	}
+	for key, lookup := range lookups {
+		found, err := lookup(ctx, key)
+		require.NoError(t, err, "Заказ должен находиться по ключу %s", key)
+		require.Equal(t, order.OrderUID, found.OrderUID)
+
+		_, err = lookup(ctx, "non_existent_key")
+		require.ErrorIs(t, err, ErrOrderNotFound)
+	}
+
+	require.NoError(t, testStorage.CancelOrder(ctx, order.OrderUID))
+	_, err := testStorage.GetOrderByTrackNumber(ctx, order.TrackNumber)
+	require.ErrorIs(t, err, ErrOrderDeleted, "Отменённый заказ должен возвращать ErrOrderDeleted")
+}
+
+func TestStorage_Analytics(t *testing.T) {
+	ctx := context.Background()
+
+	truncateTables(t, ctx, testStorage.pool)
+
+	day := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	first := newTestOrder("analyticsuid1")
+	first.DateCreated = day
+	second := newTestOrder("analyticsuid2")
+	second.DateCreated = day.Add(time.Hour)
+	second.Items[0].Sale = 0
+	cancelled := newTestOrder("analyticsuid3")
+	cancelled.DateCreated = day
+	for _, o := range []model.Order{first, second, cancelled} {
+		require.NoError(t, testStorage.SaveOrder(ctx, o))
+	}
+	require.NoError(t, testStorage.CancelOrder(ctx, cancelled.OrderUID))
+
+	tr := TimeRange{From: day.Add(-time.Hour), To: day.Add(24 * time.Hour)}
+
+	revenue, err := testStorage.RevenueByDay(ctx, tr)
+	require.NoError(t, err)
+	require.Equal(t, []DailyRevenue{{Day: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), Currency: "USD", Orders: 2, Revenue: 2 * 1817}}, revenue,
+		"Отменённые заказы не должны учитываться в выручке")
+
+	brands, err := testStorage.TopItems(ctx, tr, GroupByBrand, OrderByRevenue, 10)
+	require.NoError(t, err)
+	require.Equal(t, []ItemStat{{Key: "Vivienne Sabo", Currency: "USD", Units: 2, Revenue: 2 * 317}}, brands)
+
+	costs, err := testStorage.DeliveryCosts(ctx, tr)
+	require.NoError(t, err)
+	require.Equal(t, []DeliveryCostStat{{DeliveryService: "meest", Currency: "USD", Orders: 2, AvgCost: 1500}}, costs)
+
+	cities, err := testStorage.OrdersByLocation(ctx, tr, GroupByCity, 10)
+	require.NoError(t, err)
+	require.Equal(t, []LocationStat{{Location: "Kiryat Mozkin", Orders: 2}}, cities)
+
+	sales, err := testStorage.AverageSale(ctx, tr)
+	require.NoError(t, err)
+	require.Equal(t, SaleStat{Items: 2, DiscountedItems: 1, AvgSale: 15, AvgDiscountedSale: 30}, sales)
+
+	empty, err := testStorage.RevenueByDay(ctx, TimeRange{From: day.Add(48 * time.Hour), To: day.Add(72 * time.Hour)})
+	require.NoError(t, err)
+	require.Empty(t, empty, "Заказы вне интервала не должны учитываться")
+}
+
+func TestStorage_Rollups(t *testing.T) {
+	ctx := context.Background()
+
+	truncateTables(t, ctx, testStorage.pool)
+
+	day := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	kept := newTestOrder("rollupuid1")
+	kept.DateCreated = day
+	cancelled := newTestOrder("rollupuid2")
+	cancelled.DateCreated = day
+	deleted := newTestOrder("rollupuid3")
+	deleted.DateCreated = day
+	for _, o := range []model.Order{kept, cancelled, deleted} {
+		require.NoError(t, testStorage.SaveOrder(ctx, o))
+	}
+	require.NoError(t, testStorage.CancelOrder(ctx, cancelled.OrderUID))
+	require.NoError(t, testStorage.CancelOrder(ctx, cancelled.OrderUID), "Повторная отмена не должна вычитать заказ дважды")
+	require.NoError(t, testStorage.DeleteOrder(ctx, deleted.OrderUID))
+	require.NoError(t, testStorage.DeleteOrder(ctx, cancelled.OrderUID), "Удаление отменённого заказа не должно вычитать его повторно")
+
+	// интервал из целых суток UTC строится по агрегатам
+	tr := TimeRange{From: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)}
+	want := []DailyRevenue{{Day: tr.From, Currency: "USD", Orders: 1, Revenue: 1817}}
+
+	revenue, err := testStorage.RevenueByDay(ctx, tr)
+	require.NoError(t, err)
+	require.Equal(t, want, revenue, "Агрегаты должны учитывать только неотменённые заказы")
+
+	brands, err := testStorage.TopItems(ctx, tr, GroupByBrand, OrderByUnits, 10)
+	require.NoError(t, err)
+	require.Equal(t, []ItemStat{{Key: "Vivienne Sabo", Currency: "USD", Units: 1, Revenue: 317}}, brands)
+
+	sales, err := testStorage.AverageSale(ctx, tr)
+	require.NoError(t, err)
+	require.Equal(t, SaleStat{Items: 1, DiscountedItems: 1, AvgSale: 30, AvgDiscountedSale: 30}, sales)
+
+	t.Run("Backfill", func(t *testing.T) {
+		_, err := testStorage.pool.Exec(ctx, "UPDATE daily_order_rollups SET orders = 100")
+		require.NoError(t, err)
+
+		stats, err := testStorage.RebuildRollups(ctx, tr)
+		require.NoError(t, err)
+		require.Equal(t, RollupStats{OrderRows: 1, BrandRows: 1}, stats)
+
+		revenue, err := testStorage.RevenueByDay(ctx, tr)
+		require.NoError(t, err)
+		require.Equal(t, want, revenue, "Пересчёт должен восстановить агрегаты по исходным таблицам")
+
+		_, err = testStorage.RebuildRollups(ctx, TimeRange{From: day, To: day.Add(24 * time.Hour)})
+		require.Error(t, err, "Интервал, не выровненный по суткам, должен отклоняться")
+	})
+}
+
+func TestStorage_ExportOrders(t *testing.T) {
+	ctx := context.Background()
+
+	truncateTables(t, ctx, testStorage.pool)
+
+	day := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	older := newTestOrder("exportuid1")
+	older.DateCreated = day
+	older.Items = append(older.Items, older.Items[0])
+	older.Items[1].ChrtID = 9934931
+	newer := newTestOrder("exportuid2")
+	newer.DateCreated = day.Add(time.Hour)
+	newer.DeliveryService = "dhl"
+	cancelled := newTestOrder("exportuid3")
+	cancelled.DateCreated = day
+	for _, o := range []model.Order{newer, older, cancelled} {
+		require.NoError(t, testStorage.SaveOrder(ctx, o))
+	}
+	require.NoError(t, testStorage.CancelOrder(ctx, cancelled.OrderUID))
+
+	collect := func(f ExportFilter) []ExportRow {
+		var rows []ExportRow
+		n, err := testStorage.ExportOrders(ctx, f, func(r ExportRow) error {
+			rows = append(rows, r)
+			return nil
+		})
+		require.NoError(t, err)
+		require.EqualValues(t, len(rows), n)
+		return rows
+	}
+
+	rows := collect(ExportFilter{})
+	require.Len(t, rows, 3, "Ожидается строка на каждый товар неотменённых заказов")
+	require.Equal(t, []string{"exportuid1", "exportuid1", "exportuid2"}, []string{rows[0].OrderUID, rows[1].OrderUID, rows[2].OrderUID},
+		"Заказы должны идти от старых к новым")
+	require.Equal(t, 9934931, rows[1].ChrtID)
+	require.Equal(t, older.Payment.Currency, rows[0].Currency)
+	require.Equal(t, older.Delivery.City, rows[0].City)
+
+	rows = collect(ExportFilter{DeliveryService: "dhl"})
+	require.Len(t, rows, 1)
+	require.Equal(t, newer.OrderUID, rows[0].OrderUID)
+
+	rows = collect(ExportFilter{From: day.Add(30 * time.Minute)})
+	require.Len(t, rows, 1, "Фильтр по дате должен отсекать старые заказы")
+
+	_, err := testStorage.ExportOrders(ctx, ExportFilter{}, func(ExportRow) error { return context.Canceled })
+	require.ErrorIs(t, err, context.Canceled, "Ошибка обработчика должна прерывать выгрузку")
+}
+
+func TestStorage_CancelAndDeleteOrder(t *testing.T) {
+	ctx := context.Background()
+
+	truncateTables(t, ctx, testStorage.pool)
+
+	cancelled := newTestOrder("canceluid1")
+	deleted := newTestOrder("deleteuid1")
+	require.NoError(t, testStorage.SaveOrder(ctx, cancelled))
+	require.NoError(t, testStorage.SaveOrder(ctx, deleted))
+
+	t.Run("Soft delete", func(t *testing.T) {
+		require.NoError(t, testStorage.CancelOrder(ctx, cancelled.OrderUID))
+		require.NoError(t, testStorage.CancelOrder(ctx, cancelled.OrderUID), "Повторная отмена не должна вызывать ошибку")
+
+		_, err := testStorage.GetOrderByUID(ctx, cancelled.OrderUID)
+		require.ErrorIs(t, err, ErrOrderDeleted, "Отменённый заказ должен возвращать ErrOrderDeleted")
+
+		restoredOrders, err := testStorage.GetAllOrders(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, restoredOrders, 1, "Отменённый заказ не должен попадать в кэш при восстановлении")
+		require.Equal(t, deleted.OrderUID, restoredOrders[0].OrderUID)
+	})
+
+	t.Run("Hard delete", func(t *testing.T) {
+		require.NoError(t, testStorage.DeleteOrder(ctx, deleted.OrderUID))
+
+		_, err := testStorage.GetOrderByUID(ctx, deleted.OrderUID)
+		require.ErrorIs(t, err, ErrOrderNotFound, "Удалённый заказ должен возвращать ErrOrderNotFound")
+
+		err = testStorage.DeleteOrder(ctx, deleted.OrderUID)
+		require.ErrorIs(t, err, ErrOrderNotFound, "Повторное удаление должно возвращать ErrOrderNotFound")
+	})
+
+	t.Run("Unknown order", func(t *testing.T) {
+		err := testStorage.CancelOrder(ctx, "non_existent_order")
+		require.ErrorIs(t, err, ErrOrderNotFound)
+	})
+}
+
+func TestStorage_EraseCustomer(t *testing.T) {
+	ctx := context.Background()
+
+	truncateTables(t, ctx, testStorage.pool)
+
+	erased := newTestOrder("eraseuid1")
+	erased.CustomerID = "customer42"
+	other := newTestOrder("keepuid1")
+	require.NoError(t, testStorage.SaveOrder(ctx, erased))
+	require.NoError(t, testStorage.SaveOrder(ctx, other))
+
+	result, err := testStorage.EraseCustomer(ctx, "customer42", "test")
+	require.NoError(t, err, "Обезличивание не должно вызывать ошибку")
+	require.Equal(t, []string{erased.OrderUID}, result.OrderUIDs)
+
+	restored, err := testStorage.GetOrderByUID(ctx, erased.OrderUID)
+	require.NoError(t, err)
+	require.NotEqual(t, erased.Delivery.Name, restored.Delivery.Name, "Имя должно быть заменено псевдонимом")
+	require.NotEqual(t, erased.Delivery.Phone, restored.Delivery.Phone, "Телефон должен быть заменён псевдонимом")
+	require.NotEqual(t, erased.Delivery.Email, restored.Delivery.Email, "Email должен быть заменён псевдонимом")
+	require.Equal(t, erased.Delivery.City, restored.Delivery.City, "Город сохраняется для отчётности")
+	require.Equal(t, erased.Payment.Amount, restored.Payment.Amount, "Финансовые данные не должны меняться")
+	require.Len(t, restored.Items, 1, "Товары не должны удаляться")
+
+	untouched, err := testStorage.GetOrderByUID(ctx, other.OrderUID)
+	require.NoError(t, err)
+	require.Equal(t, other.Delivery.Name, untouched.Delivery.Name, "Заказы других клиентов не должны меняться")
+
+	var audited int
+	err = testStorage.pool.QueryRow(ctx, "SELECT COUNT(*) FROM customer_erasures WHERE customer_id = $1", "customer42").Scan(&audited)
+	require.NoError(t, err)
+	require.Equal(t, 1, audited, "Удаление должно быть записано в журнал аудита")
+}
+
+func TestStorage_EncryptedDelivery(t *testing.T) {
+	ctx := context.Background()
+
+	truncateTables(t, ctx, testStorage.pool)
+
+	oldKey := bytes.Repeat([]byte{1}, encryption.KeySize)
+	newKey := bytes.Repeat([]byte{2}, encryption.KeySize)
+
+	oldRing, err := encryption.NewKeyring("k1", map[string][]byte{"k1": oldKey})
+	require.NoError(t, err)
+	encStorage := NewStorage(testStorage.pool, WithKeyring(oldRing))
+
+	order := newTestOrder("encuid1")
+	require.NoError(t, encStorage.SaveOrder(ctx, order))
+
+	var rawPhone, keyID string
+	err = testStorage.pool.QueryRow(ctx, "SELECT phone, enc_key_id FROM deliveries WHERE order_uid = $1", order.OrderUID).Scan(&rawPhone, &keyID)
+	require.NoError(t, err)
+	require.NotEqual(t, order.Delivery.Phone, rawPhone, "Телефон не должен храниться в открытом виде")
+	require.Equal(t, "k1", keyID)
+
+	restored, err := encStorage.GetOrderByUID(ctx, order.OrderUID)
+	require.NoError(t, err)
+	require.Equal(t, order.Delivery, restored.Delivery, "Данные доставки должны прозрачно расшифровываться")
+
+	newRing, err := encryption.NewKeyring("k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+	require.NoError(t, err)
+	rotatedStorage := NewStorage(testStorage.pool, WithKeyring(newRing))
+
+	res, err := rotatedStorage.ReencryptDeliveries(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Updated, "Строка со старым ключом должна быть перешифрована")
+
+	res, err = rotatedStorage.ReencryptDeliveries(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Zero(t, res.Selected, "Повторный запуск не должен находить строк для перешифрования")
+
+	restoredOrders, err := rotatedStorage.GetAllOrders(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, restoredOrders, 1)
+	require.Equal(t, order.Delivery, restoredOrders[0].Delivery)
+}
+
+func TestStorage_ReencryptSkipsUndecryptableRows(t *testing.T) {
+	ctx := context.Background()
+
+	truncateTables(t, ctx, testStorage.pool)
+
+	retiredRing, err := encryption.NewKeyring("k0", map[string][]byte{"k0": bytes.Repeat([]byte{9}, encryption.KeySize)})
+	require.NoError(t, err)
+	// первая строка зашифрована ключом, которого уже нет в связке, вторая хранится открыто
+	require.NoError(t, NewStorage(testStorage.pool, WithKeyring(retiredRing)).SaveOrder(ctx, newTestOrder("retireduid1")))
+	require.NoError(t, testStorage.SaveOrder(ctx, newTestOrder("plainuid1")))
+
+	ring, err := encryption.NewKeyring("k2", map[string][]byte{"k2": bytes.Repeat([]byte{2}, encryption.KeySize)})
+	require.NoError(t, err)
+	encStorage := NewStorage(testStorage.pool, WithKeyring(ring))
+
+	res, err := encStorage.ReencryptDeliveries(ctx, 0, 1)
+	require.NoError(t, err, "Нерасшифровываемая строка не должна прерывать перешифрование")
+	require.Equal(t, ReencryptResult{Selected: 1, Failed: 1, LastID: res.LastID}, res)
+
+	res, err = encStorage.ReencryptDeliveries(ctx, res.LastID, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Updated, "Строка после нерасшифровываемой должна обрабатываться")
+
+	var keyID *string
+	err = testStorage.pool.QueryRow(ctx, "SELECT enc_key_id FROM deliveries WHERE order_uid = $1", "plainuid1").Scan(&keyID)
+	require.NoError(t, err)
+	require.NotNil(t, keyID)
+	require.Equal(t, "k2", *keyID)
+}
+
+func TestStorage_EncryptedSearch(t *testing.T) {
+	ctx := context.Background()
+
+	truncateTables(t, ctx, testStorage.pool)
+
+	ring, err := encryption.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, encryption.KeySize)})
+	require.NoError(t, err)
+	blind, err := encryption.NewBlindIndex(bytes.Repeat([]byte{3}, encryption.KeySize))
+	require.NoError(t, err)
+
+	// строка зашифрована до появления ключа индекса и попадает в него только при перешифровании
+	unindexed := NewStorage(testStorage.pool, WithKeyring(ring))
+	order := newTestOrder("encsearchuid1")
+	order.Delivery.Name, order.Delivery.Phone = "Anna Smirnova", "+79991234567"
+	require.NoError(t, unindexed.SaveOrder(ctx, order))
+
+	gap, err := unindexed.PIISearchGap(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, gap, "Без ключа индекса поиск должен сообщать о неполноте")
+
+	encStorage := NewStorage(testStorage.pool, WithKeyring(ring), WithBlindIndex(blind))
+	uids := func(q SearchQuery) []string {
+		q.Limit, q.IncludePII = 10, true
+		hits, err := encStorage.SearchOrders(ctx, q)
+		require.NoError(t, err)
+		var out []string
+		for _, h := range hits {
+			out = append(out, h.OrderUID)
+		}
+		return out
+	}
+	require.Empty(t, uids(SearchQuery{Words: []string{"smirnova"}}), "Строка без меток не должна находиться")
+	gap, err = encStorage.PIISearchGap(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, gap, "Строки без меток должны делать поиск неполным")
+
+	res, err := encStorage.ReencryptDeliveries(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Updated, "Перешифрование должно достроить метки строки")
+	gap, err = encStorage.PIISearchGap(ctx)
+	require.NoError(t, err)
+	require.Empty(t, gap)
+
+	require.Equal(t, []string{"encsearchuid1"}, uids(SearchQuery{Words: []string{"anna", "smirnova"}}), "Имя должно находиться по целым словам")
+	require.Equal(t, []string{"encsearchuid1"}, uids(SearchQuery{Words: SearchWords("test@gmail.com")}), "Email должен находиться по словам")
+	require.Equal(t, []string{"encsearchuid1"}, uids(SearchQuery{PhoneDigits: "4567"}), "Телефон должен находиться по окончанию номера")
+	require.Empty(t, uids(SearchQuery{Words: []string{"smirn"}}), "Части слов зашифрованных полей не ищутся")
+	require.Empty(t, uids(SearchQuery{Words: []string{"smirnova", "petrova"}}), "Должны совпасть все слова запроса")
+
+	second := newTestOrder("encsearchuid2")
+	require.NoError(t, encStorage.SaveOrder(ctx, second))
+	require.Equal(t, []string{"encsearchuid2"}, uids(SearchQuery{Words: []string{"testov"}}), "Новые строки должны сразу попадать в индекс")
+}
+
+func TestStorage_SaveAccessLog(t *testing.T) {
+	ctx := context.Background()
+
+	truncateTables(t, ctx, testStorage.pool)
+
+	entries := []audit.Entry{
+		{Principal: "alice", AuthMethod: "jwt", Action: "order.get", Target: "order1", Status: 200, At: time.Now()},
+		{Principal: "bot", AuthMethod: "api_key", Action: "order.get", Target: "order2", Status: 404, At: time.Now()},
+	}
+	require.NoError(t, testStorage.SaveAccessLog(ctx, entries))
+
+	var principal string
+	err := testStorage.pool.QueryRow(ctx, "SELECT principal FROM access_log WHERE target = $1", "order1").Scan(&principal)
+	require.NoError(t, err)
+	require.Equal(t, "alice", principal, "В журнале должен сохраняться тот, кто запросил заказ")
+}
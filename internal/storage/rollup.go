@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// RollupStats - сколько строк агрегатов получилось после пересчёта
+type RollupStats struct {
+	OrderRows int64 `json:"order_rows"`
+	BrandRows int64 `json:"brand_rows"`
+}
+
+// dayAligned сообщает, что обе границы интервала приходятся на полночь UTC,
+// то есть отчёт можно собрать из дневных агрегатов
+func (r TimeRange) dayAligned() bool {
+	return isMidnightUTC(r.From) && isMidnightUTC(r.To)
+}
+
+func isMidnightUTC(t time.Time) bool {
+	return t.Equal(t.UTC().Truncate(24 * time.Hour))
+}
+
+// applyRollups прибавляет заказ к дневным агрегатам (sign = 1) или вычитает его (sign = -1).
+// Вызывается в транзакции, меняющей заказ, пока его строки ещё в БД
+func applyRollups(ctx context.Context, tx pgx.Tx, uid string, sign int) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO daily_order_rollups AS r (day, currency, delivery_service, orders, revenue, delivery_cost)
+		SELECT (o.date_created AT TIME ZONE 'UTC')::date, p.currency, o.delivery_service,
+			   $2, $2 * p.amount, $2 * p.delivery_cost
+		FROM orders AS o
+		JOIN payments AS p ON p.order_uid = o.order_uid
+		WHERE o.order_uid = $1
+		ON CONFLICT (day, currency, delivery_service) DO UPDATE SET
+			orders = r.orders + EXCLUDED.orders,
+			revenue = r.revenue + EXCLUDED.revenue,
+			delivery_cost = r.delivery_cost + EXCLUDED.delivery_cost`, uid, sign)
+	if err != nil {
+		return fmt.Errorf("failed to update order rollups: %w", err)
+	}
+
+	// товары одного бренда складываются заранее: ON CONFLICT не может обновить строку дважды за запрос
+	_, err = tx.Exec(ctx, `
+		INSERT INTO daily_brand_rollups AS r (day, brand, currency, units, revenue, sale_sum, discounted_units)
+		SELECT (o.date_created AT TIME ZONE 'UTC')::date, i.brand, p.currency,
+			   $2 * count(*), $2 * sum(i.total_price), $2 * sum(i.sale), $2 * count(*) FILTER (WHERE i.sale > 0)
+		FROM items AS i
+		JOIN orders AS o ON o.order_uid = i.order_uid
+		JOIN payments AS p ON p.order_uid = o.order_uid
+		WHERE o.order_uid = $1
+		GROUP BY 1, 2, 3
+		ON CONFLICT (day, brand, currency) DO UPDATE SET
+			units = r.units + EXCLUDED.units,
+			revenue = r.revenue + EXCLUDED.revenue,
+			sale_sum = r.sale_sum + EXCLUDED.sale_sum,
+			discounted_units = r.discounted_units + EXCLUDED.discounted_units`, uid, sign)
+	if err != nil {
+		return fmt.Errorf("failed to update brand rollups: %w", err)
+	}
+	return nil
+}
+
+// RebuildRollups пересчитывает дневные агрегаты за интервал по исходным таблицам.
+// Границы должны приходиться на полночь UTC; нулевой интервал означает всю историю.
+// На время пересчёта таблицы агрегатов блокируются, и сохранение заказов ждёт его окончания
+func (s *Storage) RebuildRollups(ctx context.Context, r TimeRange) (RollupStats, error) {
+	defer s.observe("rebuild_rollups", time.Now())
+
+	from := pgtype.Timestamptz{InfinityModifier: pgtype.NegativeInfinity, Valid: true}
+	to := pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true}
+	if r != (TimeRange{}) {
+		if !r.dayAligned() || !r.From.Before(r.To) {
+			return RollupStats{}, errors.New("rollup range must be a non-empty range of whole UTC days")
+		}
+		from = pgtype.Timestamptz{Time: r.From, Valid: true}
+		to = pgtype.Timestamptz{Time: r.To, Valid: true}
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return RollupStats{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// блокировка дожидается транзакций, уже прибавивших свои заказы, а новые ждут пересчёта,
+	// поэтому ни один заказ не учитывается дважды и не теряется
+	if _, err := tx.Exec(ctx, `LOCK TABLE daily_order_rollups, daily_brand_rollups IN EXCLUSIVE MODE`); err != nil {
+		return RollupStats{}, fmt.Errorf("failed to lock rollup tables: %w", err)
+	}
+
+	const dayRange = `day >= ($1::timestamptz AT TIME ZONE 'UTC')::date AND day < ($2::timestamptz AT TIME ZONE 'UTC')::date`
+	for _, table := range []string{"daily_order_rollups", "daily_brand_rollups"} {
+		if _, err := tx.Exec(ctx, `DELETE FROM `+table+` WHERE `+dayRange, from, to); err != nil {
+			return RollupStats{}, fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+
+	var stats RollupStats
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO daily_order_rollups (day, currency, delivery_service, orders, revenue, delivery_cost)
+		SELECT (o.date_created AT TIME ZONE 'UTC')::date, p.currency, o.delivery_service,
+			   count(*), sum(p.amount), sum(p.delivery_cost)
+		FROM orders AS o
+		JOIN payments AS p ON p.order_uid = o.order_uid
+		WHERE `+analyticsScope+`
+		GROUP BY 1, 2, 3`, from, to)
+	if err != nil {
+		return RollupStats{}, fmt.Errorf("failed to rebuild order rollups: %w", err)
+	}
+	stats.OrderRows = tag.RowsAffected()
+
+	tag, err = tx.Exec(ctx, `
+		INSERT INTO daily_brand_rollups (day, brand, currency, units, revenue, sale_sum, discounted_units)
+		SELECT (o.date_created AT TIME ZONE 'UTC')::date, i.brand, p.currency,
+			   count(*), sum(i.total_price), sum(i.sale), count(*) FILTER (WHERE i.sale > 0)
+		FROM items AS i
+		JOIN orders AS o ON o.order_uid = i.order_uid
+		JOIN payments AS p ON p.order_uid = o.order_uid
+		WHERE `+analyticsScope+`
+		GROUP BY 1, 2, 3`, from, to)
+	if err != nil {
+		return RollupStats{}, fmt.Errorf("failed to rebuild brand rollups: %w", err)
+	}
+	stats.BrandRows = tag.RowsAffected()
+
+	if err := tx.Commit(ctx); err != nil {
+		return RollupStats{}, fmt.Errorf("failed to commit rollups: %w", err)
+	}
+	return stats, nil
+}
+
+// rollupDays - условие отчётов по агрегатам: дни интервала, границы которого выровнены по суткам
+const rollupDays = `day >= $1::date AND day < $2::date`
+
+func (s *Storage) revenueFromRollups(ctx context.Context, r TimeRange) ([]DailyRevenue, error) {
+	defer s.observe("analytics_revenue_rollup", time.Now())
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT day, currency, sum(orders)::bigint, sum(revenue)::bigint
+		FROM daily_order_rollups
+		WHERE `+rollupDays+`
+		GROUP BY 1, 2
+		HAVING sum(orders) > 0
+		ORDER BY 1, 2`, r.From, r.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revenue rollups: %w", err)
+	}
+	return collectRows(rows, func(row pgx.CollectableRow) (DailyRevenue, error) {
+		var d DailyRevenue
+		err := row.Scan(&d.Day, &d.Currency, &d.Orders, &d.Revenue)
+		d.Day = d.Day.UTC()
+		return d, err
+	})
+}
+
+func (s *Storage) topBrandsFromRollups(ctx context.Context, r TimeRange, orderBy string, limit int) ([]ItemStat, error) {
+	defer s.observe("analytics_top_items_rollup", time.Now())
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT brand, currency, sum(units)::bigint AS units, sum(revenue)::bigint AS revenue
+		FROM daily_brand_rollups
+		WHERE `+rollupDays+`
+		GROUP BY 1, 2
+		HAVING sum(units) > 0
+		ORDER BY `+orderBy+`, 1, 2
+		LIMIT $3`, r.From, r.To, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query brand rollups: %w", err)
+	}
+	return collectRows(rows, func(row pgx.CollectableRow) (ItemStat, error) {
+		var st ItemStat
+		err := row.Scan(&st.Key, &st.Currency, &st.Units, &st.Revenue)
+		return st, err
+	})
+}
+
+func (s *Storage) deliveryCostsFromRollups(ctx context.Context, r TimeRange) ([]DeliveryCostStat, error) {
+	defer s.observe("analytics_delivery_costs_rollup", time.Now())
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT delivery_service, currency, sum(orders)::bigint, (sum(delivery_cost)::float8 / sum(orders))
+		FROM daily_order_rollups
+		WHERE `+rollupDays+`
+		GROUP BY 1, 2
+		HAVING sum(orders) > 0
+		ORDER BY 1, 2`, r.From, r.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query delivery cost rollups: %w", err)
+	}
+	return collectRows(rows, func(row pgx.CollectableRow) (DeliveryCostStat, error) {
+		var st DeliveryCostStat
+		err := row.Scan(&st.DeliveryService, &st.Currency, &st.Orders, &st.AvgCost)
+		return st, err
+	})
+}
+
+func (s *Storage) averageSaleFromRollups(ctx context.Context, r TimeRange) (SaleStat, error) {
+	defer s.observe("analytics_sales_rollup", time.Now())
+
+	var st SaleStat
+	err := s.pool.QueryRow(ctx, `
+		SELECT coalesce(sum(units), 0)::bigint,
+			   coalesce(sum(discounted_units), 0)::bigint,
+			   coalesce(sum(sale_sum)::float8 / nullif(sum(units), 0), 0),
+			   coalesce(sum(sale_sum)::float8 / nullif(sum(discounted_units), 0), 0)
+		FROM daily_brand_rollups
+		WHERE `+rollupDays, r.From, r.To).Scan(&st.Items, &st.DiscountedItems, &st.AvgSale, &st.AvgDiscountedSale)
+	if err != nil {
+		return SaleStat{}, fmt.Errorf("failed to query sale rollups: %w", err)
+	}
+	return st, nil
+}
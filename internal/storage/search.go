@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MinPhoneDigits - сколько цифр нужно для поиска по части номера телефона
+const MinPhoneDigits = 4
+
+// виды меток слепого индекса персональных данных
+const (
+	tokenWord  = "word"
+	tokenPhone = "phone"
+)
+
+// SearchQuery - подготовленный поисковый запрос. Пустые условия не применяются
+type SearchQuery struct {
+	// TSQuery - запрос полнотекстового поиска в синтаксисе to_tsquery
+	TSQuery string
+	// Pattern - подстрока для нечёткого поиска по триграммам, без символов % и _
+	Pattern string
+	// PhoneDigits - цифры номера телефона для поиска по его части
+	PhoneDigits string
+	// Words - слова запроса (см. SearchWords). Зашифрованные строки доставки ищутся по ним
+	// точным совпадением слов через слепой индекс
+	Words []string
+	// IncludePII включает поиск по персональным полям доставки
+	IncludePII bool
+	Limit      int
+	Offset     int
+}
+
+// SearchHit - найденный заказ и его релевантность
+type SearchHit struct {
+	OrderUID string
+	Rank     float64
+}
+
+// SearchOrders ищет неотменённые заказы по товарам и доставке.
+// Открытые персональные поля ищутся по префиксам слов и подстрокам, зашифрованные - через слепой индекс:
+// по целым словам имени, адреса и email и по окончанию номера телефона.
+// Релевантность заказа - сумма рангов всех совпадений, результаты идут по её убыванию
+func (s *Storage) SearchOrders(ctx context.Context, q SearchQuery) ([]SearchHit, error) {
+	defer s.observe("search_orders", time.Now())
+
+	wordTokens := []string{}
+	phoneToken := ""
+	if q.IncludePII && s.blind != nil {
+		for _, w := range q.Words {
+			wordTokens = append(wordTokens, s.blind.Token(tokenWord, w))
+		}
+		if q.PhoneDigits != "" {
+			phoneToken = s.blind.Token(tokenPhone, q.PhoneDigits)
+		}
+	}
+
+	query := `
+		WITH hits AS (
+			SELECT order_uid, ts_rank(search_vector, to_tsquery('simple', $1)) AS rank
+			FROM items
+			WHERE $1 <> '' AND search_vector @@ to_tsquery('simple', $1)
+			UNION ALL
+			SELECT order_uid, ts_rank(search_public, to_tsquery('simple', $1))
+			FROM deliveries
+			WHERE $1 <> '' AND search_public @@ to_tsquery('simple', $1)
+			UNION ALL
+			SELECT order_uid, ts_rank(search_pii, to_tsquery('simple', $1))
+			FROM deliveries
+			WHERE $4 AND $1 <> '' AND enc_key_id IS NULL AND search_pii @@ to_tsquery('simple', $1)
+			UNION ALL
+			SELECT order_uid, greatest(similarity(name, $2), similarity(brand, $2)) / 2
+			FROM items
+			WHERE $2 <> '' AND (name ILIKE '%' || $2 || '%' OR brand ILIKE '%' || $2 || '%')
+			UNION ALL
+			SELECT order_uid, similarity(city, $2) / 2
+			FROM deliveries
+			WHERE $2 <> '' AND city ILIKE '%' || $2 || '%'
+			UNION ALL
+			SELECT order_uid, greatest(similarity(name, $2), similarity(address, $2)) / 2
+			FROM deliveries
+			WHERE $4 AND $2 <> '' AND enc_key_id IS NULL AND (name ILIKE '%' || $2 || '%' OR address ILIKE '%' || $2 || '%')
+			UNION ALL
+			SELECT order_uid, 0.5
+			FROM deliveries
+			WHERE $4 AND $3 <> '' AND enc_key_id IS NULL AND regexp_replace(phone, '[^0-9]', '', 'g') LIKE '%' || $3 || '%'
+			UNION ALL
+			SELECT order_uid, 0.5
+			FROM deliveries
+			WHERE $4 AND cardinality($7::text[]) > 0 AND enc_key_id IS NOT NULL AND pii_tokens @> $7::text[]
+			UNION ALL
+			SELECT order_uid, 0.5
+			FROM deliveries
+			WHERE $4 AND $8 <> '' AND enc_key_id IS NOT NULL AND pii_tokens @> ARRAY[$8::text]
+		)
+		SELECT h.order_uid, sum(h.rank)::float8 AS rank
+		FROM hits AS h
+		JOIN orders AS o ON o.order_uid = h.order_uid
+		WHERE o.deleted_at IS NULL
+		GROUP BY h.order_uid
+		ORDER BY rank DESC, h.order_uid
+		LIMIT $5 OFFSET $6;`
+
+	rows, err := s.pool.Query(ctx, query, q.TSQuery, q.Pattern, q.PhoneDigits, q.IncludePII, q.Limit, q.Offset, wordTokens, phoneToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search orders: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []SearchHit
+	for rows.Next() {
+		var h SearchHit
+		if err := rows.Scan(&h.OrderUID, &h.Rank); err != nil {
+			return nil, fmt.Errorf("failed to scan search hit: %w", err)
+		}
+		hits = append(hits, h)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error after iterating search hits: %w", rows.Err())
+	}
+	return hits, nil
+}
+
+// PIISearchGap объясняет, почему поиск по персональным данным доставки может пропустить заказы.
+// Пустая строка означает, что ищутся все строки доставки
+func (s *Storage) PIISearchGap(ctx context.Context) (string, error) {
+	if s.keyring == nil {
+		return "", nil
+	}
+	if s.blind == nil {
+		return "encrypted delivery data is not searchable: pii_search_key is not configured", nil
+	}
+
+	var pending bool
+	err := s.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM deliveries WHERE enc_key_id IS NOT NULL AND pii_tokens IS NULL)`).Scan(&pending)
+	if err != nil {
+		return "", fmt.Errorf("failed to check blind index coverage: %w", err)
+	}
+	if pending {
+		return "some encrypted deliveries are not indexed yet, background re-encryption is still adding them", nil
+	}
+	return "", nil
+}
+
+// SearchWords разбивает строку на слова в нижнем регистре; разделителем служит всё, кроме букв и цифр.
+// Так же разбиваются и запросы, и значения, попадающие в слепой индекс
+func SearchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// PhoneDigits оставляет в строке только цифры
+func PhoneDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
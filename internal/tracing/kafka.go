@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// KafkaHeaders адаптирует заголовки Kafka-сообщения к propagation.TextMapCarrier,
+// чтобы контекст трассировки передавался от продюсера к консьюмеру
+type KafkaHeaders struct {
+	Headers *[]kafka.Header
+}
+
+var _ propagation.TextMapCarrier = KafkaHeaders{}
+
+// Get возвращает значение заголовка key
+func (c KafkaHeaders) Get(key string) string {
+	for _, h := range *c.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set заменяет или добавляет заголовок key
+func (c KafkaHeaders) Set(key, value string) {
+	for i, h := range *c.Headers {
+		if h.Key == key {
+			(*c.Headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.Headers = append(*c.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+// Keys возвращает имена всех заголовков
+func (c KafkaHeaders) Keys() []string {
+	keys := make([]string, 0, len(*c.Headers))
+	for _, h := range *c.Headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
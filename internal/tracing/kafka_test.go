@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestKafkaHeaders_Propagation(t *testing.T) {
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	parent := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	propagator := propagation.TraceContext{}
+	headers := []kafka.Header{{Key: "event-type", Value: []byte("order.created")}}
+	propagator.Inject(parent, KafkaHeaders{Headers: &headers})
+
+	require.Len(t, headers, 2, "Заголовок traceparent должен добавиться к существующим")
+
+	msg := kafka.Message{Headers: headers}
+	extracted := trace.SpanContextFromContext(propagator.Extract(context.Background(), KafkaHeaders{Headers: &msg.Headers}))
+	require.Equal(t, traceID, extracted.TraceID(), "Консьюмер должен продолжить трейс продюсера")
+	require.True(t, extracted.IsRemote())
+}
@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestInit_Stdout(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	shutdown, err := Init(context.Background(), Options{Exporter: ExporterStdout, ServiceName: "order-service-test", SampleRatio: 1})
+	require.NoError(t, err, "Ресурс сервиса должен объединяться с ресурсом SDK по умолчанию")
+	t.Cleanup(func() { require.NoError(t, shutdown(context.Background())) })
+
+	provider, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider)
+	require.True(t, ok, "Init должен установить TracerProvider SDK")
+	_, span := provider.Tracer("test").Start(context.Background(), "op")
+	defer span.End()
+	ro, ok := span.(sdktrace.ReadOnlySpan)
+	require.True(t, ok)
+	require.Contains(t, ro.Resource().Attributes(), attribute.String("service.name", "order-service-test"))
+}
+
+func TestInit_UnknownExporter(t *testing.T) {
+	_, err := Init(context.Background(), Options{Exporter: "zipkin"})
+	require.Error(t, err)
+}
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+COMMIT;
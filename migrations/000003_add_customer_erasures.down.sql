@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS customer_erasures;
+DROP INDEX IF EXISTS idx_orders_customer_id;
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders (customer_id);
+
+CREATE TABLE IF NOT EXISTS customer_erasures (
+    id SERIAL PRIMARY KEY,
+    customer_id VARCHAR(255) NOT NULL,
+    order_uids TEXT[] NOT NULL,
+    requested_by VARCHAR(255) NOT NULL,
+    erased_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+COMMIT;
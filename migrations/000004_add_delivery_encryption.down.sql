@@ -0,0 +1,14 @@
+BEGIN;
+
+-- Откат возможен только после расшифровки всех строк: шифротекст не помещается в VARCHAR(255)
+DROP INDEX IF EXISTS idx_deliveries_enc_key_id;
+
+ALTER TABLE deliveries
+    DROP COLUMN IF EXISTS enc_data_key,
+    DROP COLUMN IF EXISTS enc_key_id,
+    ALTER COLUMN name TYPE VARCHAR(255),
+    ALTER COLUMN phone TYPE VARCHAR(255),
+    ALTER COLUMN address TYPE VARCHAR(255),
+    ALTER COLUMN email TYPE VARCHAR(255);
+
+COMMIT;
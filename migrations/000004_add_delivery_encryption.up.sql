@@ -0,0 +1,13 @@
+BEGIN;
+
+ALTER TABLE deliveries
+    ALTER COLUMN name TYPE TEXT,
+    ALTER COLUMN phone TYPE TEXT,
+    ALTER COLUMN address TYPE TEXT,
+    ALTER COLUMN email TYPE TEXT,
+    ADD COLUMN IF NOT EXISTS enc_key_id VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS enc_data_key BYTEA;
+
+CREATE INDEX IF NOT EXISTS idx_deliveries_enc_key_id ON deliveries (enc_key_id);
+
+COMMIT;
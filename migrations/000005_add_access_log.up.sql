@@ -0,0 +1,16 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS access_log (
+    id BIGSERIAL PRIMARY KEY,
+    principal VARCHAR(255) NOT NULL,
+    auth_method VARCHAR(32) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    status INT NOT NULL,
+    accessed_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_log_target ON access_log (target, accessed_at);
+CREATE INDEX IF NOT EXISTS idx_access_log_principal ON access_log (principal, accessed_at);
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS idx_orders_list ON orders (date_created DESC, order_uid DESC) WHERE deleted_at IS NULL;
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_deliveries_phone_digits_trgm;
+DROP INDEX IF EXISTS idx_deliveries_address_trgm;
+DROP INDEX IF EXISTS idx_deliveries_name_trgm;
+DROP INDEX IF EXISTS idx_deliveries_city_trgm;
+DROP INDEX IF EXISTS idx_deliveries_search_pii;
+DROP INDEX IF EXISTS idx_deliveries_search_public;
+DROP INDEX IF EXISTS idx_items_brand_trgm;
+DROP INDEX IF EXISTS idx_items_name_trgm;
+DROP INDEX IF EXISTS idx_items_search;
+
+ALTER TABLE deliveries DROP COLUMN IF EXISTS search_pii, DROP COLUMN IF EXISTS search_public;
+ALTER TABLE items DROP COLUMN IF EXISTS search_vector;
+
+COMMIT;
@@ -0,0 +1,36 @@
+BEGIN;
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- конфигурация simple: заказы приходят на разных языках, поэтому слова не приводятся к основе
+ALTER TABLE items
+    ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple'::regconfig, coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('simple'::regconfig, coalesce(brand, '')), 'B')
+    ) STORED;
+
+-- персональные поля попадают в индекс, только пока строка не зашифрована
+ALTER TABLE deliveries
+    ADD COLUMN IF NOT EXISTS search_public tsvector GENERATED ALWAYS AS (
+        to_tsvector('simple'::regconfig, coalesce(city, '') || ' ' || coalesce(region, '') || ' ' || coalesce(zip, ''))
+    ) STORED,
+    ADD COLUMN IF NOT EXISTS search_pii tsvector GENERATED ALWAYS AS (
+        CASE WHEN enc_key_id IS NULL
+            THEN to_tsvector('simple'::regconfig, coalesce(name, '') || ' ' || coalesce(address, '') || ' ' || coalesce(email, ''))
+            ELSE ''::tsvector
+        END
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_items_search ON items USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_items_name_trgm ON items USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_items_brand_trgm ON items USING GIN (brand gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_deliveries_search_public ON deliveries USING GIN (search_public);
+CREATE INDEX IF NOT EXISTS idx_deliveries_search_pii ON deliveries USING GIN (search_pii) WHERE enc_key_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_deliveries_city_trgm ON deliveries USING GIN (city gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_deliveries_name_trgm ON deliveries USING GIN (name gin_trgm_ops) WHERE enc_key_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_deliveries_address_trgm ON deliveries USING GIN (address gin_trgm_ops) WHERE enc_key_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_deliveries_phone_digits_trgm ON deliveries
+    USING GIN ((regexp_replace(phone, '[^0-9]', '', 'g')) gin_trgm_ops) WHERE enc_key_id IS NULL;
+
+COMMIT;
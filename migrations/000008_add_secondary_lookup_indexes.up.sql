@@ -0,0 +1,7 @@
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS idx_orders_track_number ON orders (track_number);
+CREATE INDEX IF NOT EXISTS idx_payments_transaction ON payments (transaction);
+CREATE INDEX IF NOT EXISTS idx_items_rid ON items (rid);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS daily_brand_rollups;
+DROP TABLE IF EXISTS daily_order_rollups;
+
+COMMIT;
@@ -0,0 +1,44 @@
+BEGIN;
+
+-- суммы, а не средние: строки обновляются приращениями при сохранении и отмене заказа.
+-- Скидка не бывает отрицательной, поэтому sale_sum - это и сумма скидок товаров со скидкой
+CREATE TABLE IF NOT EXISTS daily_order_rollups (
+    day DATE NOT NULL,
+    currency VARCHAR(10) NOT NULL,
+    delivery_service VARCHAR(255) NOT NULL,
+    orders BIGINT NOT NULL,
+    revenue BIGINT NOT NULL,
+    delivery_cost BIGINT NOT NULL,
+    PRIMARY KEY (day, currency, delivery_service)
+);
+
+CREATE TABLE IF NOT EXISTS daily_brand_rollups (
+    day DATE NOT NULL,
+    brand VARCHAR(255) NOT NULL,
+    currency VARCHAR(10) NOT NULL,
+    units BIGINT NOT NULL,
+    revenue BIGINT NOT NULL,
+    sale_sum BIGINT NOT NULL,
+    discounted_units BIGINT NOT NULL,
+    PRIMARY KEY (day, brand, currency)
+);
+
+INSERT INTO daily_order_rollups (day, currency, delivery_service, orders, revenue, delivery_cost)
+SELECT (o.date_created AT TIME ZONE 'UTC')::date, p.currency, o.delivery_service,
+       count(*), sum(p.amount), sum(p.delivery_cost)
+FROM orders AS o
+JOIN payments AS p ON p.order_uid = o.order_uid
+WHERE o.deleted_at IS NULL
+GROUP BY 1, 2, 3;
+
+INSERT INTO daily_brand_rollups (day, brand, currency, units, revenue, sale_sum, discounted_units)
+SELECT (o.date_created AT TIME ZONE 'UTC')::date, i.brand, p.currency,
+       count(*), sum(i.total_price), sum(i.sale),
+       count(*) FILTER (WHERE i.sale > 0)
+FROM items AS i
+JOIN orders AS o ON o.order_uid = i.order_uid
+JOIN payments AS p ON p.order_uid = o.order_uid
+WHERE o.deleted_at IS NULL
+GROUP BY 1, 2, 3;
+
+COMMIT;
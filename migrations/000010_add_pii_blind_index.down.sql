@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_deliveries_pii_tokens_pending;
+DROP INDEX IF EXISTS idx_deliveries_pii_tokens;
+ALTER TABLE deliveries DROP COLUMN IF EXISTS pii_tokens;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- метки слепого индекса (HMAC слов имени, адреса, email и окончаний телефона) для поиска
+-- по зашифрованным строкам доставки. NULL - строка не зашифрована или метки ещё не посчитаны:
+-- их дописывает фоновое перешифрование
+ALTER TABLE deliveries ADD COLUMN IF NOT EXISTS pii_tokens TEXT[];
+
+CREATE INDEX IF NOT EXISTS idx_deliveries_pii_tokens ON deliveries USING GIN (pii_tokens) WHERE enc_key_id IS NOT NULL;
+-- строки, ещё не попавшие в индекс: поиск сообщает о неполных результатах, пока они есть
+CREATE INDEX IF NOT EXISTS idx_deliveries_pii_tokens_pending ON deliveries (id) WHERE enc_key_id IS NOT NULL AND pii_tokens IS NULL;
+
+COMMIT;
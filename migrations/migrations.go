@@ -0,0 +1,179 @@
+// Package migrations встраивает SQL-миграции схемы в бинарник и применяет их через golang-migrate
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Status - состояние схемы БД относительно встроенных миграций
+type Status struct {
+	Current uint   `json:"current"`
+	Latest  uint   `json:"latest"`
+	Dirty   bool   `json:"dirty"`
+	Pending []uint `json:"pending"`
+}
+
+// New создает мигратор для базы dsn на встроенных миграциях. Его нужно закрыть после использования
+func New(dsn string) (*migrate.Migrate, error) {
+	src, err := iofs.New(files, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedded migrations: %w", err)
+	}
+	m, err := migrate.NewWithSourceInstance("iofs", src, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrator: %w", err)
+	}
+	return m, nil
+}
+
+// Versions возвращает версии встроенных миграций по возрастанию
+func Versions() ([]uint, error) {
+	src, err := iofs.New(files, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedded migrations: %w", err)
+	}
+	defer src.Close()
+
+	v, err := src.First()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+	versions := []uint{v}
+	for {
+		v, err = src.Next(v)
+		if errors.Is(err, fs.ErrNotExist) {
+			return versions, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embedded migrations: %w", err)
+		}
+		versions = append(versions, v)
+	}
+}
+
+// Latest возвращает версию последней встроенной миграции
+func Latest() (uint, error) {
+	versions, err := Versions()
+	if err != nil {
+		return 0, err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// GetStatus сравнивает версию схемы в БД со встроенными миграциями
+func GetStatus(m *migrate.Migrate) (Status, error) {
+	versions, err := Versions()
+	if err != nil {
+		return Status{}, err
+	}
+
+	current, dirty, err := m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return Status{}, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	st := Status{Current: current, Latest: versions[len(versions)-1], Dirty: dirty, Pending: []uint{}}
+	for _, v := range versions {
+		if v > current {
+			st.Pending = append(st.Pending, v)
+		}
+	}
+	return st, nil
+}
+
+// lockKey - ключ advisory-блокировки, под которой реплики сервиса проверяют и накатывают схему
+const lockKey int64 = 0x6f72646572735f6d // "orders_m"
+
+var (
+	// ErrDirty - предыдущая миграция упала на середине, схему нужно починить вручную
+	ErrDirty = errors.New("database schema is dirty after a failed migration, fix it manually and run 'migrate force'")
+	// ErrSchemaTooNew - схема БД новее, чем поддерживает этот бинарник
+	ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+	// ErrSchemaBehind - схема БД старее бинарника, а накат миграций при старте выключен
+	ErrSchemaBehind = errors.New("database schema is behind this binary, run 'migrate up' or enable migrate_on_start")
+)
+
+// SchemaPolicy - что делать при старте со схемой, отстающей от встроенных миграций
+type SchemaPolicy struct {
+	// Apply накатывает недостающие миграции
+	Apply bool
+	// AllowPending разрешает запуск на отстающей схеме без наката; запросы к новым столбцам и таблицам будут падать
+	AllowPending bool
+}
+
+// EnsureSchema проверяет схему БД при старте сервиса и, если apply, накатывает недостающие миграции.
+// Проверка и накат выполняются под advisory-блокировкой, поэтому одновременно стартующие реплики
+// не мешают друг другу: остальные дождутся первой и увидят уже актуальную схему.
+// Запуск отклоняется, если схема грязная, новее встроенных миграций или отстаёт от них,
+// а policy не разрешает ни накат, ни работу на старой схеме
+func EnsureSchema(ctx context.Context, pool *pgxpool.Pool, dsn string, policy SchemaPolicy) (Status, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to acquire connection for migration lock: %w", err)
+	}
+	defer conn.Release()
+
+	slog.Info("Waiting for schema migration lock...")
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return Status{}, fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			slog.Error("Failed to release migration lock", "error", err)
+		}
+	}()
+
+	m, err := New(dsn)
+	if err != nil {
+		return Status{}, err
+	}
+	defer m.Close()
+
+	st, err := GetStatus(m)
+	if err != nil {
+		return Status{}, err
+	}
+	apply, err := checkStatus(st, policy)
+	if err != nil || !apply {
+		return st, err
+	}
+
+	slog.Info("Applying schema migrations", "from", st.Current, "to", st.Latest)
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return st, fmt.Errorf("failed to apply migrations: %w", err)
+	}
+	return GetStatus(m)
+}
+
+// checkStatus решает по состоянию схемы, можно ли стартовать и нужно ли накатывать миграции
+func checkStatus(st Status, policy SchemaPolicy) (apply bool, err error) {
+	switch {
+	case st.Dirty:
+		return false, fmt.Errorf("%w (version %d)", ErrDirty, st.Current)
+	case st.Current > st.Latest:
+		return false, fmt.Errorf("%w: schema version %d, latest known %d", ErrSchemaTooNew, st.Current, st.Latest)
+	case len(st.Pending) == 0:
+		slog.Info("Database schema is up to date", "version", st.Current)
+		return false, nil
+	case policy.Apply:
+		return true, nil
+	case policy.AllowPending:
+		slog.Warn("Database schema is behind this binary, starting anyway because migrate_allow_pending is set",
+			"version", st.Current, "pending", st.Pending)
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: schema version %d, pending %v", ErrSchemaBehind, st.Current, st.Pending)
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersions(t *testing.T) {
+	versions, err := Versions()
+	require.NoError(t, err)
+	require.NotEmpty(t, versions, "Миграции должны быть встроены в бинарник")
+
+	for i := 1; i < len(versions); i++ {
+		require.Greater(t, versions[i], versions[i-1], "Версии должны идти по возрастанию")
+	}
+
+	latest, err := Latest()
+	require.NoError(t, err)
+	require.Equal(t, versions[len(versions)-1], latest)
+}
+
+func TestCheckStatus(t *testing.T) {
+	behind := Status{Current: 2, Latest: 4, Pending: []uint{3, 4}}
+
+	tests := []struct {
+		name    string
+		st      Status
+		policy  SchemaPolicy
+		apply   bool
+		wantErr error
+	}{
+		{"UpToDate", Status{Current: 4, Latest: 4}, SchemaPolicy{}, false, nil},
+		{"Dirty", Status{Current: 3, Latest: 4, Dirty: true}, SchemaPolicy{Apply: true}, false, ErrDirty},
+		{"TooNew", Status{Current: 5, Latest: 4}, SchemaPolicy{Apply: true}, false, ErrSchemaTooNew},
+		{"BehindRefused", behind, SchemaPolicy{}, false, ErrSchemaBehind},
+		{"BehindApplied", behind, SchemaPolicy{Apply: true}, true, nil},
+		{"BehindAllowed", behind, SchemaPolicy{AllowPending: true}, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apply, err := checkStatus(tt.st, tt.policy)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.apply, apply)
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// счётчики сервиса, по приросту которых считается доля отклонённых сообщений
+const (
+	metricConsumed         = "service_messages_consumed_total"
+	metricValidationErrors = "service_validation_errors_total"
+)
+
+// tracker ждёт появления отправленных валидных заказов в GET /order/{uid}
+// и собирает задержки отправки и сквозные задержки
+type tracker struct {
+	client   *http.Client
+	service  string
+	apiKey   string
+	interval time.Duration
+	timeout  time.Duration
+
+	wg          sync.WaitGroup
+	mu          sync.Mutex
+	sendLatency []time.Duration
+	e2eLatency  []time.Duration
+	timedOut    int
+	pollErrors  map[string]int
+	firstSent   time.Time
+	lastVisible time.Time
+}
+
+func newTracker(opts options) *tracker {
+	return &tracker{
+		client: &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: &http.Transport{MaxIdleConnsPerHost: 100},
+		},
+		service:    strings.TrimRight(opts.service, "/"),
+		apiKey:     opts.apiKey,
+		interval:   opts.pollInterval,
+		timeout:    opts.visibilityTimeout,
+		pollErrors: map[string]int{},
+	}
+}
+
+// sent учитывает результат отправки и для валидного заказа запускает ожидание его появления.
+// Повторы и некорректные заказы не опрашиваются: первые уже видны, вторые не должны появиться
+func (t *tracker) sent(ctx context.Context, msg message, sentAt time.Time, err error) {
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.sendLatency = append(t.sendLatency, time.Since(sentAt))
+	if t.firstSent.IsZero() || sentAt.Before(t.firstSent) {
+		t.firstSent = sentAt
+	}
+	t.mu.Unlock()
+
+	if msg.kind != "valid" {
+		return
+	}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.await(ctx, msg.key, sentAt)
+	}()
+}
+
+func (t *tracker) await(ctx context.Context, orderUID string, sentAt time.Time) {
+	deadline := sentAt.Add(t.timeout)
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := t.get(ctx, orderUID)
+		now := time.Now()
+
+		t.mu.Lock()
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				t.mu.Unlock()
+				return
+			}
+			t.pollErrors["request failed"]++
+		case status == http.StatusOK:
+			t.e2eLatency = append(t.e2eLatency, now.Sub(sentAt))
+			if now.After(t.lastVisible) {
+				t.lastVisible = now
+			}
+			t.mu.Unlock()
+			return
+		case status != http.StatusNotFound:
+			t.pollErrors[fmt.Sprintf("http %d", status)]++
+		}
+		if now.After(deadline) {
+			t.timedOut++
+			t.mu.Unlock()
+			return
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (t *tracker) get(ctx context.Context, orderUID string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.service+"/order/"+url.PathEscape(orderUID), nil)
+	if err != nil {
+		return 0, err
+	}
+	if t.apiKey != "" {
+		req.Header.Set("X-API-Key", t.apiKey)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// wait дожидается завершения всех опросов
+func (t *tracker) wait() {
+	t.wg.Wait()
+}
+
+// scrapeCounters читает значения счётчиков names из ответа /metrics в текстовом формате Prometheus
+func scrapeCounters(ctx context.Context, client *http.Client, metricsURL string, names ...string) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metricsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metrics endpoint responded %s", resp.Status)
+	}
+	return parseCounters(resp.Body, names...)
+}
+
+func parseCounters(r io.Reader, names ...string) (map[string]float64, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	values := make(map[string]float64, len(names))
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, " ")
+		if !ok || !wanted[name] {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.Fields(value)[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+		values[name] = v
+	}
+	return values, sc.Err()
+}
+
+// latencySummary - перцентили задержки в миллисекундах
+type latencySummary struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean_ms"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P95   float64 `json:"p95_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+func summarize(samples []time.Duration) latencySummary {
+	if len(samples) == 0 {
+		return latencySummary{}
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	return latencySummary{
+		Count: len(sorted),
+		Mean:  ms(sum / time.Duration(len(sorted))),
+		P50:   ms(percentile(sorted, 50)),
+		P90:   ms(percentile(sorted, 90)),
+		P95:   ms(percentile(sorted, 95)),
+		P99:   ms(percentile(sorted, 99)),
+		Max:   ms(sorted[len(sorted)-1]),
+	}
+}
+
+// percentile считает перцентиль по методу ближайшего ранга, sorted должен быть отсортирован
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p/100*float64(len(sorted))+0.999999) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// loadReport - итог нагрузочного прогона
+type loadReport struct {
+	Seed              uint64         `json:"seed"`
+	Rate              float64        `json:"rate"`
+	Concurrency       int            `json:"concurrency"`
+	DurationSeconds   float64        `json:"duration_seconds"`
+	Sent              map[string]int `json:"sent"`
+	SendErrors        map[string]int `json:"send_errors"`
+	SendErrorRate     float64        `json:"send_error_rate"`
+	SendThroughput    float64        `json:"send_throughput"`
+	VisibleThroughput float64        `json:"visible_throughput"`
+	SendLatency       latencySummary `json:"send_latency"`
+	EndToEndLatency   latencySummary `json:"end_to_end_latency"`
+	Visible           int            `json:"visible"`
+	TimedOut          int            `json:"timed_out"`
+	PollErrors        map[string]int `json:"poll_errors"`
+	// доля некорректных и повторных заказов среди отправленных, то есть ожидаемая доля отклонений
+	ExpectedRejectionRatio float64 `json:"expected_rejection_ratio"`
+	// по приросту счётчиков сервиса; неразбираемый JSON сервис не считает ошибкой валидации
+	Consumed       *float64 `json:"consumed,omitempty"`
+	Rejected       *float64 `json:"rejected,omitempty"`
+	RejectionRatio *float64 `json:"rejection_ratio,omitempty"`
+}
+
+func (t *tracker) report(opts options, st *stats) loadReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	r := loadReport{
+		Seed:            opts.seed,
+		Rate:            opts.rate,
+		Concurrency:     opts.concurrency,
+		DurationSeconds: st.elapsed.Seconds(),
+		Sent:            st.sent,
+		SendErrors:      st.errors,
+		SendLatency:     summarize(t.sendLatency),
+		EndToEndLatency: summarize(t.e2eLatency),
+		Visible:         len(t.e2eLatency),
+		TimedOut:        t.timedOut,
+		PollErrors:      t.pollErrors,
+	}
+
+	sent, failed, rejected := 0, 0, 0
+	for kind, n := range st.sent {
+		sent += n
+		if kind != "valid" {
+			rejected += n
+		}
+	}
+	for _, n := range st.errors {
+		failed += n
+	}
+	if sent+failed > 0 {
+		r.SendErrorRate = float64(failed) / float64(sent+failed)
+	}
+	if sent > 0 {
+		r.ExpectedRejectionRatio = float64(rejected) / float64(sent)
+	}
+	if st.elapsed > 0 {
+		r.SendThroughput = float64(sent) / st.elapsed.Seconds()
+	}
+	if window := t.lastVisible.Sub(t.firstSent); r.Visible > 0 && window > 0 {
+		r.VisibleThroughput = float64(r.Visible) / window.Seconds()
+	}
+	return r
+}
+
+// measureRejections дожидается, пока сервис вычитает все отправленные сообщения, и заполняет
+// в отчёте долю отклонённых. before - значения счётчиков до начала прогона
+func (t *tracker) measureRejections(ctx context.Context, metricsURL string, before map[string]float64, r *loadReport) {
+	expected := 0
+	for _, n := range r.Sent {
+		expected += n
+	}
+
+	deadline := time.Now().Add(t.timeout)
+	var after map[string]float64
+	for {
+		var err error
+		after, err = scrapeCounters(ctx, t.client, metricsURL, metricConsumed, metricValidationErrors)
+		if err != nil {
+			log.Printf("Failed to scrape service metrics: %v", err)
+			return
+		}
+		if after[metricConsumed]-before[metricConsumed] >= float64(expected) || time.Now().After(deadline) {
+			break
+		}
+		select {
+		case <-time.After(t.interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	consumed := after[metricConsumed] - before[metricConsumed]
+	rejected := after[metricValidationErrors] - before[metricValidationErrors]
+	r.Consumed, r.Rejected = &consumed, &rejected
+	if consumed > 0 {
+		ratio := rejected / consumed
+		r.RejectionRatio = &ratio
+	}
+}
+
+func (r loadReport) print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "duration\t%.2fs\n", r.DurationSeconds)
+	fmt.Fprintf(tw, "send throughput\t%.1f msg/s\n", r.SendThroughput)
+	fmt.Fprintf(tw, "visible throughput\t%.1f orders/s\n", r.VisibleThroughput)
+	fmt.Fprintf(tw, "send error rate\t%.2f%%\n", r.SendErrorRate*100)
+	fmt.Fprintf(tw, "visible / timed out\t%d / %d\n", r.Visible, r.TimedOut)
+	for _, kind := range sortedKeys(r.PollErrors) {
+		fmt.Fprintf(tw, "poll errors (%s)\t%d\n", kind, r.PollErrors[kind])
+	}
+	fmt.Fprintf(tw, "expected rejection ratio\t%.2f%%\n", r.ExpectedRejectionRatio*100)
+	if r.RejectionRatio != nil {
+		fmt.Fprintf(tw, "observed rejection ratio\t%.2f%% (%.0f of %.0f)\n", *r.RejectionRatio*100, *r.Rejected, *r.Consumed)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "latency, ms\tcount\tmean\tp50\tp90\tp95\tp99\tmax")
+	for _, row := range []struct {
+		name string
+		s    latencySummary
+	}{{"send", r.SendLatency}, {"end-to-end", r.EndToEndLatency}} {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\n",
+			row.name, row.s.Count, row.s.Mean, row.s.P50, row.s.P90, row.s.P95, row.s.P99, row.s.Max)
+	}
+	tw.Flush()
+}
+
+func (r loadReport) writeFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
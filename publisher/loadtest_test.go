@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarize(t *testing.T) {
+	var samples []time.Duration
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+
+	s := summarize(samples)
+	require.Equal(t, 100, s.Count)
+	require.Equal(t, 50.0, s.P50, "p50 из 1..100 мс")
+	require.Equal(t, 99.0, s.P99, "p99 из 1..100 мс")
+	require.Equal(t, 100.0, s.Max)
+	require.Equal(t, 50.5, s.Mean)
+	require.Equal(t, 100*time.Millisecond, samples[0], "исходный срез не должен сортироваться")
+
+	require.Equal(t, latencySummary{}, summarize(nil), "пустая выборка")
+}
+
+func TestParseCounters(t *testing.T) {
+	body := `# HELP service_messages_consumed_total Total messages consumed.
+# TYPE service_messages_consumed_total counter
+service_messages_consumed_total 1234
+service_validation_errors_total 5.0
+service_cache_hits_total 99
+`
+	values, err := parseCounters(strings.NewReader(body), metricConsumed, metricValidationErrors)
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{metricConsumed: 1234, metricValidationErrors: 5}, values)
+}
@@ -1,181 +1,301 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	"test_task_wb/internal/model"
+	"test_task_wb/internal/fakeorder"
 
-	"github.com/brianvoe/gofakeit/v7"
 	"github.com/segmentio/kafka-go"
 )
 
-const (
-	kafkaBroker = "localhost:9092"
-	topic       = "orders"
-)
+// options - параметры запуска паблишера
+type options struct {
+	brokers     []string
+	topic       string
+	mode        string
+	file        string
+	rate        float64
+	burst       int
+	count       int
+	concurrency int
+	seed        uint64
+	timeout     time.Duration
+	mix         mix
+	headers     headerList
+	fromLine    int
+	locales     []string
+	minItems    int
+	maxItems    int
 
-func randomRussianPhone() string {
-	operatorCode := gofakeit.Number(900, 999)
-	numberPart := fmt.Sprintf("%07d", gofakeit.Number(0, 9999999))
-	return fmt.Sprintf("+7%d%s", operatorCode, numberPart)
+	// параметры режима loadtest
+	service           string
+	apiKey            string
+	metricsURL        string
+	pollInterval      time.Duration
+	visibilityTimeout time.Duration
+	reportPath        string
 }
 
-// generateRandomOrder создает случайный, но валидный заказ,
-// опираясь на правила валидации из структуры model.Order
-func generateRandomOrder() (model.Order, error) {
-	gofakeit.Seed(time.Now().UnixNano())
-
-	orderUID := gofakeit.Password(true, false, true, false, false, 20)
-	trackNumber := "WBILM" + gofakeit.Password(false, true, false, false, false, 10)
-
-	var items []model.Item
-	for i := 0; i < gofakeit.Number(1, 5); i++ {
-		item := model.Item{
-			ChrtID:      gofakeit.Number(1000000, 9999999),
-			TrackNumber: trackNumber,
-			Price:       gofakeit.Number(100, 5000),
-			Rid:         gofakeit.Password(true, false, true, false, false, 21),
-			Name:        gofakeit.ProductName(),
-			Sale:        gofakeit.Number(0, 70),
-			Size:        "0",
-			TotalPrice:  gofakeit.Number(100, 5000),
-			NmID:        gofakeit.Number(1000000, 9999999),
-			Brand:       gofakeit.Company(),
-			Status:      202,
+func parseFlags(args []string) (options, error) {
+	var (
+		opts    options
+		brokers string
+		locales string
+		seed    int64
+	)
+
+	fs := flag.NewFlagSet("publisher", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: publisher [flags]")
+		fmt.Fprintln(fs.Output(), "  auto:     publisher -rate 5 -count 100")
+		fmt.Fprintln(fs.Output(), "  scenario: publisher -mode scenario -valid 8 -invalid 1 -duplicate 1 -rate 200 -concurrency 4")
+		fmt.Fprintln(fs.Output(), "  file:     publisher -mode file -file valid_order.json")
+		fmt.Fprintln(fs.Output(), "  replay:   publisher -mode replay -file orders.ndjson -rate 100 -header source=replay -from-line 1200")
+		fmt.Fprintln(fs.Output(), "  loadtest: publisher -mode loadtest -rate 500 -count 10000 -concurrency 8 -service http://localhost:8081 -metrics http://localhost:9091/metrics")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&brokers, "brokers", envOr("KAFKA_BROKERS", "localhost:9092"), "comma-separated list of Kafka brokers")
+	fs.StringVar(&opts.topic, "topic", envOr("KAFKA_TOPIC", "orders"), "topic to publish to")
+	fs.StringVar(&opts.mode, "mode", "auto", "auto (valid orders only), scenario (mix of valid, invalid and duplicate orders), loadtest (scenario with a latency report), replay (records of a JSON lines or JSON array file) or file (whole file as one message)")
+	fs.StringVar(&opts.file, "file", "", "input file for the file and replay modes, - for stdin in the replay mode")
+	fs.Var(&opts.headers, "header", "key=value header added to every replayed record, can be repeated")
+	fs.IntVar(&opts.fromLine, "from-line", 1, "skip records that start before this line in the replay mode")
+	fs.Float64Var(&opts.rate, "rate", 0.1, "messages per second, 0 means unlimited")
+	fs.IntVar(&opts.burst, "burst", 1, "maximum burst above the rate")
+	fs.IntVar(&opts.count, "count", 0, "total number of messages, 0 means until interrupted (1 in the file mode)")
+	fs.IntVar(&opts.concurrency, "concurrency", 1, "number of concurrent writers")
+	fs.Int64Var(&seed, "seed", 0, "seed for the order generator, 0 means random")
+	fs.StringVar(&locales, "locales", "en", "comma-separated locales of generated orders: "+strings.Join(fakeorder.Locales(), ", "))
+	fs.IntVar(&opts.minItems, "min-items", 1, "minimum number of items in a generated order")
+	fs.IntVar(&opts.maxItems, "max-items", 5, "maximum number of items in a generated order")
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Second, "timeout for a single write")
+	fs.Float64Var(&opts.mix.valid, "valid", 1, "share of valid orders in the scenario mode")
+	fs.Float64Var(&opts.mix.invalid, "invalid", 0, "share of invalid orders in the scenario mode")
+	fs.Float64Var(&opts.mix.duplicate, "duplicate", 0, "share of re-sent orders in the scenario mode")
+	fs.StringVar(&opts.service, "service", "", "base URL of the order service polled in the loadtest mode")
+	fs.StringVar(&opts.apiKey, "api-key", os.Getenv("ORDER_SERVICE_API_KEY"), "API key with the read scope for the loadtest mode")
+	fs.StringVar(&opts.metricsURL, "metrics", "", "URL of the service /metrics endpoint used to count rejected messages, empty to skip")
+	fs.DurationVar(&opts.pollInterval, "poll-interval", 50*time.Millisecond, "interval between polls of a sent order")
+	fs.DurationVar(&opts.visibilityTimeout, "visibility-timeout", 30*time.Second, "how long to wait for a sent order to become visible")
+	fs.StringVar(&opts.reportPath, "report", "loadtest-report.json", "file for the JSON report of the loadtest mode")
+
+	if err := fs.Parse(args); err != nil {
+		return options{}, err
+	}
+
+	opts.brokers = splitList(brokers)
+	opts.locales = splitList(locales)
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	opts.seed = uint64(seed)
+
+	var errs []error
+	if len(opts.brokers) == 0 {
+		errs = append(errs, errors.New("-brokers must not be empty"))
+	}
+	if opts.topic == "" {
+		errs = append(errs, errors.New("-topic must not be empty"))
+	}
+	switch opts.mode {
+	case "auto":
+		opts.mix = mix{valid: 1}
+	case "scenario":
+		if err := opts.mix.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	case "loadtest":
+		if err := opts.mix.validate(); err != nil {
+			errs = append(errs, err)
+		}
+		if opts.service == "" {
+			errs = append(errs, errors.New("-service is required in the loadtest mode"))
+		}
+		// без ограничения прогон заканчивается по Ctrl+C, и ожидание отправленных заказов прерывается
+		if opts.count == 0 {
+			errs = append(errs, errors.New("-count is required in the loadtest mode"))
+		}
+		if opts.pollInterval <= 0 || opts.visibilityTimeout <= 0 {
+			errs = append(errs, errors.New("-poll-interval and -visibility-timeout must be positive"))
+		}
+	case "replay":
+		if opts.file == "" {
+			errs = append(errs, errors.New("-file is required in the replay mode"))
+		}
+		// записи отправляются по одной, иначе порядок файла не сохранится
+		if opts.concurrency != 1 {
+			errs = append(errs, errors.New("-concurrency is not supported in the replay mode"))
+		}
+		if opts.fromLine < 1 {
+			errs = append(errs, errors.New("-from-line must be at least 1"))
+		}
+	case "file":
+		if opts.file == "" {
+			errs = append(errs, errors.New("-file is required in the file mode"))
 		}
-		items = append(items, item)
-	}
-
-	order := model.Order{
-		OrderUID:    orderUID,
-		TrackNumber: trackNumber,
-		Entry:       "WBIL",
-		Delivery: model.Delivery{
-			Name:    gofakeit.Name(),
-			Phone:   randomRussianPhone(),
-			Zip:     gofakeit.Zip(),
-			City:    gofakeit.City(),
-			Address: gofakeit.StreetName() + " " + gofakeit.StreetNumber(),
-			Region:  gofakeit.State(),
-			Email:   gofakeit.Email(),
-		},
-		Payment: model.Payment{
-			Transaction:  orderUID,
-			RequestID:    "",
-			Currency:     gofakeit.CurrencyShort(),
-			Provider:     "wbpay",
-			Amount:       gofakeit.Number(1000, 10000),
-			PaymentDt:    time.Now().Unix(),
-			Bank:         gofakeit.BS(),
-			DeliveryCost: gofakeit.Number(300, 1500),
-			GoodsTotal:   gofakeit.Number(500, 8000),
-			CustomFee:    0,
-		},
-		Items:             items,
-		Locale:            "en",
-		InternalSignature: "",
-		CustomerID:        "test",
-		DeliveryService:   "meest",
-		Shardkey:          fmt.Sprintf("%d", gofakeit.Number(1, 10)),
-		SmID:              gofakeit.Number(1, 100),
-		DateCreated:       time.Now(),
-		OofShard:          fmt.Sprintf("%d", gofakeit.Number(1, 10)),
-	}
-
-	return order, nil
+		if opts.count == 0 {
+			opts.count = 1
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown -mode %q, expected auto, scenario, loadtest, replay or file", opts.mode))
+	}
+	if opts.rate < 0 {
+		errs = append(errs, errors.New("-rate must not be negative"))
+	}
+	if opts.burst < 1 {
+		errs = append(errs, errors.New("-burst must be at least 1"))
+	}
+	if opts.count < 0 {
+		errs = append(errs, errors.New("-count must not be negative"))
+	}
+	if opts.concurrency < 1 {
+		errs = append(errs, errors.New("-concurrency must be at least 1"))
+	}
+	return opts, errors.Join(errs...)
 }
 
-// runAutoMode запускает режим автоматической отправки сообщений каждые 10 секунд
-func runAutoMode(writer *kafka.Writer) {
-	log.Println("Starting auto-generation mode. New message every 10 seconds.")
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func main() {
+	opts, err := parseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Printf("Invalid flags:\n%v", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// ключом сообщения служит order_uid, поэтому Hash отправляет повторы заказа в ту же партицию
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(opts.brokers...),
+		Topic:        opts.topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond,
+		Async:        false,
+	}
+	defer writer.Close()
+
+	if opts.mode == "replay" {
+		runReplay(ctx, writer, opts)
+		return
+	}
 
-	for range ticker.C {
-		order, err := generateRandomOrder()
+	var src source
+	if opts.mode == "file" {
+		src, err = newFileSource(opts.file)
 		if err != nil {
-			log.Printf("Error generating random order: %v", err)
-			continue
+			log.Fatalf("Failed to read file %s: %v", opts.file, err)
 		}
-
-		messageBytes, err := json.Marshal(order)
+	} else {
+		gen, err := fakeorder.New(
+			fakeorder.WithSeed(opts.seed),
+			fakeorder.WithLocales(opts.locales...),
+			fakeorder.WithItems(opts.minItems, opts.maxItems),
+		)
 		if err != nil {
-			log.Printf("Error marshalling order to JSON: %v", err)
-			continue
+			log.Printf("Invalid flags:\n%v", err)
+			os.Exit(2)
 		}
+		// в режиме auto mix уже сведён к одним валидным заказам
+		src = newScenario(gen, opts.mix)
+	}
+
+	log.Printf("Publishing to %s on %s: mode=%s rate=%g burst=%d count=%d concurrency=%d seed=%d",
+		opts.topic, strings.Join(opts.brokers, ","), opts.mode, opts.rate, opts.burst, opts.count, opts.concurrency, opts.seed)
+
+	if opts.mode == "loadtest" {
+		runLoadTest(ctx, writer, src, opts)
+		return
+	}
 
-		sendMessage(writer, messageBytes, fmt.Sprintf("random order %s", order.OrderUID))
+	st := publish(ctx, writer, src, opts, nil)
+	st.print()
+	if st.failed() > 0 {
+		os.Exit(1)
 	}
 }
 
-// runFileMode запускает режим отправки сообщения из файла
-func runFileMode(writer *kafka.Writer) {
-	if len(os.Args) < 2 {
-		log.Fatalf("Usage in file mode: go run main.go <json_file_name>")
+// runReplay воспроизводит дамп заказов из файла или stdin
+func runReplay(ctx context.Context, writer *kafka.Writer, opts options) {
+	in := os.Stdin
+	if opts.file != "-" {
+		f, err := os.Open(opts.file)
+		if err != nil {
+			log.Fatalf("Failed to open file %s: %v", opts.file, err)
+		}
+		defer f.Close()
+		in = f
 	}
-	filePath := os.Args[1]
-	log.Printf("Starting file mode. Reading from: %s", filePath)
 
-	messageBytes, err := os.ReadFile(filePath)
+	src, err := newReplaySource(in, opts.headers)
 	if err != nil {
-		log.Fatalf("Failed to read file %s: %v", filePath, err)
+		log.Fatalf("Failed to read file %s: %v", opts.file, err)
 	}
 
-	sendMessage(writer, messageBytes, fmt.Sprintf("file %s", filePath))
-}
-
-// sendMessage — общая функция для отправки сообщения в Kafka
-func sendMessage(writer *kafka.Writer, messageValue []byte, messageSource string) {
-	msg := kafka.Message{
-		Value: messageValue,
+	log.Printf("Replaying %s to %s from line %d", opts.file, opts.topic, opts.fromLine)
+	st, err := replay(ctx, writer, src, opts)
+	st.print()
+	if err != nil {
+		log.Printf("Replay failed: %v", err)
+		writer.Close()
+		os.Exit(1)
 	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// runLoadTest публикует заказы, дожидается их появления в сервисе и печатает отчёт
+func runLoadTest(ctx context.Context, writer *kafka.Writer, src source, opts options) {
+	tr := newTracker(opts)
 
-	log.Printf("Sending message from %s to topic: %s", messageSource, topic)
-	err := writer.WriteMessages(ctx, msg)
-	if err != nil {
-		log.Printf("Failed to send message to Kafka: %v", err)
-		return
+	var before map[string]float64
+	if opts.metricsURL != "" {
+		var err error
+		before, err = scrapeCounters(ctx, tr.client, opts.metricsURL, metricConsumed, metricValidationErrors)
+		if err != nil {
+			log.Fatalf("Failed to scrape service metrics: %v", err)
+		}
 	}
 
-	log.Println("Message sent successfully!")
-}
+	st := publish(ctx, writer, src, opts, tr)
+	log.Printf("Sent %d messages, waiting for orders to become visible", st.total())
+	tr.wait()
 
-func main() {
-	writer := &kafka.Writer{
-		Addr:         kafka.TCP(kafkaBroker),
-		Topic:        topic,
-		Balancer:     &kafka.LeastBytes{},
-		RequiredAcks: kafka.RequireAll,
-		Async:        false,
+	report := tr.report(opts, st)
+	if before != nil {
+		tr.measureRejections(ctx, opts.metricsURL, before, &report)
 	}
-	defer writer.Close()
 
-	fmt.Println("Select publisher mode:")
-	fmt.Println("1: Auto-generate and send a random message every 10 seconds")
-	fmt.Println("2: Send a message from a specified file")
-	fmt.Print("Enter mode (1 or 2): ")
-
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
-	mode := strings.TrimSpace(scanner.Text())
-
-	switch mode {
-	case "1":
-		os.Args = os.Args[:1]
-		runAutoMode(writer)
-	case "2":
-		runFileMode(writer)
-	default:
-		log.Fatalf("Invalid mode selected. Please enter '1' or '2'.")
+	report.print(os.Stdout)
+	if err := report.writeFile(opts.reportPath); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
 	}
+	log.Printf("Report written to %s", opts.reportPath)
 }
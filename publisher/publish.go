@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"golang.org/x/time/rate"
+)
+
+// publish генерирует сообщения в одной горутине, чтобы последовательность зависела только от seed,
+// и раздаёт их воркерам. Темп задаёт token bucket с параметрами -rate и -burst.
+// Если tr не nil, ему передаётся результат каждой отправки
+func publish(ctx context.Context, writer *kafka.Writer, src source, opts options, tr *tracker) *stats {
+	limit := rate.Inf
+	if opts.rate > 0 {
+		limit = rate.Limit(opts.rate)
+	}
+	limiter := rate.NewLimiter(limit, opts.burst)
+
+	st := newStats()
+	jobs := make(chan message, opts.concurrency)
+
+	var wg sync.WaitGroup
+	for range opts.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range jobs {
+				sentAt, err := send(writer, msg, opts.timeout)
+				st.record(msg.kind, err)
+				if tr != nil {
+					tr.sent(ctx, msg, sentAt, err)
+				}
+			}
+		}()
+	}
+
+	for n := 0; opts.count == 0 || n < opts.count; n++ {
+		if err := limiter.Wait(ctx); err != nil {
+			break
+		}
+		msg, err := src.next()
+		if err != nil {
+			log.Printf("Error generating message: %v", err)
+			continue
+		}
+		select {
+		case jobs <- msg:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	st.finish()
+	return st
+}
+
+// send отправляет одно сообщение. Отправка не прерывается по Ctrl+C, а ограничена таймаутом,
+// чтобы уже взятые воркерами сообщения не терялись при остановке.
+// Время отправки передаётся в заголовке sent_at и возвращается для подсчёта задержек
+func send(writer *kafka.Writer, msg message, timeout time.Duration) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	sentAt := time.Now()
+	headers := make([]kafka.Header, 0, len(msg.headers)+1)
+	headers = append(headers, msg.headers...)
+	km := kafka.Message{
+		Value:   msg.value,
+		Headers: append(headers, kafka.Header{Key: "sent_at", Value: []byte(sentAt.Format(time.RFC3339Nano))}),
+	}
+	if msg.key != "" {
+		km.Key = []byte(msg.key)
+	}
+	if err := writer.WriteMessages(ctx, km); err != nil {
+		log.Printf("Failed to send %s message %q: %v", msg.kind, msg.key, err)
+		return sentAt, err
+	}
+	return sentAt, nil
+}
+
+// stats - счётчики отправленных и неотправленных сообщений по видам
+type stats struct {
+	mu      sync.Mutex
+	started time.Time
+	elapsed time.Duration
+	sent    map[string]int
+	errors  map[string]int
+}
+
+func newStats() *stats {
+	return &stats{started: time.Now(), sent: map[string]int{}, errors: map[string]int{}}
+}
+
+func (s *stats) record(kind string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errors[kind]++
+		return
+	}
+	s.sent[kind]++
+}
+
+func (s *stats) finish() {
+	s.elapsed = time.Since(s.started)
+}
+
+func (s *stats) total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for _, n := range s.sent {
+		total += n
+	}
+	return total
+}
+
+func (s *stats) failed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for _, n := range s.errors {
+		total += n
+	}
+	return total
+}
+
+func (s *stats) print() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kinds := make(map[string]struct{}, len(s.sent)+len(s.errors))
+	total, failed := 0, 0
+	for kind, n := range s.sent {
+		kinds[kind] = struct{}{}
+		total += n
+	}
+	for kind, n := range s.errors {
+		kinds[kind] = struct{}{}
+		failed += n
+	}
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Strings(names)
+
+	perSecond := 0.0
+	if s.elapsed > 0 {
+		perSecond = float64(total) / s.elapsed.Seconds()
+	}
+	log.Printf("Done in %s: sent=%d failed=%d (%.1f msg/s)", s.elapsed.Round(time.Millisecond), total, failed, perSecond)
+	for _, kind := range names {
+		log.Printf("  %-24s sent=%d failed=%d", kind, s.sent[kind], s.errors[kind])
+	}
+}
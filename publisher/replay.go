@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+	"golang.org/x/time/rate"
+)
+
+// headerList - значение флага -header, который можно указать несколько раз
+type headerList []kafka.Header
+
+func (h *headerList) String() string {
+	parts := make([]string, len(*h))
+	for i, header := range *h {
+		parts[i] = header.Key + "=" + string(header.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (h *headerList) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("header %q must look like key=value", s)
+	}
+	*h = append(*h, kafka.Header{Key: key, Value: []byte(value)})
+	return nil
+}
+
+// lineReader считает переводы строк в прочитанных данных, чтобы по смещению
+// от начала файла определить номер строки, с которой начинается запись
+type lineReader struct {
+	r        io.Reader
+	offset   int64
+	newlines []int64
+	line     int
+}
+
+func (lr *lineReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			lr.newlines = append(lr.newlines, lr.offset+int64(i))
+		}
+	}
+	lr.offset += int64(n)
+	return n, err
+}
+
+// lineAt возвращает номер строки (с 1) для смещения offset. Смещения должны возрастать
+func (lr *lineReader) lineAt(offset int64) int {
+	for len(lr.newlines) > 0 && lr.newlines[0] < offset {
+		lr.newlines = lr.newlines[1:]
+		lr.line++
+	}
+	return lr.line + 1
+}
+
+// replaySource читает дамп заказов: JSON-массив, JSON lines или просто идущие подряд объекты.
+// Записи отправляются как есть, ключом служит order_uid
+type replaySource struct {
+	lr      *lineReader
+	dec     *json.Decoder
+	array   bool
+	headers []kafka.Header
+}
+
+func newReplaySource(r io.Reader, headers []kafka.Header) (*replaySource, error) {
+	lr := &lineReader{r: r}
+	br := bufio.NewReader(lr)
+	first, err := peekNonSpace(br)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	// peekNonSpace ничего не вычитывает, поэтому смещения декодера совпадают с позициями в файле
+	src := &replaySource{lr: lr, dec: json.NewDecoder(br), headers: headers}
+	if first == '[' {
+		if _, err := src.dec.Token(); err != nil {
+			return nil, err
+		}
+		src.array = true
+	}
+	return src, nil
+}
+
+// next возвращает следующую запись с номером строки, на которой она начинается, либо io.EOF
+func (s *replaySource) next() (message, error) {
+	if s.array && !s.dec.More() {
+		return message{}, io.EOF
+	}
+
+	var raw json.RawMessage
+	if err := s.dec.Decode(&raw); err != nil {
+		if errors.Is(err, io.EOF) && !s.array {
+			return message{}, io.EOF
+		}
+		return message{}, fmt.Errorf("failed to decode record after line %d: %w", s.lr.lineAt(s.dec.InputOffset()), err)
+	}
+	line := s.lr.lineAt(s.dec.InputOffset() - int64(len(raw)))
+
+	var head struct {
+		OrderUID string `json:"order_uid"`
+	}
+	_ = json.Unmarshal(raw, &head)
+
+	return message{key: head.OrderUID, value: raw, kind: "replay", line: line, headers: s.headers}, nil
+}
+
+// peekNonSpace возвращает первый непробельный символ, не продвигая r
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for n := 1; ; n++ {
+		buf, err := r.Peek(n)
+		if len(buf) < n {
+			return 0, err
+		}
+		switch b := buf[n-1]; b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		default:
+			return b, nil
+		}
+	}
+}
+
+// replay отправляет записи по одной, сохраняя порядок файла. Записи до строки -from-line пропускаются.
+// При первой неудачной отправке воспроизведение останавливается с номером строки, с которой его можно продолжить
+func replay(ctx context.Context, writer *kafka.Writer, src *replaySource, opts options) (*stats, error) {
+	limit := rate.Inf
+	if opts.rate > 0 {
+		limit = rate.Limit(opts.rate)
+	}
+	limiter := rate.NewLimiter(limit, opts.burst)
+	st := newStats()
+	defer st.finish()
+
+	for sent := 0; opts.count == 0 || sent < opts.count; {
+		msg, err := src.next()
+		if errors.Is(err, io.EOF) {
+			return st, nil
+		}
+		if err != nil {
+			return st, err
+		}
+		if msg.line < opts.fromLine {
+			continue
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			log.Printf("Replay interrupted, resume with -from-line %d", msg.line)
+			return st, nil
+		}
+		_, err = send(writer, msg, opts.timeout)
+		st.record(msg.kind, err)
+		if err != nil {
+			return st, fmt.Errorf("replay stopped at line %d, resume with -from-line %d: %w", msg.line, msg.line, err)
+		}
+		sent++
+	}
+	return st, nil
+}
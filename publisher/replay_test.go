@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+// readAll возвращает ключи и строки всех записей источника
+func readAll(t *testing.T, src *replaySource) (keys []string, lines []int) {
+	t.Helper()
+	for {
+		msg, err := src.next()
+		if errors.Is(err, io.EOF) {
+			return keys, lines
+		}
+		require.NoError(t, err)
+		keys = append(keys, msg.key)
+		lines = append(lines, msg.line)
+	}
+}
+
+func TestReplaySource(t *testing.T) {
+	t.Run("JSON lines", func(t *testing.T) {
+		input := "{\"order_uid\":\"a1\"}\n\n{\"order_uid\":\"b2\"}\n{\"order_uid\":\"c3\"}\n"
+		src, err := newReplaySource(strings.NewReader(input), nil)
+		require.NoError(t, err)
+
+		keys, lines := readAll(t, src)
+		require.Equal(t, []string{"a1", "b2", "c3"}, keys, "ключом должен быть order_uid")
+		require.Equal(t, []int{1, 3, 4}, lines, "номер строки учитывает пустые строки")
+	})
+
+	t.Run("JSON array with pretty-printed records", func(t *testing.T) {
+		input := "[\n  {\n    \"order_uid\": \"a1\"\n  },\n  {\n    \"order_uid\": \"b2\"\n  }\n]\n"
+		headers := []kafka.Header{{Key: "source", Value: []byte("dump")}}
+		src, err := newReplaySource(strings.NewReader(input), headers)
+		require.NoError(t, err)
+
+		msg, err := src.next()
+		require.NoError(t, err)
+		require.JSONEq(t, `{"order_uid":"a1"}`, string(msg.value), "запись отправляется как есть")
+		require.Equal(t, headers, msg.headers)
+
+		keys, lines := readAll(t, src)
+		require.Equal(t, []string{"b2"}, keys)
+		require.Equal(t, []int{5}, lines, "запись начинается со строки открывающей скобки")
+	})
+
+	t.Run("Broken record reports its line", func(t *testing.T) {
+		src, err := newReplaySource(strings.NewReader("{\"order_uid\":\"a1\"}\n{\"order_uid\":\n"), nil)
+		require.NoError(t, err)
+
+		_, err = src.next()
+		require.NoError(t, err)
+		_, err = src.next()
+		require.ErrorContains(t, err, "after line 1", "ошибка указывает, после какой строки файл перестал разбираться")
+	})
+}
+
+func TestHeaderList(t *testing.T) {
+	var h headerList
+	require.NoError(t, h.Set("source=replay"))
+	require.NoError(t, h.Set("trace=a=b"))
+	require.Error(t, h.Set("no-value"), "заголовок без = должен отклоняться")
+	require.Equal(t, "source=replay,trace=a=b", h.String())
+}
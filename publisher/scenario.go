@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+
+	"test_task_wb/internal/fakeorder"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// maxRecent - сколько последних валидных заказов хранится для повторной отправки
+const maxRecent = 1000
+
+// message - одно сообщение для отправки и его вид для статистики
+type message struct {
+	key     string
+	value   []byte
+	kind    string
+	headers []kafka.Header
+	// line - строка файла, с которой начинается запись, в режиме replay
+	line int
+}
+
+// source выдаёт сообщения по одному. Вызывается из одной горутины
+type source interface {
+	next() (message, error)
+}
+
+// mix - доли валидных, некорректных и повторных заказов в сценарии
+type mix struct {
+	valid     float64
+	invalid   float64
+	duplicate float64
+}
+
+func (m mix) validate() error {
+	if m.valid < 0 || m.invalid < 0 || m.duplicate < 0 {
+		return errors.New("-valid, -invalid and -duplicate must not be negative")
+	}
+	if m.valid+m.invalid+m.duplicate == 0 {
+		return errors.New("at least one of -valid, -invalid and -duplicate must be positive")
+	}
+	return nil
+}
+
+// scenario генерирует заказы в заданной пропорции. Повтор отправляет уже
+// отправленный валидный заказ без изменений, как это сделал бы ретрай продюсера
+type scenario struct {
+	gen       *fakeorder.Generator
+	rnd       *rand.Rand
+	mix       mix
+	mutations []fakeorder.Mutation
+	recent    []message
+}
+
+// newScenario создает сценарий; выбор вида сообщения и мутации тоже зависит только от seed генератора
+func newScenario(gen *fakeorder.Generator, m mix) *scenario {
+	return &scenario{
+		gen:       gen,
+		rnd:       rand.New(rand.NewPCG(gen.Seed(), 0)),
+		mix:       m,
+		mutations: fakeorder.ValidationMutations(),
+	}
+}
+
+func (s *scenario) next() (message, error) {
+	p := s.rnd.Float64() * (s.mix.valid + s.mix.invalid + s.mix.duplicate)
+	switch {
+	case p < s.mix.duplicate && len(s.recent) > 0:
+		msg := s.recent[s.rnd.IntN(len(s.recent))]
+		msg.kind = "duplicate"
+		return msg, nil
+	case p >= s.mix.duplicate && p < s.mix.duplicate+s.mix.invalid:
+		return s.invalid()
+	}
+
+	// валидный заказ, в том числе вместо повтора, пока повторять ещё нечего
+	order := s.gen.Order()
+	value, err := json.Marshal(order)
+	if err != nil {
+		return message{}, fmt.Errorf("failed to marshal order: %w", err)
+	}
+	msg := message{key: order.OrderUID, value: value, kind: "valid"}
+	if len(s.recent) < maxRecent {
+		s.recent = append(s.recent, msg)
+	} else {
+		s.recent[s.rnd.IntN(maxRecent)] = msg
+	}
+	return msg, nil
+}
+
+// invalid портит заказ одной из мутаций валидации либо обрезает JSON.
+// Ключом остаётся UID исходного заказа, чтобы сообщение было куда отнести в логах
+func (s *scenario) invalid() (message, error) {
+	order := s.gen.Order()
+	key := order.OrderUID
+
+	n := s.rnd.IntN(len(s.mutations) + 1)
+	if n == len(s.mutations) {
+		value, err := json.Marshal(order)
+		if err != nil {
+			return message{}, fmt.Errorf("failed to marshal order: %w", err)
+		}
+		return message{key: key, value: value[:len(value)/2], kind: "invalid/malformed_json"}, nil
+	}
+
+	m := s.mutations[n]
+	m.Apply(&order)
+	value, err := json.Marshal(order)
+	if err != nil {
+		return message{}, fmt.Errorf("failed to marshal order: %w", err)
+	}
+	return message{key: key, value: value, kind: "invalid/" + m.Name}, nil
+}
+
+// fileSource отправляет содержимое файла как есть
+type fileSource struct {
+	msg message
+}
+
+func newFileSource(path string) (*fileSource, error) {
+	value, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// ключ берётся из order_uid, если файл - корректный JSON с этим полем
+	var head struct {
+		OrderUID string `json:"order_uid"`
+	}
+	_ = json.Unmarshal(value, &head)
+
+	return &fileSource{msg: message{key: head.OrderUID, value: value, kind: "file"}}, nil
+}
+
+func (f *fileSource) next() (message, error) {
+	return f.msg, nil
+}
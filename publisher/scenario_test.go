@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"test_task_wb/internal/fakeorder"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestScenario(t *testing.T, seed uint64, m mix) *scenario {
+	t.Helper()
+	gen, err := fakeorder.New(fakeorder.WithSeed(seed))
+	require.NoError(t, err)
+	return newScenario(gen, m)
+}
+
+func TestScenario(t *testing.T) {
+	t.Run("Same seed gives same sequence", func(t *testing.T) {
+		m := mix{valid: 2, invalid: 1, duplicate: 1}
+		a, b := newTestScenario(t, 42, m), newTestScenario(t, 42, m)
+		for i := 0; i < 50; i++ {
+			ma, err := a.next()
+			require.NoError(t, err)
+			mb, err := b.next()
+			require.NoError(t, err)
+			require.Equal(t, ma.kind, mb.kind, "вид сообщения #%d должен совпадать", i)
+			require.Equal(t, ma.key, mb.key, "ключ сообщения #%d должен совпадать", i)
+		}
+	})
+
+	t.Run("Ratios are respected", func(t *testing.T) {
+		s := newTestScenario(t, 7, mix{valid: 6, invalid: 3, duplicate: 1})
+		counts := map[string]int{}
+		for i := 0; i < 10000; i++ {
+			msg, err := s.next()
+			require.NoError(t, err)
+			counts[strings.SplitN(msg.kind, "/", 2)[0]]++
+		}
+		require.InDelta(t, 6000, counts["valid"], 300, "доля валидных заказов")
+		require.InDelta(t, 3000, counts["invalid"], 300, "доля некорректных заказов")
+		require.InDelta(t, 1000, counts["duplicate"], 300, "доля повторов")
+	})
+
+	t.Run("Duplicate re-sends a valid order", func(t *testing.T) {
+		s := newTestScenario(t, 1, mix{valid: 1, duplicate: 1})
+		sent := map[string]bool{}
+		for i := 0; i < 200; i++ {
+			msg, err := s.next()
+			require.NoError(t, err)
+			if msg.kind == "duplicate" {
+				require.True(t, sent[msg.key], "повтор должен ссылаться на уже отправленный заказ")
+				continue
+			}
+			sent[msg.key] = true
+		}
+	})
+}